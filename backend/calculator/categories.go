@@ -0,0 +1,131 @@
+package calculator
+
+// Déclaration des catégories du calculateur. Ajouter une catégorie ou une
+// entrée se fait ici uniquement : le moteur (engine.go) interprète ces
+// définitions sans code spécifique à une catégorie.
+var categories = []Category{
+	{
+		Name: "Transports",
+		Fields: []Field{
+			{Name: "trainKm", Type: Number, Unit: "km"},
+			{Name: "flightKm", Type: Number, Unit: "km"},
+			{Name: "flightType", Type: Enum, Values: []string{"domestic", "international"}},
+			{Name: "carKm", Type: Number, Unit: "km"},
+			{Name: "carType", Type: Enum, Values: []string{"small", "medium", "big"}},
+			{Name: "carOccupants", Type: Number, Unit: "personnes", Min: 1, Max: 9, Integer: true},
+		},
+		Terms: []Term{
+			{Input: "trainKm", Factor: "Transports.train"},
+			{Input: "flightKm", Factor: "Transports.flight", Modifiers: []Modifier{
+				{Input: "flightType", Values: map[string]float64{"domestic": 0.85}},
+			}},
+			{Input: "carKm", Factor: "Transports.car.{carType}", Divisor: "carOccupants"},
+		},
+	},
+	{
+		Name: "Logement_electromenagers",
+		Fields: []Field{
+			{Name: "homeOccupants", Type: Number, Unit: "personnes", Min: 1, Integer: true},
+			{Name: "homeSize", Type: Number, Unit: "m²"},
+			{Name: "electricityKwh", Type: Number, Unit: "kWh"},
+			{Name: "gasKwh", Type: Number, Unit: "kWh"},
+			{Name: "housingType", Type: Enum, Values: []string{"apartment", "house"}},
+			{Name: "applianceCount", Type: Number, Unit: "appareils", Integer: true},
+			{Name: "electronicCount", Type: Number, Unit: "appareils", Integer: true},
+		},
+		Terms: []Term{
+			{Input: "electricityKwh", Factor: "Logement_electromenagers.electricity", Divisor: "homeOccupants"},
+			{Input: "gasKwh", Factor: "Logement_electromenagers.gas", Divisor: "homeOccupants"},
+			{Input: "homeSize", Factor: "Logement_electromenagers.{housingType}", Divisor: "homeOccupants"},
+			{Input: "applianceCount", Factor: "Logement_electromenagers.appliance", Divisor: "homeOccupants"},
+			{Input: "electronicCount", Factor: "Logement_electromenagers.electronic", Divisor: "homeOccupants"},
+		},
+	},
+	{
+		Name: "Alimentation",
+		Fields: []Field{
+			{Name: "redMeatKg", Type: Number, Unit: "kg"},
+			{Name: "whiteMeatKg", Type: Number, Unit: "kg"},
+			{Name: "porkKg", Type: Number, Unit: "kg"},
+			{Name: "bulkPurchase", Type: Enum, Values: []string{"none", "partial", "total"}},
+			{Name: "shortCircuit", Type: Enum, Values: []string{"none", "partial", "majority"}},
+		},
+		Terms: []Term{
+			{Input: "redMeatKg", Factor: "Alimentation.redMeat"},
+			{Input: "whiteMeatKg", Factor: "Alimentation.whiteMeat"},
+			{Input: "porkKg", Factor: "Alimentation.pork"},
+		},
+		Modifiers: []Modifier{
+			{Input: "bulkPurchase", Factor: "Alimentation.bulkFoodPurchase.{bulkPurchase}"},
+			{Input: "shortCircuit", Factor: "Alimentation.shortCircuit.{shortCircuit}"},
+		},
+	},
+	{
+		Name: "Vetements",
+		Fields: []Field{
+			{Name: "largeItems", Type: Number, Unit: "articles", Integer: true},
+			{Name: "smallItems", Type: Number, Unit: "articles", Integer: true},
+			{Name: "origin", Type: Enum, Values: []string{"france", "autre"}},
+		},
+		Terms: []Term{
+			{Input: "largeItems", Factor: "Vetements.large"},
+			{Input: "smallItems", Factor: "Vetements.small"},
+		},
+		Modifiers: []Modifier{
+			{Input: "origin", Factor: "Vetements.madein.{origin}"},
+		},
+	},
+	{
+		Name: "Numerique",
+		Fields: []Field{
+			{Name: "googleSearches", Type: Number, Unit: "recherches/jour"},
+			{Name: "chatgptPrompts", Type: Number, Unit: "requêtes/jour"},
+			{Name: "smartphoneType", Type: Enum, Values: []string{"", "small", "large"}},
+			{Name: "smartphoneState", Type: Enum, Values: []string{"new", "used", "old"}},
+			{Name: "socialHours", Type: Number, Unit: "heures/jour"},
+		},
+		Terms: []Term{
+			{Input: "googleSearches", Factor: "Numerique.googleSearch", Scale: 30},
+			{Input: "chatgptPrompts", Factor: "Numerique.chatGPT", Scale: 30},
+			// Achat de smartphone : quantité fixe, facteur choisi par le modèle
+			{Factor: "Numerique.smartphone.{smartphoneType}", Modifiers: []Modifier{
+				{Input: "smartphoneState", Factor: "Numerique.smartphone.{smartphoneState}"},
+			}},
+			{Input: "socialHours", Factor: "Numerique.socialMedia", Scale: 365},
+		},
+	},
+	{
+		Name: "Consommation",
+		Fields: []Field{
+			{Name: "amazonOrders", Type: Number, Unit: "commandes", Integer: true},
+			{Name: "leboncoinOrders", Type: Number, Unit: "commandes", Integer: true},
+			{Name: "artisanatOrders", Type: Number, Unit: "commandes", Integer: true},
+			{Name: "brocanteItems", Type: Number, Unit: "articles", Integer: true},
+			{Name: "localShopOrders", Type: Number, Unit: "achats", Integer: true},
+		},
+		Terms: []Term{
+			{Input: "amazonOrders", Factor: "Consommation.ecommerce.amazon"},
+			{Input: "leboncoinOrders", Factor: "Consommation.ecommerce.leboncoin"},
+			{Input: "artisanatOrders", Factor: "Consommation.ecommerce.artisanat"},
+			{Input: "brocanteItems", Factor: "Consommation.commerce.brocante"},
+			{Input: "localShopOrders", Factor: "Consommation.commerce.localShops"},
+		},
+	},
+	{
+		Name: "Sport_loisirs",
+		Fields: []Field{
+			{Name: "piscine", Type: Number, Unit: "séances"},
+			{Name: "skiDays", Type: Number, Unit: "jours"},
+			{Name: "sportMecaniqueHours", Type: Number, Unit: "heures"},
+			{Name: "salleDeSport", Type: Number, Unit: "séances"},
+			{Name: "sportPleinAir", Type: Number, Unit: "séances"},
+		},
+		Terms: []Term{
+			{Input: "piscine", Factor: "SportLoisirs.piscine"},
+			{Input: "skiDays", Factor: "SportLoisirs.ski"},
+			{Input: "sportMecaniqueHours", Factor: "SportLoisirs.sportMecanique"},
+			{Input: "salleDeSport", Factor: "SportLoisirs.salleDeSport"},
+			{Input: "sportPleinAir", Factor: "SportLoisirs.sportPleinAir"},
+		},
+	},
+}
@@ -0,0 +1,280 @@
+// Package calculator calcule l'empreinte carbone d'une catégorie à partir des
+// entrées utilisateur et d'un jeu de facteurs d'émission.
+package calculator
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type FieldType string
+
+const (
+	Number FieldType = "number"
+	Enum   FieldType = "enum"
+)
+
+// Field décrit une entrée attendue pour une catégorie. Les entrées Number
+// doivent être comprises entre Min et Max (Max nul : pas de borne haute).
+type Field struct {
+	Name    string    `json:"name"`
+	Type    FieldType `json:"type"`
+	Unit    string    `json:"unit,omitempty"`
+	Values  []string  `json:"values,omitempty"`
+	Min     float64   `json:"min"`
+	Max     float64   `json:"max,omitempty"`
+	Integer bool      `json:"integer,omitempty"`
+}
+
+// Term est une contribution additive : quantité × facteur × Scale, divisée
+// par la valeur de Divisor si renseigné (calcul par occupant).
+//
+// Input vide signifie une quantité fixe de 1. Factor peut contenir des
+// références {entrée} remplacées par la valeur d'une entrée de type Enum ;
+// si la référence ou le facteur est introuvable, le terme est ignoré.
+type Term struct {
+	Input     string     `json:"input,omitempty"`
+	Factor    string     `json:"factor"`
+	Scale     float64    `json:"scale,omitempty"`
+	Divisor   string     `json:"divisor,omitempty"`
+	Modifiers []Modifier `json:"modifiers,omitempty"`
+}
+
+// Modifier est un coefficient multiplicatif choisi par une entrée de type
+// Enum : soit un facteur (Factor, avec références {entrée}), soit une
+// constante de Values. Une valeur sans coefficient laisse le résultat
+// inchangé.
+type Modifier struct {
+	Input  string             `json:"input"`
+	Factor string             `json:"factor,omitempty"`
+	Values map[string]float64 `json:"values,omitempty"`
+}
+
+// Category regroupe les entrées d'une catégorie et la manière de les
+// combiner. Les Modifiers de la catégorie s'appliquent à tous ses termes.
+type Category struct {
+	Name      string     `json:"name"`
+	Fields    []Field    `json:"fields"`
+	Terms     []Term     `json:"terms"`
+	Modifiers []Modifier `json:"modifiers,omitempty"`
+}
+
+// Line est la contribution d'un terme au résultat d'une catégorie.
+type Line struct {
+	Input       string             `json:"input,omitempty"`
+	Quantity    float64            `json:"quantity"`
+	Factor      string             `json:"factor"`
+	FactorValue float64            `json:"factorValue"`
+	Scale       float64            `json:"scale,omitempty"`
+	Divisor     float64            `json:"divisor,omitempty"`
+	Modifiers   map[string]float64 `json:"modifiers,omitempty"`
+	Value       float64            `json:"value"`
+}
+
+type Result struct {
+	Category string  `json:"category"`
+	Value    float64 `json:"value"`
+	Lines    []Line  `json:"lines"`
+}
+
+// Categories renvoie les définitions de toutes les catégories connues.
+func Categories() []Category {
+	return categories
+}
+
+// FactorKeys renvoie les clés de facteurs référencées par les définitions
+// des catégories, les références {entrée} étant développées sur les valeurs
+// des champs Enum. Les facteurs des termes sont requis ; ceux des
+// modificateurs sont facultatifs, une valeur sans coefficient laissant le
+// résultat inchangé.
+func FactorKeys() (required, optional map[string]bool) {
+	required, optional = map[string]bool{}, map[string]bool{}
+	for _, category := range categories {
+		modifiers := slices.Clone(category.Modifiers)
+		for _, term := range category.Terms {
+			for _, key := range category.expand(term.Factor) {
+				required[key] = true
+			}
+			modifiers = append(modifiers, term.Modifiers...)
+		}
+		for _, modifier := range modifiers {
+			if modifier.Factor == "" {
+				continue
+			}
+			for _, key := range category.expand(modifier.Factor) {
+				optional[key] = true
+			}
+		}
+	}
+	for key := range required {
+		delete(optional, key)
+	}
+	return required, optional
+}
+
+// Lookup renvoie la définition d'une catégorie.
+func Lookup(name string) (Category, bool) {
+	for _, category := range categories {
+		if category.Name == name {
+			return category, true
+		}
+	}
+	return Category{}, false
+}
+
+// Compute calcule l'empreinte d'une catégorie. Les entrées absentes ou d'un
+// type inattendu ne contribuent pas au résultat ; Validate permet de les
+// signaler au préalable.
+func Compute(categoryName string, inputs map[string]any, factors Factors) (Result, error) {
+	category, ok := Lookup(categoryName)
+	if !ok {
+		return Result{}, fmt.Errorf("catégorie inconnue: %s", categoryName)
+	}
+
+	result := Result{Category: category.Name, Lines: []Line{}}
+	for _, term := range category.Terms {
+		line, ok := category.evalTerm(term, inputs, factors)
+		if !ok {
+			continue
+		}
+		result.Lines = append(result.Lines, line)
+		result.Value += line.Value
+	}
+	return result, nil
+}
+
+func (category Category) evalTerm(term Term, inputs map[string]any, factors Factors) (Line, bool) {
+	line := Line{Input: term.Input, Quantity: 1, Scale: term.Scale}
+
+	if term.Input != "" {
+		quantity, ok := inputs[term.Input].(float64)
+		if !ok {
+			return Line{}, false
+		}
+		line.Quantity = quantity
+	}
+
+	key, ok := category.resolve(term.Factor, inputs)
+	if !ok {
+		return Line{}, false
+	}
+	factor, ok := factors[key]
+	if !ok {
+		return Line{}, false
+	}
+	line.Factor = key
+	line.FactorValue = factor
+
+	value := line.Quantity * factor
+	if term.Scale != 0 {
+		value *= term.Scale
+	}
+
+	if term.Divisor != "" {
+		divisor, ok := inputs[term.Divisor].(float64)
+		if !ok || divisor <= 0 {
+			return Line{}, false
+		}
+		line.Divisor = divisor
+		value /= divisor
+	}
+
+	for _, modifier := range append(slices.Clone(term.Modifiers), category.Modifiers...) {
+		coefficient, ok := category.coefficient(modifier, inputs, factors)
+		if !ok {
+			continue
+		}
+		if line.Modifiers == nil {
+			line.Modifiers = map[string]float64{}
+		}
+		line.Modifiers[modifier.Input] = coefficient
+		value *= coefficient
+	}
+
+	line.Value = value
+	return line, true
+}
+
+func (category Category) coefficient(modifier Modifier, inputs map[string]any, factors Factors) (float64, bool) {
+	choice, ok := inputs[modifier.Input].(string)
+	if !ok {
+		return 0, false
+	}
+	if coefficient, ok := modifier.Values[choice]; ok {
+		return coefficient, true
+	}
+	if modifier.Factor == "" {
+		return 0, false
+	}
+	key, ok := category.resolve(modifier.Factor, inputs)
+	if !ok {
+		return 0, false
+	}
+	coefficient, ok := factors[key]
+	return coefficient, ok
+}
+
+// resolve remplace les références {entrée} d'une clé de facteur. Seules les
+// valeurs déclarées dans le champ Enum correspondant sont acceptées, pour
+// qu'une entrée ne puisse pas désigner un facteur arbitraire.
+func (category Category) resolve(template string, inputs map[string]any) (string, bool) {
+	var key strings.Builder
+	rest := template
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			key.WriteString(rest)
+			return key.String(), true
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return "", false
+		}
+		name := rest[start+1 : start+end]
+
+		value, ok := inputs[name].(string)
+		if !ok || value == "" {
+			return "", false
+		}
+		field, ok := category.field(name)
+		if !ok || field.Type != Enum || !slices.Contains(field.Values, value) {
+			return "", false
+		}
+
+		key.WriteString(rest[:start])
+		key.WriteString(value)
+		rest = rest[start+end+1:]
+	}
+}
+
+// expand développe les références {entrée} d'une clé de facteur sur toutes
+// les valeurs non vides du champ Enum référencé.
+func (category Category) expand(template string) []string {
+	keys := []string{template}
+	for _, name := range placeholders(template) {
+		field, ok := category.field(name)
+		if !ok || field.Type != Enum {
+			return nil
+		}
+		var expanded []string
+		for _, key := range keys {
+			for _, value := range field.Values {
+				if value != "" {
+					expanded = append(expanded, strings.Replace(key, "{"+name+"}", value, 1))
+				}
+			}
+		}
+		keys = expanded
+	}
+	return keys
+}
+
+func (category Category) field(name string) (Field, bool) {
+	for _, field := range category.Fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return Field{}, false
+}
@@ -0,0 +1,389 @@
+package calculator_test
+
+import (
+	"carbone-app/calculator"
+	"carbone-app/models"
+	"math"
+	"testing"
+)
+
+// legacyFactors reprend les facteurs compilés de l'ancien calculateCarbon.
+func legacyFactors() models.CarbonFactors {
+	factors := models.CarbonFactors{}
+
+	factors.Transports.Train = 0.014
+	factors.Transports.Flight = 0.285
+	factors.Transports.Car.Small = 0.1
+	factors.Transports.Car.Medium = 0.2
+	factors.Transports.Car.Big = 0.3
+
+	factors.LogementElectromenagers.Electricity = 0.57
+	factors.LogementElectromenagers.Gas = 0.2
+	factors.LogementElectromenagers.Apartment = 15
+	factors.LogementElectromenagers.House = 20
+	factors.LogementElectromenagers.Appliance = 0.5
+	factors.LogementElectromenagers.Electronic = 0.3
+
+	factors.Alimentation.RedMeat = 27
+	factors.Alimentation.WhiteMeat = 6.9
+	factors.Alimentation.Pork = 7.2
+	factors.Alimentation.BulkFoodPurchase.None = 1
+	factors.Alimentation.BulkFoodPurchase.Partial = 0.9
+	factors.Alimentation.BulkFoodPurchase.Total = 0.8
+	factors.Alimentation.ShortCircuit.None = 1.0
+	factors.Alimentation.ShortCircuit.Partial = 0.9
+	factors.Alimentation.ShortCircuit.Majority = 0.8
+
+	factors.Vetements.Large = 15
+	factors.Vetements.Small = 10
+	factors.Vetements.Madein.France = 1
+	factors.Vetements.Madein.Autre = 1.2
+
+	factors.Numerique.GoogleSearch = 0.0002
+	factors.Numerique.ChatGPT = 0.000382
+	factors.Numerique.SocialMedia = 0.000380
+	factors.Numerique.Smartphone.Small = 35
+	factors.Numerique.Smartphone.Large = 75
+	factors.Numerique.Smartphone.Used = 0.5
+	factors.Numerique.Smartphone.Old = 0.5
+
+	factors.Consommation.Ecommerce.Amazon = 0.25
+	factors.Consommation.Ecommerce.LeBonCoin = 0.05
+	factors.Consommation.Ecommerce.Artisanat = 0.1
+	factors.Consommation.Commerce.Brocante = 0.03
+	factors.Consommation.Commerce.LocalShops = 0.08
+
+	factors.SportLoisirs.Piscine = 1
+	factors.SportLoisirs.Ski = 48.9
+	factors.SportLoisirs.SportMecanique = 10.0
+	factors.SportLoisirs.SalleDeSport = 1
+	factors.SportLoisirs.SportPleinAir = 0.0001
+
+	return factors
+}
+
+// legacyCalculate est le switch de l'ancien calculateCarbon, conservé comme
+// référence pour le moteur.
+func legacyCalculate(category string, inputs map[string]any, factors models.CarbonFactors) float64 {
+	var result float64
+
+	switch category {
+	case "Transports":
+		if trainKm, ok := inputs["trainKm"].(float64); ok {
+			result += trainKm * factors.Transports.Train
+		}
+		if flightKm, ok := inputs["flightKm"].(float64); ok {
+			flightFactor := factors.Transports.Flight
+			if flightType, ok := inputs["flightType"].(string); ok {
+				if flightType == "domestic" {
+					flightFactor *= 0.85
+				}
+			}
+			result += flightKm * flightFactor
+		}
+		if carKm, ok := inputs["carKm"].(float64); ok {
+			if carType, ok := inputs["carType"].(string); ok {
+				if occupants, ok := inputs["carOccupants"].(float64); ok && occupants > 0 {
+					switch carType {
+					case "small":
+						result += (carKm * factors.Transports.Car.Small) / occupants
+					case "medium":
+						result += (carKm * factors.Transports.Car.Medium) / occupants
+					case "big":
+						result += (carKm * factors.Transports.Car.Big) / occupants
+					}
+				}
+			}
+		}
+
+	case "Logement_electromenagers":
+		if electricityKwh, ok := inputs["electricityKwh"].(float64); ok {
+			if homeOccupants, ok := inputs["homeOccupants"].(float64); ok && homeOccupants > 0 {
+				result += (electricityKwh * factors.LogementElectromenagers.Electricity) / homeOccupants
+			}
+		}
+		if gasKwh, ok := inputs["gasKwh"].(float64); ok {
+			if homeOccupants, ok := inputs["homeOccupants"].(float64); ok && homeOccupants > 0 {
+				result += (gasKwh * factors.LogementElectromenagers.Gas) / homeOccupants
+			}
+		}
+		if housingType, ok := inputs["housingType"].(string); ok {
+			if homeSize, ok := inputs["homeSize"].(float64); ok {
+				if homeOccupants, ok := inputs["homeOccupants"].(float64); ok && homeOccupants > 0 {
+					switch housingType {
+					case "apartment":
+						result += (factors.LogementElectromenagers.Apartment * homeSize) / homeOccupants
+					case "house":
+						result += (factors.LogementElectromenagers.House * homeSize) / homeOccupants
+					}
+				}
+			}
+		}
+		if applianceCount, ok := inputs["applianceCount"].(float64); ok {
+			if homeOccupants, ok := inputs["homeOccupants"].(float64); ok && homeOccupants > 0 {
+				result += (applianceCount * factors.LogementElectromenagers.Appliance) / homeOccupants
+			}
+		}
+		if electronicCount, ok := inputs["electronicCount"].(float64); ok {
+			if homeOccupants, ok := inputs["homeOccupants"].(float64); ok && homeOccupants > 0 {
+				result += (electronicCount * factors.LogementElectromenagers.Electronic) / homeOccupants
+			}
+		}
+
+	case "Alimentation":
+		if redMeatKg, ok := inputs["redMeatKg"].(float64); ok {
+			result += redMeatKg * factors.Alimentation.RedMeat
+		}
+		if whiteMeatKg, ok := inputs["whiteMeatKg"].(float64); ok {
+			result += whiteMeatKg * factors.Alimentation.WhiteMeat
+		}
+		if porkKg, ok := inputs["porkKg"].(float64); ok {
+			result += porkKg * factors.Alimentation.Pork
+		}
+		if bulkPurchase, ok := inputs["bulkPurchase"].(string); ok {
+			switch bulkPurchase {
+			case "none":
+				result *= factors.Alimentation.BulkFoodPurchase.None
+			case "partial":
+				result *= factors.Alimentation.BulkFoodPurchase.Partial
+			case "total":
+				result *= factors.Alimentation.BulkFoodPurchase.Total
+			}
+		}
+		if shortCircuit, ok := inputs["shortCircuit"].(string); ok {
+			switch shortCircuit {
+			case "none":
+				result *= factors.Alimentation.ShortCircuit.None
+			case "partial":
+				result *= factors.Alimentation.ShortCircuit.Partial
+			case "majority":
+				result *= factors.Alimentation.ShortCircuit.Majority
+			}
+		}
+
+	case "Vetements":
+		if largeItems, ok := inputs["largeItems"].(float64); ok {
+			result += largeItems * factors.Vetements.Large
+		}
+		if smallItems, ok := inputs["smallItems"].(float64); ok {
+			result += smallItems * factors.Vetements.Small
+		}
+		if origin, ok := inputs["origin"].(string); ok {
+			switch origin {
+			case "france":
+				result *= factors.Vetements.Madein.France
+			case "autre":
+				result *= factors.Vetements.Madein.Autre
+			}
+		}
+
+	case "Numerique":
+		if googleSearches, ok := inputs["googleSearches"].(float64); ok {
+			result += (googleSearches * 30) * factors.Numerique.GoogleSearch
+		}
+		if chatgptPrompts, ok := inputs["chatgptPrompts"].(float64); ok {
+			result += (chatgptPrompts * 30) * factors.Numerique.ChatGPT
+		}
+		if smartphoneType, ok := inputs["smartphoneType"].(string); ok && smartphoneType != "" {
+			var baseEmission float64
+			switch smartphoneType {
+			case "small":
+				baseEmission = factors.Numerique.Smartphone.Small
+			case "large":
+				baseEmission = factors.Numerique.Smartphone.Large
+			}
+
+			if state, ok := inputs["smartphoneState"].(string); ok {
+				switch state {
+				case "used":
+					baseEmission *= factors.Numerique.Smartphone.Used
+				case "old":
+					baseEmission *= factors.Numerique.Smartphone.Old
+				}
+			}
+
+			result += baseEmission
+		}
+		if socialHours, ok := inputs["socialHours"].(float64); ok {
+			result += (socialHours * 365) * factors.Numerique.SocialMedia
+		}
+
+	case "Consommation":
+		if amazonOrders, ok := inputs["amazonOrders"].(float64); ok {
+			result += amazonOrders * factors.Consommation.Ecommerce.Amazon
+		}
+		if leboncoinOrders, ok := inputs["leboncoinOrders"].(float64); ok {
+			result += leboncoinOrders * factors.Consommation.Ecommerce.LeBonCoin
+		}
+		if artisanatOrders, ok := inputs["artisanatOrders"].(float64); ok {
+			result += artisanatOrders * factors.Consommation.Ecommerce.Artisanat
+		}
+		if brocanteItems, ok := inputs["brocanteItems"].(float64); ok {
+			result += brocanteItems * factors.Consommation.Commerce.Brocante
+		}
+		if localShopOrders, ok := inputs["localShopOrders"].(float64); ok {
+			result += localShopOrders * factors.Consommation.Commerce.LocalShops
+		}
+
+	case "Sport_loisirs":
+		if piscine, ok := inputs["piscine"].(float64); ok {
+			result += piscine * factors.SportLoisirs.Piscine
+		}
+		if skiDays, ok := inputs["skiDays"].(float64); ok {
+			result += skiDays * factors.SportLoisirs.Ski
+		}
+		if sportMecaniqueHours, ok := inputs["sportMecaniqueHours"].(float64); ok {
+			result += sportMecaniqueHours * factors.SportLoisirs.SportMecanique
+		}
+		if salleDeSport, ok := inputs["salleDeSport"].(float64); ok {
+			result += salleDeSport * factors.SportLoisirs.SalleDeSport
+		}
+		if sportPleinAir, ok := inputs["sportPleinAir"].(float64); ok {
+			result += sportPleinAir * factors.SportLoisirs.SportPleinAir
+		}
+	}
+
+	return result
+}
+
+type input = map[string]any
+
+var cases = []struct {
+	name     string
+	category string
+	inputs   input
+}{
+	{"train", "Transports", input{"trainKm": 120.0}},
+	{"avion sans type", "Transports", input{"flightKm": 800.0}},
+	{"avion intérieur", "Transports", input{"flightKm": 800.0, "flightType": "domestic"}},
+	{"avion international", "Transports", input{"flightKm": 800.0, "flightType": "international"}},
+	{"petite voiture", "Transports", input{"carKm": 300.0, "carType": "small", "carOccupants": 1.0}},
+	{"voiture moyenne partagée", "Transports", input{"carKm": 300.0, "carType": "medium", "carOccupants": 3.0}},
+	{"grande voiture partagée", "Transports", input{"carKm": 300.0, "carType": "big", "carOccupants": 2.0}},
+	{"tous transports", "Transports", input{
+		"trainKm": 50.0, "flightKm": 1200.0, "flightType": "domestic",
+		"carKm": 420.0, "carType": "medium", "carOccupants": 2.0,
+	}},
+
+	{"électricité et gaz", "Logement_electromenagers", input{"electricityKwh": 250.0, "gasKwh": 400.0, "homeOccupants": 2.0}},
+	{"appartement", "Logement_electromenagers", input{"housingType": "apartment", "homeSize": 45.0, "homeOccupants": 1.0}},
+	{"maison", "Logement_electromenagers", input{"housingType": "house", "homeSize": 120.0, "homeOccupants": 4.0}},
+	{"appareils", "Logement_electromenagers", input{"applianceCount": 6.0, "electronicCount": 9.0, "homeOccupants": 3.0}},
+	{"logement complet", "Logement_electromenagers", input{
+		"homeOccupants": 3.0, "homeSize": 90.0, "housingType": "apartment",
+		"electricityKwh": 310.0, "gasKwh": 120.0, "applianceCount": 5.0, "electronicCount": 7.0,
+	}},
+
+	{"viandes", "Alimentation", input{"redMeatKg": 2.0, "whiteMeatKg": 1.5, "porkKg": 0.5}},
+	{"vrac aucun", "Alimentation", input{"redMeatKg": 2.0, "bulkPurchase": "none"}},
+	{"vrac partiel", "Alimentation", input{"redMeatKg": 2.0, "bulkPurchase": "partial"}},
+	{"vrac total", "Alimentation", input{"redMeatKg": 2.0, "bulkPurchase": "total"}},
+	{"circuit court aucun", "Alimentation", input{"porkKg": 3.0, "shortCircuit": "none"}},
+	{"circuit court partiel", "Alimentation", input{"porkKg": 3.0, "shortCircuit": "partial"}},
+	{"circuit court majoritaire", "Alimentation", input{"porkKg": 3.0, "shortCircuit": "majority"}},
+	{"alimentation complète", "Alimentation", input{
+		"redMeatKg": 1.2, "whiteMeatKg": 2.4, "porkKg": 0.8, "bulkPurchase": "partial", "shortCircuit": "majority",
+	}},
+
+	{"vêtements", "Vetements", input{"largeItems": 2.0, "smallItems": 3.0}},
+	{"vêtements français", "Vetements", input{"largeItems": 2.0, "smallItems": 3.0, "origin": "france"}},
+	{"vêtements importés", "Vetements", input{"largeItems": 2.0, "smallItems": 3.0, "origin": "autre"}},
+
+	{"recherches et requêtes", "Numerique", input{"googleSearches": 40.0, "chatgptPrompts": 15.0}},
+	{"réseaux sociaux", "Numerique", input{"socialHours": 2.5}},
+	{"petit smartphone neuf", "Numerique", input{"smartphoneType": "small", "smartphoneState": "new"}},
+	{"grand smartphone sans état", "Numerique", input{"smartphoneType": "large"}},
+	{"smartphone d'occasion", "Numerique", input{"smartphoneType": "large", "smartphoneState": "used"}},
+	{"vieux smartphone", "Numerique", input{"smartphoneType": "small", "smartphoneState": "old"}},
+	{"pas de smartphone", "Numerique", input{"smartphoneType": "", "smartphoneState": "used"}},
+	{"numérique complet", "Numerique", input{
+		"googleSearches": 25.0, "chatgptPrompts": 5.0, "smartphoneType": "small", "smartphoneState": "used", "socialHours": 1.5,
+	}},
+
+	{"commandes en ligne", "Consommation", input{"amazonOrders": 4.0, "leboncoinOrders": 2.0, "artisanatOrders": 1.0}},
+	{"achats locaux", "Consommation", input{"brocanteItems": 6.0, "localShopOrders": 10.0}},
+
+	{"sports", "Sport_loisirs", input{
+		"piscine": 8.0, "skiDays": 3.0, "sportMecaniqueHours": 2.0, "salleDeSport": 12.0, "sportPleinAir": 20.0,
+	}},
+
+	{"aucune entrée", "Transports", input{}},
+}
+
+// TestComputeMatchesLegacy vérifie que le moteur donne, pour chaque catégorie
+// et chaque modificateur, le résultat de l'ancien switch.
+func TestComputeMatchesLegacy(t *testing.T) {
+	model := legacyFactors()
+	factors, err := calculator.FromModel(model)
+	if err != nil {
+		t.Fatalf("FromModel: %v", err)
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.category+"/"+tc.name, func(t *testing.T) {
+			if errs := calculator.Validate(tc.category, tc.inputs); len(errs) > 0 {
+				t.Fatalf("entrées de test invalides: %+v", errs)
+			}
+			result, err := calculator.Compute(tc.category, tc.inputs, factors)
+			if err != nil {
+				t.Fatalf("Compute: %v", err)
+			}
+			want := legacyCalculate(tc.category, tc.inputs, model)
+			if math.Abs(result.Value-want) > 1e-9*math.Max(1, math.Abs(want)) {
+				t.Errorf("Compute = %v, ancien calcul = %v", result.Value, want)
+			}
+
+			var sum float64
+			for _, line := range result.Lines {
+				sum += line.Value
+			}
+			if math.Abs(sum-result.Value) > 1e-9*math.Max(1, math.Abs(sum)) {
+				t.Errorf("somme des lignes = %v, valeur = %v", sum, result.Value)
+			}
+		})
+	}
+}
+
+// TestCasesCoverEveryField vérifie que les cas ci-dessus renseignent chaque
+// entrée et chaque valeur de choix de toutes les catégories.
+func TestCasesCoverEveryField(t *testing.T) {
+	seen := map[string]bool{}
+	for _, tc := range cases {
+		for name, value := range tc.inputs {
+			seen[tc.category+"."+name] = true
+			if choice, ok := value.(string); ok {
+				seen[tc.category+"."+name+"="+choice] = true
+			}
+		}
+	}
+
+	for _, category := range calculator.Categories() {
+		for _, field := range category.Fields {
+			if !seen[category.Name+"."+field.Name] {
+				t.Errorf("%s.%s n'est couvert par aucun cas", category.Name, field.Name)
+			}
+			for _, value := range field.Values {
+				if !seen[category.Name+"."+field.Name+"="+value] {
+					t.Errorf("%s.%s=%q n'est couvert par aucun cas", category.Name, field.Name, value)
+				}
+			}
+		}
+	}
+}
+
+func TestFromModel(t *testing.T) {
+	factors, err := calculator.FromModel(legacyFactors())
+	if err != nil {
+		t.Fatalf("FromModel: %v", err)
+	}
+	if factors["Transports.car.medium"] != 0.2 || factors["Numerique.smartphone.old"] != 0.5 {
+		t.Errorf("FromModel: chemins inattendus: %v", factors)
+	}
+
+	required, _ := calculator.FactorKeys()
+	for key := range required {
+		if _, ok := factors[key]; !ok {
+			t.Errorf("facteur requis absent du modèle: %s", key)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package calculator
+
+import (
+	"carbone-app/models"
+	"encoding/json"
+	"fmt"
+)
+
+// Factors associe à chaque chemin de facteur ("Transports.car.small", ...)
+// sa valeur. Les chemins reprennent les clés JSON de models.CarbonFactors.
+type Factors map[string]float64
+
+// FromModel aplatit un models.CarbonFactors en Factors.
+func FromModel(model models.CarbonFactors) (Factors, error) {
+	raw, err := json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	return FromJSON(raw)
+}
+
+// FromJSON aplatit un document JSON imbriqué de facteurs en Factors.
+func FromJSON(raw []byte) (Factors, error) {
+	var tree map[string]any
+	if err := json.Unmarshal(raw, &tree); err != nil {
+		return nil, err
+	}
+	factors := Factors{}
+	if err := flatten(factors, "", tree); err != nil {
+		return nil, err
+	}
+	return factors, nil
+}
+
+func flatten(factors Factors, prefix string, node map[string]any) error {
+	for key, value := range node {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case float64:
+			factors[path] = v
+		case map[string]any:
+			if err := flatten(factors, path, v); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("facteur %s: valeur non numérique", path)
+		}
+	}
+	return nil
+}
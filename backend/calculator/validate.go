@@ -0,0 +1,134 @@
+package calculator
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Codes d'erreur renvoyés dans FieldError.Code
+const (
+	CodeUnknownCategory = "unknown_category"
+	CodeUnknownField    = "unknown_field"
+	CodeInvalidType     = "invalid_type"
+	CodeOutOfRange      = "out_of_range"
+	CodeNotInteger      = "not_integer"
+	CodeInvalidValue    = "invalid_value"
+	CodeRequired        = "required"
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Validate vérifie les entrées d'une catégorie par rapport à sa définition
+// et renvoie toutes les erreurs trouvées, triées par champ. Une entrée à null
+// est traitée comme absente.
+func Validate(categoryName string, inputs map[string]any) []FieldError {
+	category, ok := Lookup(categoryName)
+	if !ok {
+		return []FieldError{{
+			Field:   "category",
+			Code:    CodeUnknownCategory,
+			Message: fmt.Sprintf("catégorie inconnue: %s", categoryName),
+		}}
+	}
+
+	errs := []FieldError{}
+	for name, value := range inputs {
+		if value == nil {
+			continue
+		}
+		field, ok := category.field(name)
+		if !ok {
+			errs = append(errs, FieldError{name, CodeUnknownField, "entrée inconnue pour cette catégorie"})
+			continue
+		}
+		if err := field.check(value); err != nil {
+			errs = append(errs, *err)
+		}
+	}
+
+	// Les entrées dont dépend un terme (diviseur, choix du facteur) sont
+	// obligatoires dès que la quantité du terme est renseignée
+	for _, term := range category.Terms {
+		quantity, ok := inputs[term.Input].(float64)
+		if term.Input == "" || !ok || quantity == 0 {
+			continue
+		}
+		required := placeholders(term.Factor)
+		if term.Divisor != "" {
+			required = append(required, term.Divisor)
+		}
+		for _, name := range required {
+			if inputs[name] == nil && !hasError(errs, name) {
+				errs = append(errs, FieldError{name, CodeRequired, fmt.Sprintf("requis lorsque %s est renseigné", term.Input)})
+			}
+		}
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Field < errs[j].Field
+	})
+	return errs
+}
+
+func (field Field) check(value any) *FieldError {
+	switch field.Type {
+	case Number:
+		number, ok := value.(float64)
+		if !ok {
+			return &FieldError{field.Name, CodeInvalidType, "nombre attendu"}
+		}
+		if number < field.Min || (field.Max != 0 && number > field.Max) {
+			message := fmt.Sprintf("doit être supérieur ou égal à %g", field.Min)
+			if field.Max != 0 {
+				message = fmt.Sprintf("doit être compris entre %g et %g", field.Min, field.Max)
+			}
+			return &FieldError{field.Name, CodeOutOfRange, message}
+		}
+		if field.Integer && number != math.Trunc(number) {
+			return &FieldError{field.Name, CodeNotInteger, "nombre entier attendu"}
+		}
+	case Enum:
+		choice, ok := value.(string)
+		if !ok {
+			return &FieldError{field.Name, CodeInvalidType, "chaîne attendue"}
+		}
+		if !slices.Contains(field.Values, choice) {
+			return &FieldError{field.Name, CodeInvalidValue, "valeurs acceptées: " + strings.Join(field.Values, ", ")}
+		}
+	}
+	return nil
+}
+
+// placeholders renvoie les noms des entrées référencées par {entrée} dans une
+// clé de facteur.
+func placeholders(template string) []string {
+	var names []string
+	for {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			return names
+		}
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			return names
+		}
+		names = append(names, template[start+1:start+end])
+		template = template[start+end+1:]
+	}
+}
+
+func hasError(errs []FieldError, field string) bool {
+	for _, err := range errs {
+		if err.Field == field {
+			return true
+		}
+	}
+	return false
+}
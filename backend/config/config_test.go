@@ -0,0 +1,350 @@
+package config
+
+import (
+	"carbone-app/signing"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const secret = "0123456789abcdef0123456789abcdef"
+
+// envVars liste les variables lues par Load, vidées avant chaque test pour
+// ne pas dépendre de l'environnement de la machine.
+var envVars = []string{
+	"CONFIG_FILE", "LISTEN_ADDR", "TLS_CERT_FILE", "TLS_KEY_FILE", "CORS_ORIGINS",
+	"DATABASE_DRIVER", "DATABASE_URL", "DB_MAX_OPEN_CONNS", "DB_MAX_IDLE_CONNS", "DB_CONN_MAX_LIFETIME",
+	"JWT_KEYS_FILE", "JWT_SECRET", "JWT_ACCESS_TOKEN_TTL",
+	"RESULT_VALUE_POLICY", "RESULT_VALUE_FILL",
+	"MAIL_DRIVER", "MAIL_FROM", "MAIL_BASE_URL", "MAIL_FILE",
+	"SMTP_HOST", "SMTP_PORT", "SMTP_USERNAME", "SMTP_PASSWORD",
+	"ACCOUNT_DELETION_GRACE_PERIOD", "LOG_LEVEL",
+}
+
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range envVars {
+		// t.Setenv restaure la valeur d'origine à la fin du test
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const yamlFile = `
+server:
+  addr: ":9000"
+  corsOrigins: ["https://fichier.example"]
+database:
+  dsn: "postgres://fichier:motdepasse@db:5432/carbone"
+  maxOpenConns: 10
+jwt:
+  secret: "` + secret + `"
+  accessTokenTTL: 30m
+logLevel: warn
+`
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t)
+	path := writeFile(t, "config.yaml", yamlFile)
+
+	// Valeurs par défaut seules
+	cfg, _, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load sans fichier: %v", err)
+	}
+	if cfg.Server.Addr != ":8080" || cfg.Database.MaxOpenConns != 25 || cfg.LogLevel != "info" {
+		t.Errorf("valeurs par défaut: %+v", cfg)
+	}
+
+	// Le fichier l'emporte sur les valeurs par défaut, qui restent pour ce
+	// qu'il ne précise pas
+	cfg, _, err = Load([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("Load avec fichier: %v", err)
+	}
+	if cfg.Server.Addr != ":9000" || cfg.Database.MaxOpenConns != 10 || cfg.LogLevel != "warn" ||
+		cfg.JWT.AccessTokenTTL.Duration != 30*time.Minute {
+		t.Errorf("fichier non appliqué: %+v", cfg)
+	}
+	if cfg.Database.MaxIdleConns != 5 || cfg.Database.Driver != DriverPostgres {
+		t.Errorf("valeurs par défaut écrasées: %+v", cfg.Database)
+	}
+
+	// L'environnement l'emporte sur le fichier
+	t.Setenv("LISTEN_ADDR", ":9001")
+	t.Setenv("DB_MAX_OPEN_CONNS", "12")
+	t.Setenv("LOG_LEVEL", "debug")
+	cfg, _, err = Load([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("Load avec environnement: %v", err)
+	}
+	if cfg.Server.Addr != ":9001" || cfg.Database.MaxOpenConns != 12 || cfg.LogLevel != "debug" {
+		t.Errorf("environnement non appliqué: %+v", cfg)
+	}
+	if cfg.Server.CORSOrigins[0] != "https://fichier.example" {
+		t.Errorf("origines CORS du fichier perdues: %v", cfg.Server.CORSOrigins)
+	}
+
+	// Les options l'emportent sur tout, et les arguments restants sont rendus
+	cfg, rest, err := Load([]string{"-config", path, "-addr", ":9002", "-db-max-open-conns", "15",
+		"-cors-origins", "https://a.example, https://b.example", "migrate", "up"})
+	if err != nil {
+		t.Fatalf("Load avec options: %v", err)
+	}
+	if cfg.Server.Addr != ":9002" || cfg.Database.MaxOpenConns != 15 || cfg.LogLevel != "debug" {
+		t.Errorf("options non appliquées: %+v", cfg)
+	}
+	if len(cfg.Server.CORSOrigins) != 2 || cfg.Server.CORSOrigins[1] != "https://b.example" {
+		t.Errorf("origines CORS: %v", cfg.Server.CORSOrigins)
+	}
+	if strings.Join(rest, " ") != "migrate up" {
+		t.Errorf("arguments restants: %v", rest)
+	}
+
+	// CONFIG_FILE désigne le fichier quand -config est absent
+	t.Setenv("CONFIG_FILE", path)
+	if cfg, _, err = Load(nil); err != nil || cfg.Database.DSN != "postgres://fichier:motdepasse@db:5432/carbone" {
+		t.Errorf("CONFIG_FILE: %v, dsn %q", err, cfg.Database.DSN)
+	}
+}
+
+func TestLoadEnvInvalid(t *testing.T) {
+	for name, value := range map[string]string{
+		"DB_MAX_OPEN_CONNS":    "beaucoup",
+		"JWT_ACCESS_TOKEN_TTL": "15",
+		"RESULT_VALUE_FILL":    "peut-être",
+	} {
+		clearEnv(t)
+		t.Setenv(name, value)
+		if _, _, err := Load(nil); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("%s=%q: %v, attendu une erreur nommant la variable", name, value, err)
+		}
+	}
+}
+
+func TestLoadFileFormats(t *testing.T) {
+	clearEnv(t)
+	toml := `
+logLevel = "error"
+
+[server]
+addr = ":7000"
+
+[database]
+driver = "sqlite"
+dsn = "carbone.db"
+connMaxLifetime = "1h"
+
+[jwt]
+activeKey = "k1"
+
+[[jwt.keys]]
+id = "k1"
+algorithm = "HS256"
+secret = "` + secret + `"
+
+[mail]
+driver = "file"
+file = "mails.log"
+`
+	files := map[string]string{
+		"config.yaml": yamlFile,
+		"config.yml":  yamlFile,
+		"config.toml": toml,
+	}
+	for name, content := range files {
+		var cfg Config
+		if err := loadFile(&cfg, writeFile(t, name, content)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	cfg, _, err := Load([]string{"-config", writeFile(t, "config.toml", toml)})
+	if err != nil {
+		t.Fatalf("Load TOML: %v", err)
+	}
+	if cfg.Server.Addr != ":7000" || cfg.Database.Driver != DriverSQLite || cfg.Database.DSN != "carbone.db" ||
+		cfg.Database.ConnMaxLifetime.Duration != time.Hour || cfg.Mail.Driver != MailFile || cfg.LogLevel != "error" {
+		t.Errorf("TOML: %+v", cfg)
+	}
+	// Les clés du fichier sont gardées telles quelles, sans clé "default"
+	if len(cfg.JWT.Keys) != 1 || cfg.JWT.Keys[0].ID != "k1" {
+		t.Errorf("clés JWT: %+v", cfg.JWT.Keys)
+	}
+
+	for name, content := range map[string]string{
+		"config.json": `{"logLevel": "warn"}`,
+		"config.yaml": "server: [",
+		"config.toml": "[server",
+	} {
+		if _, _, err := Load([]string{"-config", writeFile(t, name, content)}); err == nil {
+			t.Errorf("%s invalide accepté", name)
+		}
+	}
+	if _, _, err := Load([]string{"-config", filepath.Join(t.TempDir(), "absent.yaml")}); err == nil {
+		t.Error("fichier absent accepté")
+	}
+}
+
+func TestLoadKeysFile(t *testing.T) {
+	clearEnv(t)
+	keys := writeFile(t, "keys.json",
+		`{"activeKey": "k2", "keys": [{"id": "k1", "algorithm": "HS256", "secret": "`+secret+`"},
+		{"id": "k2", "algorithm": "HS256", "secret": "`+secret+`"}]}`)
+	t.Setenv("JWT_KEYS_FILE", keys)
+	// Le fichier de clés l'emporte sur le secret
+	t.Setenv("JWT_SECRET", "ignoré")
+
+	cfg, _, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.JWT.ActiveKey != "k2" || len(cfg.JWT.Keys) != 2 {
+		t.Errorf("clés JWT: %s %+v", cfg.JWT.ActiveKey, cfg.JWT.Keys)
+	}
+}
+
+func TestLoadSecretAndEphemeralKey(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("JWT_SECRET", secret)
+	cfg, _, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.JWT.ActiveKey != "default" || len(cfg.JWT.Keys) != 1 || cfg.JWT.Keys[0].Secret != secret {
+		t.Errorf("clé issue du secret: %s %+v", cfg.JWT.ActiveKey, cfg.JWT.Keys)
+	}
+
+	clearEnv(t)
+	first, _, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load sans clé: %v", err)
+	}
+	second, _, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load sans clé: %v", err)
+	}
+	if first.JWT.Keys[0].Secret == "" || first.JWT.Keys[0].Secret == second.JWT.Keys[0].Secret {
+		t.Error("la clé éphémère doit être aléatoire")
+	}
+}
+
+// valid renvoie une configuration complète qui passe Validate.
+func valid() Config {
+	cfg := Default()
+	cfg.JWT.ActiveKey = "default"
+	cfg.JWT.Keys = []signing.KeyConfig{{ID: "default", Algorithm: signing.HS256, Secret: secret}}
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("configuration valide refusée: %v", err)
+	}
+
+	cases := map[string]func(*Config){
+		"adresse vide":        func(c *Config) { c.Server.Addr = "" },
+		"sans origine CORS":   func(c *Config) { c.Server.CORSOrigins = nil },
+		"origine sans schéma": func(c *Config) { c.Server.CORSOrigins = []string{"localhost:5173"} },
+		"certificat sans clé": func(c *Config) { c.Server.TLS.CertFile = "cert.pem" },
+		"certificat absent": func(c *Config) {
+			c.Server.TLS = TLSConfig{CertFile: "/absent/cert.pem", KeyFile: "/absent/key.pem"}
+		},
+		"pilote inconnu":         func(c *Config) { c.Database.Driver = "mysql" },
+		"dsn vide":               func(c *Config) { c.Database.DSN = "" },
+		"dsn postgres en sqlite": func(c *Config) { c.Database.Driver = DriverSQLite },
+		"connexions négatives":   func(c *Config) { c.Database.MaxOpenConns = -1 },
+		"plus d'inactives que d'ouvertes": func(c *Config) {
+			c.Database.MaxOpenConns, c.Database.MaxIdleConns = 2, 3
+		},
+		"ttl trop court":        func(c *Config) { c.JWT.AccessTokenTTL.Duration = time.Second },
+		"sans clé JWT":          func(c *Config) { c.JWT.Keys = nil },
+		"secret JWT trop court": func(c *Config) { c.JWT.Keys[0].Secret = "court" },
+		"politique inconnue":    func(c *Config) { c.Results.ValuePolicy = "ignore" },
+		"délai négatif":         func(c *Config) { c.Accounts.DeletionGracePeriod.Duration = -time.Hour },
+		"niveau de log inconnu": func(c *Config) { c.LogLevel = "bavard" },
+		"smtp sans hôte":        func(c *Config) { c.Mail.Driver = MailSMTP },
+		"port smtp invalide": func(c *Config) {
+			c.Mail.Driver, c.Mail.SMTP.Host, c.Mail.SMTP.Port = MailSMTP, "smtp.example", 70000
+		},
+		"fichier mail vide":     func(c *Config) { c.Mail.Driver = MailFile },
+		"transport inconnu":     func(c *Config) { c.Mail.Driver = "pigeon" },
+		"expéditeur invalide":   func(c *Config) { c.Mail.From = "pas une adresse" },
+		"url frontend invalide": func(c *Config) { c.Mail.BaseURL = "localhost" },
+	}
+	for name, mutate := range cases {
+		cfg := valid()
+		mutate(&cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: accepté", name)
+		}
+	}
+
+	// Toutes les erreurs sont renvoyées d'un coup
+	cfg := valid()
+	cfg.Server.Addr = ""
+	cfg.LogLevel = "bavard"
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "server.addr") || !strings.Contains(err.Error(), "logLevel") {
+		t.Errorf("erreurs cumulées: %v", err)
+	}
+}
+
+func TestRedactDSN(t *testing.T) {
+	cases := map[string]string{
+		"postgres://alice:motdepasse@db:5432/carbone?sslmode=disable": "postgres://alice:***@db:5432/carbone?sslmode=disable",
+		"postgres://alice@db/carbone":                                 "postgres://alice@db/carbone",
+		"host=db user=alice password=motdepasse dbname=carbone":       "host=db user=alice password=*** dbname=carbone",
+		"carbone.db": "carbone.db",
+	}
+	for dsn, want := range cases {
+		if got := redactDSN(dsn); got != want {
+			t.Errorf("redactDSN(%q) = %q, attendu %q", dsn, got, want)
+		}
+	}
+}
+
+func TestRedactedHidesSecrets(t *testing.T) {
+	for _, dsn := range []string{
+		"postgres://alice:motdepasse@db:5432/carbone",
+		"host=db user=alice password=motdepasse dbname=carbone",
+	} {
+		cfg := valid()
+		cfg.Database.DSN = dsn
+		cfg.JWT.Secret = secret
+		cfg.JWT.Keys = append(cfg.JWT.Keys, signing.KeyConfig{ID: "old", Algorithm: signing.HS256, Secret: "ancien-secret-de-signature-jwt-hs256"})
+		cfg.Mail.SMTP.Password = "mot-de-passe-smtp"
+
+		out := cfg.String()
+		for _, leaked := range []string{"motdepasse", secret, "ancien-secret-de-signature-jwt-hs256", "mot-de-passe-smtp"} {
+			if strings.Contains(out, leaked) {
+				t.Errorf("secret %q affiché:\n%s", leaked, out)
+			}
+		}
+		if !strings.Contains(out, "alice") || !strings.Contains(out, redacted) {
+			t.Errorf("configuration masquée illisible:\n%s", out)
+		}
+
+		// La configuration d'origine n'est pas modifiée
+		if cfg.Database.DSN != dsn || cfg.JWT.Keys[0].Secret != secret || cfg.Mail.SMTP.Password != "mot-de-passe-smtp" {
+			t.Errorf("Redacted a modifié l'original: %+v", cfg)
+		}
+	}
+
+	// Un secret absent n'est pas remplacé par "***"
+	cfg := Default().Redacted()
+	if cfg.JWT.Secret != "" || cfg.Mail.SMTP.Password != "" {
+		t.Errorf("secrets vides masqués: %+v", cfg)
+	}
+}
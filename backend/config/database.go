@@ -2,63 +2,43 @@ package config
 
 import (
 	"database/sql"
-	"log"
+	"strings"
 
 	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
 )
 
-const (
-	host     = "localhost"
-	port     = 5432
-	user     = "postgres"
-	password = "postgres"
-	dbname   = "carbon_calculator"
-)
-
-func InitDB() (*sql.DB, error) {
-	db, err := sql.Open("postgres", "user=postgres password=postgres dbname=carbon_calculator sslmode=disable")
-	if err != nil {
-		return nil, err
+func InitDB(cfg DatabaseConfig) (*sql.DB, error) {
+	dsn := cfg.DSN
+	if cfg.Driver == DriverSQLite {
+		dsn = sqliteDSN(dsn)
 	}
-
-	// Supprimer les tables existantes
-	_, err = db.Exec(`
-		DROP TABLE IF EXISTS results CASCADE;
-		DROP TABLE IF EXISTS users CASCADE;
-	`)
-	if err != nil {
-		log.Printf("Erreur lors de la suppression des tables: %v", err)
-	}
-
-	// Créer la table users avec la nouvelle structure
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS users (
-			id UUID PRIMARY KEY,
-			email VARCHAR(255) UNIQUE NOT NULL,
-			username VARCHAR(50) NOT NULL,
-			password VARCHAR(255) NOT NULL
-		)
-	`)
+	db, err := sql.Open(cfg.Driver, dsn)
 	if err != nil {
 		return nil, err
 	}
 
-	// Créer la table results
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS results (
-			id UUID PRIMARY KEY,
-			user_id UUID REFERENCES users(id),
-			category VARCHAR(50) NOT NULL,
-			value FLOAT NOT NULL,
-			inputs JSONB,
-			month DATE NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			UNIQUE(user_id, category, month)
-		)
-	`)
-	if err != nil {
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime.Duration)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return db, nil
 }
+
+// sqliteDSN active sur chaque connexion les clés étrangères, nécessaires aux
+// suppressions en cascade, et une attente plutôt qu'une erreur quand une
+// autre connexion écrit. Les dates sont écrites dans le format de SQLite,
+// qui se compare comme du texte, et chaque transaction prend le verrou
+// d'écriture dès son début : c'est ce qui remplace SELECT ... FOR UPDATE.
+func sqliteDSN(dsn string) string {
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return dsn + separator + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite&_txlock=immediate"
+}
@@ -0,0 +1,316 @@
+// Package factorsets gère les jeux de facteurs d'émission versionnés stockés
+// en base. Un jeu publié n'est plus modifiable, à une exception près : la
+// publication d'un jeu sans date de fin clôt le jeu ouvert qui le précède, en
+// renseignant son valid_to. Les périodes de validité des jeux publiés ne se
+// chevauchent pas et un nouveau jeu ne peut commencer ni avant le premier jour
+// du mois en cours, ni avant le jeu en vigueur : pour un mois passé, le jeu
+// applicable reste le même, ce qui rend les calculs passés reproductibles.
+package factorsets
+
+import (
+	"carbone-app/calculator"
+	"carbone-app/models"
+	"carbone-app/store"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	StatusDraft     = "draft"
+	StatusPublished = "published"
+)
+
+var (
+	ErrNotFound  = errors.New("jeu de facteurs introuvable")
+	ErrPublished = errors.New("jeu de facteurs déjà publié")
+	ErrOverlap   = errors.New("la période de validité chevauche un jeu publié")
+	ErrBackdated = errors.New("la date de début précède le mois en cours ou le jeu en vigueur")
+	// ErrInvalid préfixe les erreurs de Validate
+	ErrInvalid = errors.New("jeu de facteurs invalide")
+)
+
+type Change struct {
+	Factor string   `json:"factor"`
+	From   *float64 `json:"from"`
+	To     *float64 `json:"to"`
+}
+
+const columns = `id, version, source, valid_from, valid_to, status, factors, created_at, published_at`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scan(row scanner) (models.FactorSet, error) {
+	var set models.FactorSet
+	var validTo, publishedAt sql.NullTime
+	var factors []byte
+	err := row.Scan(&set.ID, &set.Version, &set.Source, &set.ValidFrom, &validTo,
+		&set.Status, &factors, &set.CreatedAt, &publishedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return set, ErrNotFound
+	}
+	if err != nil {
+		return set, err
+	}
+	set.Factors = factors
+	if validTo.Valid {
+		set.ValidTo = &validTo.Time
+	}
+	if publishedAt.Valid {
+		set.PublishedAt = &publishedAt.Time
+	}
+	return set, nil
+}
+
+func Get(db *sql.DB, id string) (models.FactorSet, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return models.FactorSet{}, ErrNotFound
+	}
+	return scan(db.QueryRow("SELECT "+columns+" FROM factor_sets WHERE id = $1", id))
+}
+
+func List(db *sql.DB) ([]models.FactorSet, error) {
+	rows, err := db.Query("SELECT " + columns + " FROM factor_sets ORDER BY valid_from DESC, created_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sets := []models.FactorSet{}
+	for rows.Next() {
+		set, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+	return sets, rows.Err()
+}
+
+// ForMonth renvoie le jeu publié valide pour le mois donné.
+func ForMonth(db *sql.DB, month time.Time) (models.FactorSet, error) {
+	return ForDate(db, time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC))
+}
+
+// ForDate renvoie le jeu publié valide au jour donné.
+func ForDate(db *sql.DB, date time.Time) (models.FactorSet, error) {
+	return scan(db.QueryRow(`
+		SELECT `+columns+`
+		FROM factor_sets
+		WHERE status = $1
+			AND valid_from <= $2
+			AND (valid_to IS NULL OR valid_to >= $2)
+		ORDER BY valid_from DESC
+		LIMIT 1
+	`, StatusPublished, store.Date(date)))
+}
+
+// Load renvoie le jeu publié valide au jour donné et ses facteurs aplatis.
+func Load(db *sql.DB, date time.Time) (models.FactorSet, calculator.Factors, error) {
+	set, err := ForDate(db, date)
+	if err != nil {
+		return set, nil, err
+	}
+	factors, err := Factors(set)
+	return set, factors, err
+}
+
+// Factors renvoie les facteurs aplatis d'un jeu, prêts pour le calculateur.
+func Factors(set models.FactorSet) (calculator.Factors, error) {
+	return calculator.FromJSON(set.Factors)
+}
+
+// Validate vérifie qu'un jeu définit tous les facteurs requis par les
+// catégories du calculateur, et aucun facteur qu'elles ne référencent pas,
+// avec des valeurs positives. Les erreurs enveloppent ErrInvalid.
+func Validate(set models.FactorSet) error {
+	factors, err := Factors(set)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	required, optional := calculator.FactorKeys()
+	for key := range required {
+		if _, ok := factors[key]; !ok {
+			return fmt.Errorf("%w: facteur manquant: %s", ErrInvalid, key)
+		}
+	}
+	for key, value := range factors {
+		if !required[key] && !optional[key] {
+			return fmt.Errorf("%w: facteur inconnu: %s", ErrInvalid, key)
+		}
+		if value < 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("%w: facteur %s: valeur invalide", ErrInvalid, key)
+		}
+	}
+	if set.ValidTo != nil && set.ValidTo.Before(set.ValidFrom) {
+		return fmt.Errorf("%w: valid_to est antérieur à valid_from", ErrInvalid)
+	}
+	return nil
+}
+
+// Create enregistre un nouveau jeu à l'état de brouillon.
+func Create(db *sql.DB, set *models.FactorSet) error {
+	if err := Validate(*set); err != nil {
+		return err
+	}
+
+	set.ID = uuid.New().String()
+	set.Status = StatusDraft
+	set.CreatedAt = time.Now().UTC()
+	set.PublishedAt = nil
+
+	_, err := db.Exec(`
+		INSERT INTO factor_sets (id, version, source, valid_from, valid_to, status, factors, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, set.ID, set.Version, set.Source, store.Date(set.ValidFrom), store.NullDate(set.ValidTo), set.Status,
+		[]byte(set.Factors), set.CreatedAt)
+	return err
+}
+
+// Publish publie un brouillon. Si le jeu n'a pas de date de fin, le jeu
+// publié ouvert qui le précède est clos la veille de sa date de début : c'est
+// la seule modification apportée à un jeu déjà publié. Tout autre
+// chevauchement est refusé, de même qu'une date de début antérieure au mois
+// en cours ou au jeu en vigueur aujourd'hui, qui changerait les facteurs de
+// mois passés.
+func Publish(db *sql.DB, id string) (models.FactorSet, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return models.FactorSet{}, ErrNotFound
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return models.FactorSet{}, err
+	}
+	defer tx.Rollback()
+
+	set, err := scan(tx.QueryRow("SELECT "+columns+" FROM factor_sets WHERE id = $1", id))
+	if err != nil {
+		return set, err
+	}
+	if set.Status != StatusDraft {
+		return set, ErrPublished
+	}
+
+	today := time.Now().UTC()
+	var currentFrom time.Time
+	err = tx.QueryRow(`
+		SELECT valid_from
+		FROM factor_sets
+		WHERE status = $1
+			AND valid_from <= $2
+			AND (valid_to IS NULL OR valid_to >= $2)
+		ORDER BY valid_from DESC
+		LIMIT 1
+	`, StatusPublished, store.Date(today)).Scan(&currentFrom)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return set, err
+	}
+	earliest := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if currentFrom.After(earliest) {
+		earliest = currentFrom
+	}
+	if set.ValidFrom.Before(earliest) {
+		return set, ErrBackdated
+	}
+
+	if set.ValidTo == nil {
+		_, err = tx.Exec(`
+			UPDATE factor_sets
+			SET valid_to = $1
+			WHERE status = $2 AND valid_to IS NULL AND valid_from < $3
+		`, store.Date(set.ValidFrom.AddDate(0, 0, -1)), StatusPublished, store.Date(set.ValidFrom))
+		if err != nil {
+			return set, err
+		}
+	}
+
+	overlap := `
+		SELECT COUNT(*)
+		FROM factor_sets
+		WHERE status = $1 AND (valid_to IS NULL OR valid_to >= $2)`
+	args := []any{StatusPublished, store.Date(set.ValidFrom)}
+	if set.ValidTo != nil {
+		overlap += " AND valid_from <= $3"
+		args = append(args, store.Date(*set.ValidTo))
+	}
+	var overlaps int
+	err = tx.QueryRow(overlap, args...).Scan(&overlaps)
+	if err != nil {
+		return set, err
+	}
+	if overlaps > 0 {
+		return set, ErrOverlap
+	}
+
+	// La condition sur le statut écarte une publication concurrente du même
+	// brouillon
+	now := time.Now().UTC()
+	res, err := tx.Exec(`
+		UPDATE factor_sets SET status = $1, published_at = $2
+		WHERE id = $3 AND status = $4
+	`, StatusPublished, now, id, StatusDraft)
+	if err != nil {
+		return set, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return set, err
+	} else if n == 0 {
+		return set, ErrPublished
+	}
+	if err := tx.Commit(); err != nil {
+		return set, err
+	}
+
+	set.Status = StatusPublished
+	set.PublishedAt = &now
+	return set, nil
+}
+
+// Diff liste les facteurs qui diffèrent entre deux jeux.
+func Diff(from, to models.FactorSet) ([]Change, error) {
+	before, err := Factors(from)
+	if err != nil {
+		return nil, err
+	}
+	after, err := Factors(to)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[string]bool{}
+	for key := range before {
+		keys[key] = true
+	}
+	for key := range after {
+		keys[key] = true
+	}
+
+	changes := []Change{}
+	for key := range keys {
+		oldValue, hadOld := before[key]
+		newValue, hasNew := after[key]
+		if hadOld && hasNew && oldValue == newValue {
+			continue
+		}
+		change := Change{Factor: key}
+		if hadOld {
+			change.From = &oldValue
+		}
+		if hasNew {
+			change.To = &newValue
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Factor < changes[j].Factor
+	})
+	return changes, nil
+}
@@ -0,0 +1,221 @@
+package factorsets
+
+import (
+	"carbone-app/config"
+	"carbone-app/migrations"
+	"carbone-app/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Jeu historique inséré par la migration 0002, valide depuis le 1er janvier 2000
+const seedID = "00000000-0000-0000-0000-000000000001"
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	cfg := config.Default().Database
+	cfg.Driver = config.DriverSQLite
+	cfg.DSN = filepath.Join(t.TempDir(), "factorsets.db")
+	db, err := config.InitDB(cfg)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := migrations.Up(db, config.DriverSQLite); err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+	return db
+}
+
+// seedFactors renvoie les facteurs aplatis du jeu historique.
+func seedFactors(t *testing.T, db *sql.DB) map[string]float64 {
+	t.Helper()
+	seed, err := Get(db, seedID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	factors, err := Factors(seed)
+	if err != nil {
+		t.Fatalf("Factors: %v", err)
+	}
+	return factors
+}
+
+// newSet construit un jeu à partir de facteurs aplatis, que FromJSON relit
+// tels quels.
+func newSet(t *testing.T, version string, factors map[string]float64, from time.Time) models.FactorSet {
+	t.Helper()
+	raw, err := json.Marshal(factors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return models.FactorSet{Version: version, Source: "test", ValidFrom: from, Factors: raw}
+}
+
+func draft(t *testing.T, db *sql.DB, set models.FactorSet) models.FactorSet {
+	t.Helper()
+	if err := Create(db, &set); err != nil {
+		t.Fatalf("Create %s: %v", set.Version, err)
+	}
+	return set
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Format("2006-01-02") == b.Format("2006-01-02")
+}
+
+func TestPublish(t *testing.T) {
+	db := openDB(t)
+	factors := seedFactors(t, db)
+	now := time.Now().UTC()
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	nextMonth := thisMonth.AddDate(0, 1, 0)
+
+	// Un jeu qui commence dans le passé changerait les facteurs de mois déjà
+	// calculés, même si le jeu en vigueur est plus ancien encore
+	for _, from := range []time.Time{
+		time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC),
+		thisMonth.AddDate(0, 0, -1),
+	} {
+		backdated := draft(t, db, newSet(t, "passé "+from.Format("2006-01-02"), factors, from))
+		if _, err := Publish(db, backdated.ID); !errors.Is(err, ErrBackdated) {
+			t.Errorf("Publish au %s: %v, attendu ErrBackdated", from.Format("2006-01-02"), err)
+		}
+	}
+	seed, err := Get(db, seedID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seed.ValidTo != nil {
+		t.Fatalf("jeu historique clos au %s par une publication refusée", seed.ValidTo.Format("2006-01-02"))
+	}
+
+	factors["Transports.train"] = 0.02
+	next := draft(t, db, newSet(t, "suivant", factors, nextMonth))
+	published, err := Publish(db, next.ID)
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if published.Status != StatusPublished || published.PublishedAt == nil {
+		t.Errorf("jeu publié: statut %s, publié le %v", published.Status, published.PublishedAt)
+	}
+
+	// Le jeu ouvert précédent est clos la veille
+	seed, err = Get(db, seedID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seed.ValidTo == nil || !sameDay(*seed.ValidTo, nextMonth.AddDate(0, 0, -1)) {
+		t.Errorf("jeu historique clos au %v, attendu la veille du %s", seed.ValidTo, nextMonth.Format("2006-01-02"))
+	}
+	if set, err := ForMonth(db, thisMonth); err != nil || set.ID != seedID {
+		t.Errorf("jeu du mois en cours = %s, %v ; attendu le jeu historique", set.ID, err)
+	}
+	if set, err := ForMonth(db, nextMonth); err != nil || set.ID != next.ID {
+		t.Errorf("jeu du mois prochain = %s, %v ; attendu %s", set.ID, err, next.ID)
+	}
+
+	// Seul un brouillon se publie
+	if _, err := Publish(db, next.ID); !errors.Is(err, ErrPublished) {
+		t.Errorf("seconde publication: %v, attendu ErrPublished", err)
+	}
+	if _, err := Publish(db, seedID); !errors.Is(err, ErrPublished) {
+		t.Errorf("publication du jeu historique: %v, attendu ErrPublished", err)
+	}
+	if _, err := Publish(db, "pas-un-uuid"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("publication d'un identifiant invalide: %v, attendu ErrNotFound", err)
+	}
+
+	// Le mois en cours n'est pas antidaté, mais un jeu sans fin qui y commence
+	// chevaucherait le jeu du mois prochain
+	overlapping := draft(t, db, newSet(t, "chevauchant", factors, thisMonth))
+	if _, err := Publish(db, overlapping.ID); !errors.Is(err, ErrOverlap) {
+		t.Errorf("Publish chevauchant: %v, attendu ErrOverlap", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	db := openDB(t)
+	from := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	if err := Validate(newSet(t, "complet", seedFactors(t, db), from)); err != nil {
+		t.Fatalf("jeu historique: %v", err)
+	}
+
+	// Chaque cas construit un jeu invalide à partir des facteurs historiques
+	cases := map[string]func(factors map[string]float64) models.FactorSet{
+		"facteur manquant": func(f map[string]float64) models.FactorSet {
+			delete(f, "Transports.train")
+			return newSet(t, "manquant", f, from)
+		},
+		"facteur inconnu": func(f map[string]float64) models.FactorSet {
+			f["Transports.bateau"] = 1
+			return newSet(t, "inconnu", f, from)
+		},
+		"valeur négative": func(f map[string]float64) models.FactorSet {
+			f["Transports.train"] = -0.1
+			return newSet(t, "négatif", f, from)
+		},
+		"fin avant début": func(f map[string]float64) models.FactorSet {
+			set := newSet(t, "fin", f, from)
+			end := from.AddDate(0, 0, -1)
+			set.ValidTo = &end
+			return set
+		},
+		"JSON illisible": func(map[string]float64) models.FactorSet {
+			return models.FactorSet{ValidFrom: from, Factors: []byte(`{"Transports":`)}
+		},
+		"valeur non numérique": func(map[string]float64) models.FactorSet {
+			return models.FactorSet{ValidFrom: from, Factors: []byte(`{"Transports": {"train": "beaucoup"}}`)}
+		},
+	}
+	for name, build := range cases {
+		t.Run(name, func(t *testing.T) {
+			if err := Validate(build(seedFactors(t, db))); !errors.Is(err, ErrInvalid) {
+				t.Errorf("Validate = %v, attendu ErrInvalid", err)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	from := models.FactorSet{Factors: []byte(`{"Transports": {"train": 0.014, "flight": 0.285}, "Alimentation": {"beef": 27}}`)}
+	to := models.FactorSet{Factors: []byte(`{"Transports": {"train": 0.02, "flight": 0.285}, "Alimentation": {"poultry": 6.9}}`)}
+
+	changes, err := Diff(from, to)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	value := func(v *float64) any {
+		if v == nil {
+			return nil
+		}
+		return *v
+	}
+	want := []struct {
+		factor   string
+		from, to any
+	}{
+		{"Alimentation.beef", 27.0, nil},
+		{"Alimentation.poultry", nil, 6.9},
+		{"Transports.train", 0.014, 0.02},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("Diff = %+v, attendu %d changements", changes, len(want))
+	}
+	for i, w := range want {
+		got := changes[i]
+		if got.Factor != w.factor || value(got.From) != w.from || value(got.To) != w.to {
+			t.Errorf("changement %d = %s %v -> %v, attendu %s %v -> %v",
+				i, got.Factor, value(got.From), value(got.To), w.factor, w.from, w.to)
+		}
+	}
+
+	if _, err := Diff(from, models.FactorSet{Factors: []byte(`pas du JSON`)}); err == nil {
+		t.Error("Diff accepte un jeu illisible")
+	}
+}
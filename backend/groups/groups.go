@@ -0,0 +1,332 @@
+// Package groups gère les groupes (ateliers) : création par un facilitateur,
+// invitation par code, rôles des membres et consentement au partage des
+// résultats.
+package groups
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Rôles d'un membre dans un groupe, du moins au plus privilégié
+const (
+	RoleMember      = "member"
+	RoleFacilitator = "facilitator"
+	RoleOwner       = "owner"
+)
+
+var roleLevels = map[string]int{
+	RoleMember:      1,
+	RoleFacilitator: 2,
+	RoleOwner:       3,
+}
+
+// ValidRole indique si role peut être attribué à un membre. Le rôle owner
+// n'est attribué qu'au créateur du groupe.
+func ValidRole(role string) bool {
+	return role == RoleMember || role == RoleFacilitator
+}
+
+// HasRole indique si role donne au moins les droits de required dans le groupe.
+func HasRole(role, required string) bool {
+	return roleLevels[role] >= roleLevels[required]
+}
+
+var (
+	ErrNotFound       = errors.New("groupe introuvable")
+	ErrMemberNotFound = errors.New("membre introuvable")
+	ErrInvalidCode    = errors.New("code d'invitation invalide")
+	ErrAlreadyMember  = errors.New("déjà membre du groupe")
+	ErrOwner          = errors.New("le créateur du groupe ne peut pas être modifié ni retiré")
+)
+
+type Group struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	InviteCode  string     `json:"invite_code,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Role        string     `json:"role"`
+	ConsentedAt *time.Time `json:"consented_at"`
+	MemberCount int        `json:"member_count"`
+}
+
+type Member struct {
+	UserID      string     `json:"user_id"`
+	Username    string     `json:"username"`
+	Role        string     `json:"role"`
+	ConsentedAt *time.Time `json:"consented_at"`
+	JoinedAt    time.Time  `json:"joined_at"`
+}
+
+// Alphabet des codes d'invitation, sans caractères ambigus (0/O, 1/I/L)
+const codeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+func generateCode() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	code := make([]byte, len(buf))
+	for i, b := range buf {
+		code[i] = codeAlphabet[int(b)%len(codeAlphabet)]
+	}
+	return string(code), nil
+}
+
+// Create crée un groupe dont userID devient le créateur (owner). Le créateur
+// doit lui aussi consentir pour que ses résultats soient partagés.
+func Create(db *sql.DB, userID, name, description string) (Group, error) {
+	code, err := generateCode()
+	if err != nil {
+		return Group{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Group{}, err
+	}
+	defer tx.Rollback()
+
+	group := Group{
+		ID:          uuid.New().String(),
+		Name:        name,
+		Description: description,
+		InviteCode:  code,
+		CreatedAt:   time.Now().UTC(),
+		Role:        RoleOwner,
+		MemberCount: 1,
+	}
+	_, err = tx.Exec(`
+		INSERT INTO groups (id, name, description, invite_code, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, group.ID, group.Name, group.Description, group.InviteCode, userID, group.CreatedAt)
+	if err != nil {
+		return Group{}, err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO group_members (group_id, user_id, role, joined_at)
+		VALUES ($1, $2, $3, $4)
+	`, group.ID, userID, RoleOwner, group.CreatedAt)
+	if err != nil {
+		return Group{}, err
+	}
+	return group, tx.Commit()
+}
+
+const groupColumns = `
+	g.id, g.name, g.description, g.invite_code, g.created_at, m.role, m.consented_at,
+	(SELECT COUNT(*) FROM group_members c WHERE c.group_id = g.id)
+`
+
+func scanGroup(row interface{ Scan(...any) error }) (Group, error) {
+	var group Group
+	var consentedAt sql.NullTime
+	err := row.Scan(&group.ID, &group.Name, &group.Description, &group.InviteCode, &group.CreatedAt,
+		&group.Role, &consentedAt, &group.MemberCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return group, ErrNotFound
+	}
+	if err != nil {
+		return group, err
+	}
+	if consentedAt.Valid {
+		group.ConsentedAt = &consentedAt.Time
+	}
+	// Seuls les facilitateurs du groupe peuvent inviter
+	if !HasRole(group.Role, RoleFacilitator) {
+		group.InviteCode = ""
+	}
+	return group, nil
+}
+
+// List renvoie les groupes dont l'utilisateur est membre.
+func List(db *sql.DB, userID string) ([]Group, error) {
+	rows, err := db.Query(`
+		SELECT `+groupColumns+`
+		FROM groups g
+		JOIN group_members m ON m.group_id = g.id
+		WHERE m.user_id = $1
+		ORDER BY g.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []Group{}
+	for rows.Next() {
+		group, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+// Get renvoie le groupe vu par userID ; un groupe dont il n'est pas membre
+// est introuvable.
+func Get(db *sql.DB, groupID, userID string) (Group, error) {
+	if _, err := uuid.Parse(groupID); err != nil {
+		return Group{}, ErrNotFound
+	}
+	return scanGroup(db.QueryRow(`
+		SELECT `+groupColumns+`
+		FROM groups g
+		JOIN group_members m ON m.group_id = g.id
+		WHERE g.id = $1 AND m.user_id = $2
+	`, groupID, userID))
+}
+
+// Join ajoute userID comme membre du groupe correspondant au code.
+func Join(db *sql.DB, userID, code string) (Group, error) {
+	var groupID string
+	err := db.QueryRow("SELECT id FROM groups WHERE invite_code = $1", normalizeCode(code)).Scan(&groupID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Group{}, ErrInvalidCode
+	}
+	if err != nil {
+		return Group{}, err
+	}
+
+	res, err := db.Exec(`
+		INSERT INTO group_members (group_id, user_id, role, joined_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (group_id, user_id) DO NOTHING
+	`, groupID, userID, RoleMember, time.Now().UTC())
+	if err != nil {
+		return Group{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return Group{}, ErrAlreadyMember
+	}
+	return Get(db, groupID, userID)
+}
+
+// RegenerateCode remplace le code d'invitation ; l'ancien lien cesse de
+// fonctionner.
+func RegenerateCode(db *sql.DB, groupID string) (string, error) {
+	code, err := generateCode()
+	if err != nil {
+		return "", err
+	}
+	res, err := db.Exec("UPDATE groups SET invite_code = $1 WHERE id = $2", code, groupID)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", ErrNotFound
+	}
+	return code, nil
+}
+
+func Delete(db *sql.DB, groupID string) error {
+	res, err := db.Exec("DELETE FROM groups WHERE id = $1", groupID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func Members(db *sql.DB, groupID string) ([]Member, error) {
+	rows, err := db.Query(`
+		SELECT m.user_id, u.username, m.role, m.consented_at, m.joined_at
+		FROM group_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.group_id = $1
+		ORDER BY m.joined_at, u.username
+	`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []Member{}
+	for rows.Next() {
+		var member Member
+		var consentedAt sql.NullTime
+		if err := rows.Scan(&member.UserID, &member.Username, &member.Role, &consentedAt, &member.JoinedAt); err != nil {
+			return nil, err
+		}
+		if consentedAt.Valid {
+			member.ConsentedAt = &consentedAt.Time
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// MemberRole renvoie le rôle de userID dans le groupe.
+func MemberRole(db *sql.DB, groupID, userID string) (string, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return "", ErrMemberNotFound
+	}
+	var role string
+	err := db.QueryRow("SELECT role FROM group_members WHERE group_id = $1 AND user_id = $2", groupID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrMemberNotFound
+	}
+	return role, err
+}
+
+// SetRole change le rôle d'un membre. Le rôle du créateur ne change pas.
+func SetRole(db *sql.DB, groupID, userID, role string) error {
+	current, err := MemberRole(db, groupID, userID)
+	if err != nil {
+		return err
+	}
+	if current == RoleOwner {
+		return ErrOwner
+	}
+	_, err = db.Exec("UPDATE group_members SET role = $1 WHERE group_id = $2 AND user_id = $3", role, groupID, userID)
+	return err
+}
+
+// RemoveMember retire un membre, à son initiative ou à celle d'un
+// facilitateur. Le créateur ne peut pas quitter son groupe : il le supprime.
+func RemoveMember(db *sql.DB, groupID, userID string) error {
+	role, err := MemberRole(db, groupID, userID)
+	if err != nil {
+		return err
+	}
+	if role == RoleOwner {
+		return ErrOwner
+	}
+	_, err = db.Exec("DELETE FROM group_members WHERE group_id = $1 AND user_id = $2", groupID, userID)
+	return err
+}
+
+// SetConsent enregistre ou retire le consentement du membre au partage de
+// ses résultats avec les facilitateurs du groupe. Le retrait prend effet
+// immédiatement.
+func SetConsent(db *sql.DB, groupID, userID string, consent bool) error {
+	var consentedAt *time.Time
+	if consent {
+		now := time.Now().UTC()
+		consentedAt = &now
+	}
+	res, err := db.Exec(`
+		UPDATE group_members SET consented_at = $1
+		WHERE group_id = $2 AND user_id = $3
+	`, consentedAt, groupID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,239 @@
+package groups
+
+import (
+	"carbone-app/store"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MinParticipants est le nombre minimal de membres consentants en dessous
+// duquel les résultats du groupe ne sont pas communiqués : avec un ou deux
+// participants, l'anonymisation ne protège personne.
+const MinParticipants = 3
+
+type CategoryStats struct {
+	Total        float64 `json:"total"`
+	Average      float64 `json:"average"`
+	Participants int     `json:"participants"`
+}
+
+// MonthStats agrège un mois ; Average est la moyenne par participant ayant
+// des résultats ce mois-là. Categories ne contient que les catégories
+// atteignant MinParticipants participants, et Total est leur somme.
+type MonthStats struct {
+	Month        string                   `json:"month"`
+	Total        float64                  `json:"total"`
+	Average      float64                  `json:"average"`
+	Participants int                      `json:"participants"`
+	Categories   map[string]CategoryStats `json:"categories"`
+}
+
+type ParticipantMonth struct {
+	Month      string             `json:"month"`
+	Total      float64            `json:"total"`
+	Categories map[string]float64 `json:"categories"`
+}
+
+// ParticipantResults contient les résultats d'un membre sous un libellé
+// anonyme (« Participant 1 »…), stable tant que le groupe ne change pas.
+type ParticipantResults struct {
+	Label  string             `json:"label"`
+	Months []ParticipantMonth `json:"months"`
+}
+
+type Report struct {
+	From            string               `json:"from"`
+	To              string               `json:"to"`
+	Members         int                  `json:"members"`
+	Participants    int                  `json:"participants"`
+	MinParticipants int                  `json:"minParticipants"`
+	Months          []MonthStats         `json:"months"`
+	PerParticipant  []ParticipantResults `json:"perParticipant"`
+}
+
+// Results renvoie les résultats des membres consentants entre from et to
+// inclus, agrégés par mois et catégorie et par participant anonymisé. Aucun
+// résultat n'est renvoyé sous MinParticipants participants, ni aucun agrégat
+// portant sur moins de MinParticipants participants.
+func Results(db *sql.DB, groupID string, from, to time.Time) (Report, error) {
+	report := Report{
+		From:            from.Format("2006-01"),
+		To:              to.Format("2006-01"),
+		MinParticipants: MinParticipants,
+		Months:          []MonthStats{},
+		PerParticipant:  []ParticipantResults{},
+	}
+
+	err := db.QueryRow(`
+		SELECT COUNT(*), COUNT(consented_at)
+		FROM group_members
+		WHERE group_id = $1
+	`, groupID).Scan(&report.Members, &report.Participants)
+	if err != nil {
+		return report, err
+	}
+	if report.Participants < MinParticipants {
+		return report, nil
+	}
+
+	months, err := monthStats(db, groupID, from, to)
+	if err != nil {
+		return report, err
+	}
+	report.Months = months
+
+	perParticipant, err := participantResults(db, groupID, from, to)
+	if err != nil {
+		return report, err
+	}
+	report.PerParticipant = perParticipant
+	return report, nil
+}
+
+// Totaux par mois et par catégorie. Le seuil MinParticipants s'applique à
+// chaque ligne agrégée : un mois ou une catégorie d'un mois comptant moins
+// de participants est omis. Le total du mois ne somme que les catégories
+// publiées, pour qu'on ne puisse pas en déduire celles qui sont omises.
+func monthStats(db *sql.DB, groupID string, from, to time.Time) ([]MonthStats, error) {
+	rows, err := db.Query(`
+		SELECT r.month, COUNT(DISTINCT r.user_id)
+		FROM results r
+		JOIN group_members m ON m.user_id = r.user_id
+		WHERE m.group_id = $1 AND m.consented_at IS NOT NULL
+			AND r.month >= $2 AND r.month <= $3
+		GROUP BY r.month
+		HAVING COUNT(DISTINCT r.user_id) >= $4
+		ORDER BY r.month
+	`, groupID, store.Date(from), store.Date(to), MinParticipants)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	months := []MonthStats{}
+	byMonth := map[string]int{}
+	for rows.Next() {
+		var month time.Time
+		var participants int
+		if err := rows.Scan(&month, &participants); err != nil {
+			return nil, err
+		}
+		byMonth[month.Format("2006-01")] = len(months)
+		months = append(months, MonthStats{
+			Month:        month.Format("2006-01"),
+			Participants: participants,
+			Categories:   map[string]CategoryStats{},
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`
+		SELECT r.month, r.category, SUM(r.value), COUNT(DISTINCT r.user_id)
+		FROM results r
+		JOIN group_members m ON m.user_id = r.user_id
+		WHERE m.group_id = $1 AND m.consented_at IS NOT NULL
+			AND r.month >= $2 AND r.month <= $3
+		GROUP BY r.month, r.category
+		HAVING COUNT(DISTINCT r.user_id) >= $4
+		ORDER BY r.month, r.category
+	`, groupID, store.Date(from), store.Date(to), MinParticipants)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var month time.Time
+		var category string
+		var total float64
+		var participants int
+		if err := rows.Scan(&month, &category, &total, &participants); err != nil {
+			return nil, err
+		}
+
+		i, ok := byMonth[month.Format("2006-01")]
+		if !ok {
+			continue
+		}
+		months[i].Categories[category] = CategoryStats{
+			Total:        total,
+			Average:      total / float64(participants),
+			Participants: participants,
+		}
+		months[i].Total += total
+	}
+	for i := range months {
+		months[i].Average = months[i].Total / float64(months[i].Participants)
+	}
+	return months, rows.Err()
+}
+
+func participantResults(db *sql.DB, groupID string, from, to time.Time) ([]ParticipantResults, error) {
+	rows, err := db.Query(`
+		SELECT m.user_id, r.month, r.category, r.value
+		FROM group_members m
+		JOIN results r ON r.user_id = m.user_id
+		WHERE m.group_id = $1 AND m.consented_at IS NOT NULL
+			AND r.month >= $2 AND r.month <= $3
+		ORDER BY r.month, r.category
+	`, groupID, store.Date(from), store.Date(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byUser := map[string]*ParticipantResults{}
+	for rows.Next() {
+		var userID, category string
+		var month time.Time
+		var value float64
+		if err := rows.Scan(&userID, &month, &category, &value); err != nil {
+			return nil, err
+		}
+
+		current, ok := byUser[userID]
+		if !ok {
+			current = &ParticipantResults{}
+			byUser[userID] = current
+		}
+		label := month.Format("2006-01")
+		if n := len(current.Months); n == 0 || current.Months[n-1].Month != label {
+			current.Months = append(current.Months, ParticipantMonth{Month: label, Categories: map[string]float64{}})
+		}
+		entry := &current.Months[len(current.Months)-1]
+		entry.Categories[category] = value
+		entry.Total += value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// L'ordre des participants dépend d'un hachage et non de l'ordre
+	// d'adhésion, qui permettrait de les reconnaître
+	userIDs := make([]string, 0, len(byUser))
+	for userID := range byUser {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Slice(userIDs, func(i, j int) bool {
+		return participantKey(groupID, userIDs[i]) < participantKey(groupID, userIDs[j])
+	})
+
+	participants := make([]ParticipantResults, 0, len(userIDs))
+	for i, userID := range userIDs {
+		participant := *byUser[userID]
+		participant.Label = fmt.Sprintf("Participant %d", i+1)
+		participants = append(participants, participant)
+	}
+	return participants, nil
+}
+
+func participantKey(groupID, userID string) string {
+	sum := md5.Sum([]byte(groupID + userID))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"carbone-app/logging"
+	"carbone-app/mailer"
+	"carbone-app/sessions"
+	"carbone-app/store"
+	"carbone-app/tokens"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SendVerification envoie à l'utilisateur un lien de vérification de son
+// adresse email.
+func SendVerification(c *gin.Context, db *sql.DB, userID, email string) error {
+	token, err := tokens.Issue(db, userID, tokens.VerifyEmail)
+	if err != nil {
+		return err
+	}
+
+	return c.MustGet("mailer").(mailer.Mailer).Send(mailer.Message{
+		To:      email,
+		Subject: "Confirmez votre adresse email",
+		Body: fmt.Sprintf("Bonjour,\n\nPour confirmer votre adresse email, ouvrez ce lien :\n%s\n\n"+
+			"Ce lien est valable %s.\n", appLink(c, "/verify-email", token), validity(tokens.VerifyEmail)),
+	})
+}
+
+// ResendVerification renvoie le lien de vérification à l'utilisateur connecté.
+func ResendVerification(users store.UserStore, db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := users.Get(c.GetString("userID"))
+		if err != nil {
+			logging.Errorf("ResendVerification - Erreur: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible d'envoyer l'email"})
+			return
+		}
+		if user.EmailVerifiedAt != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Adresse email déjà vérifiée"})
+			return
+		}
+
+		if err := SendVerification(c, db, user.ID, user.Email); err != nil {
+			logging.Errorf("ResendVerification - Erreur d'envoi: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible d'envoyer l'email"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Email de vérification envoyé"})
+	}
+}
+
+func VerifyEmail(users store.UserStore, db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Token string `json:"token" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userID, err := tokens.Consume(db, tokens.VerifyEmail, input.Token)
+		if err != nil {
+			tokenError(c, err)
+			return
+		}
+
+		if err := users.MarkEmailVerified(userID, time.Now().UTC()); err != nil {
+			logging.Errorf("VerifyEmail - Erreur: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de vérifier l'adresse"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Adresse email vérifiée"})
+	}
+}
+
+// ForgotPassword envoie un lien de réinitialisation si l'adresse correspond à
+// un compte. La réponse est la même dans tous les cas, y compris quand
+// l'envoi échoue, pour ne pas révéler quelles adresses sont inscrites.
+func ForgotPassword(users store.UserStore, db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Email string `json:"email" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := sendResetLink(c, users, db, input.Email); err != nil {
+			logging.Errorf("ForgotPassword - Erreur: %v", err)
+		}
+		c.JSON(http.StatusAccepted, gin.H{"message": "Si un compte correspond à cette adresse, un email a été envoyé"})
+	}
+}
+
+// sendResetLink envoie le lien de réinitialisation au compte d'adresse email,
+// s'il existe.
+func sendResetLink(c *gin.Context, users store.UserStore, db *sql.DB, email string) error {
+	user, err := users.FindByEmail(email)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := tokens.Issue(db, user.ID, tokens.ResetPassword)
+	if err != nil {
+		return err
+	}
+	return c.MustGet("mailer").(mailer.Mailer).Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Réinitialisation de votre mot de passe",
+		Body: fmt.Sprintf("Bonjour,\n\nPour choisir un nouveau mot de passe, ouvrez ce lien :\n%s\n\n"+
+			"Ce lien est valable %s et ne peut servir qu'une fois. "+
+			"Si vous n'êtes pas à l'origine de cette demande, ignorez cet email.\n",
+			appLink(c, "/reset-password", token), validity(tokens.ResetPassword)),
+	})
+}
+
+// ResetPassword remplace le mot de passe avec un token de réinitialisation et
+// ferme toutes les sessions du compte.
+func ResetPassword(users store.UserStore, db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Token       string `json:"token" binding:"required"`
+			NewPassword string `json:"newPassword" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userID, err := tokens.Consume(db, tokens.ResetPassword, input.Token)
+		if err != nil {
+			tokenError(c, err)
+			return
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			logging.Errorf("ResetPassword - Erreur de hashage: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de modifier le mot de passe"})
+			return
+		}
+		if err := users.UpdatePassword(userID, string(hashedPassword)); err != nil {
+			logging.Errorf("ResetPassword - Erreur: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de modifier le mot de passe"})
+			return
+		}
+		// Recevoir le lien prouve aussi la possession de l'adresse
+		if err := users.MarkEmailVerified(userID, time.Now().UTC()); err != nil {
+			logging.Errorf("ResetPassword - Erreur de vérification: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de modifier le mot de passe"})
+			return
+		}
+		if err := sessions.RevokeAll(db, userID); err != nil {
+			logging.Errorf("ResetPassword - Erreur de révocation: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de modifier le mot de passe"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Mot de passe modifié, vous pouvez vous reconnecter"})
+	}
+}
+
+// appLink construit un lien vers une page du frontend portant le token.
+func appLink(c *gin.Context, path, token string) string {
+	return c.GetString("appURL") + path + "?token=" + url.QueryEscape(token)
+}
+
+func validity(purpose string) string {
+	hours := int(tokens.TTL[purpose].Hours())
+	if hours == 1 {
+		return "1 heure"
+	}
+	return fmt.Sprintf("%d heures", hours)
+}
+
+func tokenError(c *gin.Context, err error) {
+	if errors.Is(err, tokens.ErrInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	logging.Errorf("Tokens - Erreur: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de vérifier le lien"})
+}
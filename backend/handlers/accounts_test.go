@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"carbone-app/config"
+	"carbone-app/mailer"
+	"carbone-app/migrations"
+	"carbone-app/models"
+	"carbone-app/store"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func openTestDB(t *testing.T) (*sql.DB, store.Stores) {
+	t.Helper()
+	cfg := config.Default().Database
+	cfg.Driver = config.DriverSQLite
+	cfg.DSN = filepath.Join(t.TempDir(), "handlers.db")
+	db, err := config.InitDB(cfg)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := migrations.Up(db, config.DriverSQLite); err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+	return db, store.NewSQLite(db)
+}
+
+type failingMailer struct{}
+
+func (failingMailer) Send(mailer.Message) error { return errors.New("serveur SMTP injoignable") }
+
+func forgotPassword(t *testing.T, handler gin.HandlerFunc, m mailer.Mailer, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/password/forgot", func(c *gin.Context) {
+		c.Set("mailer", m)
+		c.Set("appURL", "http://app.test")
+	}, handler)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/password/forgot", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestForgotPassword(t *testing.T) {
+	db, stores := openTestDB(t)
+	user := models.User{Email: "Alice@Example.com", Username: "alice", Password: "hash", Role: models.RoleUser}
+	if err := stores.Users.Create(&user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	handler := ForgotPassword(stores.Users, db)
+
+	t.Run("compte existant, casse différente", func(t *testing.T) {
+		m := mailer.NewMemory()
+		w := forgotPassword(t, handler, m, `{"email": "alice@example.COM"}`)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, attendu 202", w.Code)
+		}
+		msg, ok := m.Last(user.Email)
+		if !ok {
+			t.Fatalf("aucun email envoyé à %s: %v", user.Email, m.Messages())
+		}
+		if !strings.Contains(msg.Body, "http://app.test/reset-password?token=") {
+			t.Errorf("lien de réinitialisation absent: %q", msg.Body)
+		}
+	})
+
+	t.Run("compte inconnu", func(t *testing.T) {
+		m := mailer.NewMemory()
+		w := forgotPassword(t, handler, m, `{"email": "personne@example.com"}`)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, attendu 202", w.Code)
+		}
+		if n := len(m.Messages()); n != 0 {
+			t.Errorf("%d emails envoyés, attendu aucun", n)
+		}
+	})
+
+	t.Run("échec de l'envoi", func(t *testing.T) {
+		known := forgotPassword(t, handler, failingMailer{}, `{"email": "alice@example.com"}`)
+		unknown := forgotPassword(t, handler, failingMailer{}, `{"email": "personne@example.com"}`)
+		if known.Code != http.StatusAccepted || known.Body.String() != unknown.Body.String() {
+			t.Errorf("réponses différentes: %d %s / %d %s", known.Code, known.Body, unknown.Code, unknown.Body)
+		}
+	})
+}
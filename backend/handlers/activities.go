@@ -1,34 +1,276 @@
 package handlers
 
 import (
+	"carbone-app/factorsets"
+	"carbone-app/logging"
 	"carbone-app/models"
+	"carbone-app/store"
+	"database/sql"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func GetActivities(c *gin.Context) {
-	var activities []models.Activity
-	// TODO: Implémenter la logique de récupération depuis la base de données
+type activityInput struct {
+	ActivityID string  `json:"activityId" binding:"required"`
+	Quantity   float64 `json:"quantity"`
+	Date       string  `json:"date"` // Format: "2024-01-31", aujourd'hui par défaut
+}
+
+// GetActivityFactors renvoie le catalogue des activités avec les valeurs du
+// jeu de facteurs en vigueur, dont la version est dans X-Factor-Set-Version.
+func GetActivityFactors(activities store.ActivityStore, db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		factors, err := activities.Factors()
+		if err != nil {
+			logging.Errorf("GetActivityFactors - Erreur: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de récupérer les facteurs"})
+			return
+		}
+
+		set, values, err := factorsets.Load(db, time.Now())
+		if err != nil {
+			logging.Errorf("GetActivityFactors - Erreur du jeu de facteurs: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Facteurs d'émission indisponibles"})
+			return
+		}
+		for i := range factors {
+			factors[i].CarbonFactor = values[factors[i].Factor]
+		}
+
+		c.Header("X-Factor-Set-Version", set.Version)
+		c.JSON(http.StatusOK, factors)
+	}
+}
+
+func GetActivities(activities store.ActivityStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, ok := dateRange(c)
+		if !ok {
+			return
+		}
+
+		list, err := activities.List(c.GetString("userID"), from, to)
+		if err != nil {
+			logging.Errorf("GetActivities - Erreur: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de récupérer les activités"})
+			return
+		}
+
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+func GetActivity(activities store.ActivityStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		activity, ok := findActivity(c, activities)
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusOK, activity)
+	}
+}
+
+func CreateActivity(activities store.ActivityStore, db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input activityInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		activity, ok := buildActivity(c, activities, db, input)
+		if !ok {
+			return
+		}
+
+		if err := activities.Create(&activity); err != nil {
+			logging.Errorf("CreateActivity - Erreur d'insertion: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible d'enregistrer l'activité"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, activity)
+	}
+}
+
+func UpdateActivity(activities store.ActivityStore, db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input activityInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		existing, ok := findActivity(c, activities)
+		if !ok {
+			return
+		}
+
+		activity, ok := buildActivity(c, activities, db, input)
+		if !ok {
+			return
+		}
+		activity.ID = existing.ID
+		activity.CreatedAt = existing.CreatedAt
+
+		if err := activities.Update(activity); err != nil {
+			logging.Errorf("UpdateActivity - Erreur de mise à jour: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de modifier l'activité"})
+			return
+		}
+
+		c.JSON(http.StatusOK, activity)
+	}
+}
 
-	c.JSON(http.StatusOK, activities)
+func DeleteActivity(activities store.ActivityStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		activity, ok := findActivity(c, activities)
+		if !ok {
+			return
+		}
+
+		if err := activities.Delete(activity.UserID, activity.ID); err != nil {
+			logging.Errorf("DeleteActivity - Erreur de suppression: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de supprimer l'activité"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Activité supprimée"})
+	}
+}
+
+// GetCarbonTotal somme les émissions des activités de l'utilisateur, sur la
+// période ?from=&to= si elle est précisée.
+func GetCarbonTotal(activities store.ActivityStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, ok := dateRange(c)
+		if !ok {
+			return
+		}
+
+		total, count, err := activities.Total(c.GetString("userID"), from, to)
+		if err != nil {
+			logging.Errorf("GetCarbonTotal - Erreur: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de calculer le total"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"total": total,
+			"count": count,
+			"from":  from,
+			"to":    to,
+		})
+	}
+}
+
+// findActivity charge l'activité :id de l'utilisateur courant et répond 404
+// si elle n'existe pas ou appartient à un autre utilisateur.
+func findActivity(c *gin.Context, activities store.ActivityStore) (models.Activity, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Activité introuvable"})
+		return models.Activity{}, false
+	}
+
+	activity, err := activities.Get(c.GetString("userID"), uint(id))
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Activité introuvable"})
+		return activity, false
+	}
+	if err != nil {
+		logging.Errorf("Activités - Erreur de lecture: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de récupérer l'activité"})
+		return activity, false
+	}
+	return activity, true
 }
 
-func CreateActivity(c *gin.Context) {
-	var activity models.Activity
-	if err := c.ShouldBindJSON(&activity); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+// buildActivity valide une saisie et calcule son empreinte avec le facteur
+// référencé par le catalogue, pris dans le jeu valide à la date de
+// l'activité.
+func buildActivity(c *gin.Context, activities store.ActivityStore, db *sql.DB, input activityInput) (models.Activity, bool) {
+	activity := models.Activity{
+		UserID:     c.GetString("userID"),
+		ActivityID: input.ActivityID,
+		Quantity:   input.Quantity,
+		CreatedAt:  time.Now().UTC(),
 	}
 
-	// TODO: Implémenter la logique de sauvegarde en base de données
+	if input.Quantity < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "La quantité doit être positive"})
+		return activity, false
+	}
+
+	today := time.Now().UTC()
+	activity.Date = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	if input.Date != "" {
+		date, err := time.Parse("2006-01-02", input.Date)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Format de date invalide"})
+			return activity, false
+		}
+		activity.Date = date
+	}
+
+	entry, err := activities.Factor(input.ActivityID)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Activité inconnue"})
+		return activity, false
+	}
+	if err != nil {
+		logging.Errorf("Activités - Erreur de lecture du catalogue: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de calculer l'empreinte"})
+		return activity, false
+	}
+
+	set, factors, err := factorsets.Load(db, activity.Date)
+	if err != nil {
+		logging.Errorf("Activités - Erreur du jeu de facteurs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Facteurs d'émission indisponibles"})
+		return activity, false
+	}
+	factor, ok := factors[entry.Factor]
+	if !ok {
+		logging.Errorf("Activités - Facteur %s absent du jeu %s", entry.Factor, set.Version)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Facteurs d'émission indisponibles"})
+		return activity, false
+	}
 
-	c.JSON(http.StatusCreated, activity)
+	activity.CarbonAmount = input.Quantity * factor
+	activity.FactorSetID = &set.ID
+	return activity, true
 }
 
-func GetCarbonTotal(c *gin.Context) {
-	// TODO: Implémenter le calcul du total carbone
-	total := 0.0
+// dateRange lit les paramètres optionnels ?from=&to= (format "2024-01-31").
+func dateRange(c *gin.Context) (*time.Time, *time.Time, bool) {
+	from, err := dateParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format de date invalide pour from"})
+		return nil, nil, false
+	}
+	to, err := dateParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format de date invalide pour to"})
+		return nil, nil, false
+	}
+	return from, to, true
+}
 
-	c.JSON(http.StatusOK, gin.H{"total": total})
+func dateParam(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	return &date, nil
 }
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"carbone-app/factorsets"
+	"carbone-app/logging"
+	"carbone-app/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ListFactorSets(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sets, err := factorsets.List(db)
+		if err != nil {
+			logging.Errorf("ListFactorSets - Erreur: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de récupérer les jeux de facteurs"})
+			return
+		}
+
+		c.JSON(http.StatusOK, sets)
+	}
+}
+
+func GetFactorSet(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		set, err := factorsets.Get(db, c.Param("id"))
+		if err != nil {
+			factorSetError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, set)
+	}
+}
+
+func CreateFactorSet(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Version   string          `json:"version" binding:"required"`
+			Source    string          `json:"source" binding:"required"`
+			ValidFrom string          `json:"validFrom" binding:"required"` // Format: "2024-01-01"
+			ValidTo   string          `json:"validTo"`
+			Factors   json.RawMessage `json:"factors" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		set := models.FactorSet{
+			Version: input.Version,
+			Source:  input.Source,
+			Factors: input.Factors,
+		}
+
+		validFrom, err := time.Parse("2006-01-02", input.ValidFrom)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Format de validFrom invalide"})
+			return
+		}
+		set.ValidFrom = validFrom
+
+		if input.ValidTo != "" {
+			validTo, err := time.Parse("2006-01-02", input.ValidTo)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Format de validTo invalide"})
+				return
+			}
+			set.ValidTo = &validTo
+		}
+
+		if err := factorsets.Create(db, &set); err != nil {
+			factorSetError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, set)
+	}
+}
+
+// DiffFactorSet compare un jeu à celui passé dans ?against=, ou à défaut au
+// jeu publié en vigueur à sa date de début.
+func DiffFactorSet(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		set, err := factorsets.Get(db, c.Param("id"))
+		if err != nil {
+			factorSetError(c, err)
+			return
+		}
+
+		var base models.FactorSet
+		if against := c.Query("against"); against != "" {
+			base, err = factorsets.Get(db, against)
+		} else {
+			base, err = factorsets.ForMonth(db, set.ValidFrom)
+		}
+		if err != nil {
+			factorSetError(c, err)
+			return
+		}
+
+		changes, err := factorsets.Diff(base, set)
+		if err != nil {
+			logging.Errorf("DiffFactorSet - Erreur: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de comparer les jeux de facteurs"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"from":    base.ID,
+			"to":      set.ID,
+			"changes": changes,
+		})
+	}
+}
+
+func PublishFactorSet(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		set, err := factorsets.Publish(db, c.Param("id"))
+		if err != nil {
+			factorSetError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, set)
+	}
+}
+
+func factorSetError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, factorsets.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, factorsets.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, factorsets.ErrPublished), errors.Is(err, factorsets.ErrOverlap),
+		errors.Is(err, factorsets.ErrBackdated):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		logging.Errorf("Jeux de facteurs - Erreur: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur sur les jeux de facteurs"})
+	}
+}
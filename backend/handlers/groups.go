@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"carbone-app/groups"
+	"carbone-app/logging"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateGroup crée un atelier dont le facilitateur devient le créateur.
+func CreateGroup(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Name        string `json:"name" binding:"required,max=100"`
+			Description string `json:"description"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		name := strings.TrimSpace(input.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Le nom du groupe est requis"})
+			return
+		}
+
+		group, err := groups.Create(db, c.GetString("userID"), name, strings.TrimSpace(input.Description))
+		if err != nil {
+			groupError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"group": group, "inviteLink": inviteLink(c, group.InviteCode)})
+	}
+}
+
+// ListGroups liste les groupes de l'utilisateur, avec son rôle et son
+// consentement dans chacun.
+func ListGroups(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := groups.List(db, c.GetString("userID"))
+		if err != nil {
+			groupError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// GetGroup renvoie un groupe de l'utilisateur. Les facilitateurs du groupe
+// reçoivent aussi le lien d'invitation et la liste des membres.
+func GetGroup(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group, err := groups.Get(db, c.Param("id"), c.GetString("userID"))
+		if err != nil {
+			groupError(c, err)
+			return
+		}
+		if !groups.HasRole(group.Role, groups.RoleFacilitator) {
+			c.JSON(http.StatusOK, gin.H{"group": group})
+			return
+		}
+
+		members, err := groups.Members(db, group.ID)
+		if err != nil {
+			groupError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"group": group, "inviteLink": inviteLink(c, group.InviteCode), "members": members})
+	}
+}
+
+// JoinGroup ajoute l'utilisateur au groupe du code d'invitation. Ses
+// résultats ne sont partagés qu'après SetGroupConsent.
+func JoinGroup(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Code string `json:"code" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		group, err := groups.Join(db, c.GetString("userID"), input.Code)
+		if err != nil {
+			groupError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"group": group})
+	}
+}
+
+// SetGroupConsent donne ({"consent": true}) ou retire ({"consent": false}) le
+// consentement au partage des résultats avec les facilitateurs du groupe.
+func SetGroupConsent(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Consent *bool `json:"consent" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		group, ok := groupMembership(c, db, groups.RoleMember)
+		if !ok {
+			return
+		}
+		if err := groups.SetConsent(db, group.ID, c.GetString("userID"), *input.Consent); err != nil {
+			groupError(c, err)
+			return
+		}
+
+		message := "Consentement retiré"
+		if *input.Consent {
+			message = "Consentement enregistré"
+		}
+		c.JSON(http.StatusOK, gin.H{"message": message})
+	}
+}
+
+func LeaveGroup(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group, ok := groupMembership(c, db, groups.RoleMember)
+		if !ok {
+			return
+		}
+		if err := groups.RemoveMember(db, group.ID, c.GetString("userID")); err != nil {
+			groupError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Vous avez quitté le groupe"})
+	}
+}
+
+// RegenerateGroupCode invalide le code d'invitation et en renvoie un nouveau.
+func RegenerateGroupCode(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group, ok := groupMembership(c, db, groups.RoleFacilitator)
+		if !ok {
+			return
+		}
+		code, err := groups.RegenerateCode(db, group.ID)
+		if err != nil {
+			groupError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"inviteCode": code, "inviteLink": inviteLink(c, code)})
+	}
+}
+
+// UpdateGroupMemberRole nomme un membre facilitateur du groupe, ou l'inverse.
+// Réservé au créateur du groupe.
+func UpdateGroupMemberRole(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Role string `json:"role" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !groups.ValidRole(input.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Rôle inconnu (member ou facilitator)"})
+			return
+		}
+
+		group, ok := groupMembership(c, db, groups.RoleOwner)
+		if !ok {
+			return
+		}
+		if err := groups.SetRole(db, group.ID, c.Param("userId"), input.Role); err != nil {
+			groupError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Rôle mis à jour"})
+	}
+}
+
+// RemoveGroupMember retire un membre du groupe. Seul le créateur peut
+// retirer un autre facilitateur.
+func RemoveGroupMember(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group, ok := groupMembership(c, db, groups.RoleFacilitator)
+		if !ok {
+			return
+		}
+		memberID := c.Param("userId")
+		if group.Role != groups.RoleOwner {
+			role, err := groups.MemberRole(db, group.ID, memberID)
+			if err != nil {
+				groupError(c, err)
+				return
+			}
+			if groups.HasRole(role, groups.RoleFacilitator) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Seul le créateur du groupe peut retirer un facilitateur"})
+				return
+			}
+		}
+		if err := groups.RemoveMember(db, group.ID, memberID); err != nil {
+			groupError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Membre retiré"})
+	}
+}
+
+func DeleteGroup(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group, ok := groupMembership(c, db, groups.RoleOwner)
+		if !ok {
+			return
+		}
+		if err := groups.Delete(db, group.ID); err != nil {
+			groupError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Groupe supprimé"})
+	}
+}
+
+// GetGroupResults renvoie aux facilitateurs du groupe les résultats anonymisés
+// des membres consentants entre ?from= et ?to= (format "2024-01", les 12
+// derniers mois par défaut) : agrégats par mois et catégorie et détail par
+// participant.
+func GetGroupResults(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group, ok := groupMembership(c, db, groups.RoleFacilitator)
+		if !ok {
+			return
+		}
+
+		now := time.Now().UTC()
+		to := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		if value := c.Query("to"); value != "" {
+			parsed, err := time.Parse("2006-01", value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Format de mois invalide pour to"})
+				return
+			}
+			to = parsed
+		}
+		from := to.AddDate(0, -11, 0)
+		if value := c.Query("from"); value != "" {
+			parsed, err := time.Parse("2006-01", value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Format de mois invalide pour from"})
+				return
+			}
+			from = parsed
+		}
+		if from.After(to) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from doit précéder to"})
+			return
+		}
+
+		report, err := groups.Results(db, group.ID, from, to)
+		if err != nil {
+			groupError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// groupMembership charge le groupe de l'URL et vérifie que l'utilisateur y a
+// au moins le rôle required. Un groupe dont il n'est pas membre est
+// introuvable, pour ne pas révéler son existence.
+func groupMembership(c *gin.Context, db *sql.DB, required string) (groups.Group, bool) {
+	group, err := groups.Get(db, c.Param("id"), c.GetString("userID"))
+	if err != nil {
+		groupError(c, err)
+		return group, false
+	}
+	if !groups.HasRole(group.Role, required) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Droits insuffisants dans ce groupe"})
+		return group, false
+	}
+	return group, true
+}
+
+func inviteLink(c *gin.Context, code string) string {
+	return c.GetString("appURL") + "/groups?code=" + url.QueryEscape(code)
+}
+
+func groupError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, groups.ErrNotFound), errors.Is(err, groups.ErrMemberNotFound), errors.Is(err, groups.ErrInvalidCode):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, groups.ErrAlreadyMember):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, groups.ErrOwner):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		logging.Errorf("Groupes - Erreur: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur des groupes"})
+	}
+}
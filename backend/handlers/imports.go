@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"carbone-app/calculator"
+	"carbone-app/factorsets"
+	"carbone-app/importer"
+	"carbone-app/logging"
+	"carbone-app/models"
+	"carbone-app/store"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Taille maximale d'un fichier importé
+const maxImportSize = 5 << 20
+
+// ImportResults importe des résultats mensuels depuis un fichier CSV ou XLSX
+// envoyé dans le champ file d'un formulaire multipart. Le format est déduit de
+// l'extension ou forcé par ?format=csv|xlsx. Les valeurs sont recalculées
+// avec le jeu de facteurs de chaque mois et les résultats existants pour le
+// même mois et la même catégorie sont remplacés.
+//
+// Avec ?dryRun=true, rien n'est enregistré : la réponse détaille ligne par
+// ligne les erreurs, la valeur calculée et l'action prévue. Sinon, le fichier
+// n'est importé que si toutes les lignes sont valides, en une transaction.
+func ImportResults(results store.ResultStore, db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dryRun, err := strconv.ParseBool(c.DefaultQuery("dryRun", "false"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "dryRun invalide"})
+			return
+		}
+
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Fichier requis (champ file)"})
+			return
+		}
+		if header.Size > maxImportSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Fichier trop volumineux (5 Mo maximum)"})
+			return
+		}
+		format := c.Query("format")
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			logging.Errorf("ImportResults - Erreur d'ouverture: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Fichier illisible"})
+			return
+		}
+		defer file.Close()
+
+		var records [][]string
+		switch format {
+		case "csv":
+			records, err = importer.ReadCSV(file)
+		case "xlsx":
+			records, err = importer.ReadXLSX(file)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Format non pris en charge (csv ou xlsx)"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Fichier illisible: " + err.Error()})
+			return
+		}
+
+		rows, err := importer.Parse(records)
+		var headerErr *importer.HeaderError
+		if errors.As(err, &headerErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "columns": headerErr})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userID := c.GetString("userID")
+
+		report, computed, err := planImport(db, results, userID, rows)
+		if err != nil {
+			logging.Errorf("ImportResults - Erreur de calcul: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de calculer les résultats"})
+			return
+		}
+		report.DryRun = dryRun
+
+		if dryRun {
+			c.JSON(http.StatusOK, report)
+			return
+		}
+		if report.Summary.Invalid > 0 {
+			c.JSON(http.StatusUnprocessableEntity, report)
+			return
+		}
+
+		if err := commitImport(results, userID, computed); err != nil {
+			logging.Errorf("ImportResults - Erreur d'enregistrement: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'import"})
+			return
+		}
+		report.Committed = true
+		logging.Infof("ImportResults - %d résultat(s) importé(s) pour %s", report.Summary.Valid, userID)
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// importedResult est un résultat recalculé, prêt à être enregistré.
+type importedResult struct {
+	row         importer.Row
+	factorSetID string
+	result      calculator.Result
+}
+
+// planImport recalcule chaque ligne valide avec le jeu de facteurs de son
+// mois et détermine si elle crée ou remplace un résultat.
+func planImport(db *sql.DB, results store.ResultStore, userID string, rows []importer.Row) (importer.Report, []importedResult, error) {
+	report := importer.Report{Rows: []importer.RowReport{}}
+	report.Summary.Rows = len(rows)
+
+	saved, err := results.List(userID)
+	if err != nil {
+		return report, nil, err
+	}
+	existing := map[string]bool{}
+	for _, result := range saved {
+		existing[result.Category+"|"+result.Month.Format("2006-01")] = true
+	}
+
+	type monthFactors struct {
+		setID   string
+		factors calculator.Factors
+	}
+	factorsByMonth := map[time.Time]monthFactors{}
+
+	var computed []importedResult
+	for _, row := range rows {
+		entry := importer.RowReport{Row: row}
+		if len(row.Errors) > 0 {
+			entry.Action = importer.ActionInvalid
+			report.Summary.Invalid++
+			report.Rows = append(report.Rows, entry)
+			continue
+		}
+
+		month := row.MonthDate()
+		mf, ok := factorsByMonth[month]
+		if !ok {
+			set, err := factorsets.ForMonth(db, month)
+			if err != nil {
+				return report, nil, err
+			}
+			factors, err := factorsets.Factors(set)
+			if err != nil {
+				return report, nil, err
+			}
+			mf = monthFactors{set.ID, factors}
+			factorsByMonth[month] = mf
+		}
+
+		result, err := calculator.Compute(row.Category, row.Inputs, mf.factors)
+		if err != nil {
+			return report, nil, err
+		}
+		entry.Value = &result.Value
+		if existing[row.Category+"|"+row.Month] {
+			entry.Action = importer.ActionUpdate
+			report.Summary.Updated++
+		} else {
+			entry.Action = importer.ActionCreate
+			report.Summary.Created++
+		}
+		report.Summary.Valid++
+		report.Rows = append(report.Rows, entry)
+		computed = append(computed, importedResult{row, mf.setID, result})
+	}
+	return report, computed, nil
+}
+
+func commitImport(results store.ResultStore, userID string, imported []importedResult) error {
+	now := time.Now().UTC()
+	batch := make([]models.Result, 0, len(imported))
+	for _, r := range imported {
+		inputsJSON, err := json.Marshal(r.row.Inputs)
+		if err != nil {
+			return err
+		}
+		breakdownJSON, err := json.Marshal(r.result.Lines)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, models.Result{
+			UserID:      userID,
+			Category:    r.row.Category,
+			Value:       r.result.Value,
+			Inputs:      inputsJSON,
+			Month:       r.row.MonthDate(),
+			CreatedAt:   now,
+			FactorSetID: &r.factorSetID,
+			Breakdown:   breakdownJSON,
+		})
+	}
+	return results.UpsertMany(batch, store.Change{By: userID, Source: store.SourceImport})
+}
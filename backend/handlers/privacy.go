@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"carbone-app/logging"
+	"carbone-app/privacy"
+	"carbone-app/sessions"
+	"carbone-app/store"
+	"carbone-app/twofactor"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportUserData renvoie toutes les données de l'utilisateur : une archive
+// zip (JSON et CSV) par défaut, ou le seul JSON avec ?format=json.
+func ExportUserData(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format := c.DefaultQuery("format", "zip")
+		if format != "zip" && format != "json" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Format invalide (zip ou json)"})
+			return
+		}
+
+		archive, err := privacy.Export(db, c.GetString("userID"))
+		if err != nil {
+			logging.Errorf("ExportUserData - Erreur: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible d'exporter les données"})
+			return
+		}
+
+		filename := "carbone-export-" + archive.ExportedAt.Format("2006-01-02")
+		if format == "json" {
+			c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, filename))
+			c.JSON(http.StatusOK, archive)
+			return
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, filename))
+		c.Header("Content-Type", "application/zip")
+		c.Status(http.StatusOK)
+		if err := archive.WriteZip(c.Writer); err != nil {
+			// Les en-têtes sont déjà partis : l'archive sera tronquée
+			logging.Errorf("ExportUserData - Erreur d'écriture: %v", err)
+		}
+	}
+}
+
+// DeleteAccount supprime le compte de l'utilisateur après vérification du
+// mot de passe, et du code de double authentification si elle est active.
+// Avec un délai de grâce gracePeriod, la suppression est programmée et toutes
+// les sessions sont fermées ; se reconnecter avant l'échéance l'annule.
+func DeleteAccount(users store.UserStore, db *sql.DB, gracePeriod time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Password string `json:"password" binding:"required"`
+			Code     string `json:"code"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userID := c.GetString("userID")
+		if !checkPassword(c, users, userID, input.Password) {
+			return
+		}
+		enabled, err := twofactor.Enabled(db, userID)
+		if err != nil {
+			twoFactorError(c, err)
+			return
+		}
+		if enabled {
+			if input.Code == "" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Code de double authentification requis", "twoFactorRequired": true})
+				return
+			}
+			if err := twofactor.Check(db, userID, input.Code); err != nil {
+				twoFactorError(c, err)
+				return
+			}
+		}
+
+		scheduledAt, err := privacy.RequestDeletion(db, userID, time.Now().UTC(), gracePeriod)
+		if errors.Is(err, privacy.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			logging.Errorf("DeleteAccount - Erreur: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de supprimer le compte"})
+			return
+		}
+
+		if scheduledAt.IsZero() {
+			logging.Infof("Compte %s supprimé à la demande de l'utilisateur", userID)
+			c.JSON(http.StatusOK, gin.H{"message": "Compte supprimé"})
+			return
+		}
+
+		if err := sessions.RevokeAll(db, userID); err != nil {
+			logging.Errorf("DeleteAccount - Erreur de révocation des sessions: %v", err)
+		}
+		logging.Infof("Suppression du compte %s programmée pour le %s", userID, scheduledAt.Format(time.RFC3339))
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":             "Suppression programmée ; reconnectez-vous avant l'échéance pour l'annuler",
+			"deletionScheduledAt": scheduledAt,
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"carbone-app/calculator"
+	"carbone-app/factorsets"
+	"carbone-app/logging"
+	"carbone-app/recommendations"
+	"carbone-app/store"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetRecommendations évalue les règles sur les résultats du mois ?month=
+// (mois courant par défaut). Les réductions sont estimées avec le jeu de
+// facteurs actuellement en vigueur.
+func GetRecommendations(results store.ResultStore, db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+
+		month := time.Now()
+		if value := c.Query("month"); value != "" {
+			parsed, err := time.Parse("2006-01", value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Format de mois invalide"})
+				return
+			}
+			month = parsed
+		}
+		month = time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+		saved, err := results.Find(userID, store.ResultQuery{From: &month, To: &month})
+		if err != nil {
+			logging.Errorf("GetRecommendations - Erreur des résultats: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de calculer les recommandations"})
+			return
+		}
+
+		data := map[string]recommendations.CategoryData{}
+		for _, result := range saved {
+			entry := recommendations.CategoryData{Value: result.Value}
+			if len(result.Inputs) > 0 {
+				if err := json.Unmarshal(result.Inputs, &entry.Inputs); err != nil {
+					logging.Warnf("GetRecommendations - Entrées illisibles pour %s: %v", result.Category, err)
+				}
+			}
+			data[result.Category] = entry
+		}
+
+		set, err := factorsets.ForMonth(db, time.Now())
+		if err != nil {
+			logging.Errorf("GetRecommendations - Erreur des facteurs: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Facteurs d'émission indisponibles"})
+			return
+		}
+		factors, err := factorsets.Factors(set)
+		if err != nil {
+			logging.Errorf("GetRecommendations - Facteurs illisibles: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Facteurs d'émission indisponibles"})
+			return
+		}
+
+		rules, err := recommendations.ListRules(db, true)
+		if err != nil {
+			logging.Errorf("GetRecommendations - Erreur des règles: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de calculer les recommandations"})
+			return
+		}
+		thresholds, err := recommendations.Thresholds(db)
+		if err != nil {
+			logging.Errorf("GetRecommendations - Erreur des seuils: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de calculer les recommandations"})
+			return
+		}
+
+		report := recommendations.Evaluate(rules, thresholds, data, factors)
+		c.JSON(http.StatusOK, gin.H{
+			"month":           month.Format("2006-01"),
+			"factorSet":       gin.H{"id": set.ID, "version": set.Version},
+			"categories":      report.Categories,
+			"recommendations": report.Recommendations,
+		})
+	}
+}
+
+func ListRecommendationRules(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rules, err := recommendations.ListRules(db, false)
+		if err != nil {
+			logging.Errorf("ListRecommendationRules - Erreur: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de récupérer les règles"})
+			return
+		}
+
+		c.JSON(http.StatusOK, rules)
+	}
+}
+
+func CreateRecommendationRule(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rule, ok := bindRule(c)
+		if !ok {
+			return
+		}
+
+		if err := recommendations.CreateRule(db, &rule); err != nil {
+			logging.Errorf("CreateRecommendationRule - Erreur: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de créer la règle"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, rule)
+	}
+}
+
+func UpdateRecommendationRule(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rule, ok := bindRule(c)
+		if !ok {
+			return
+		}
+		rule.ID = c.Param("id")
+
+		if _, err := recommendations.GetRule(db, rule.ID); err != nil {
+			recommendationError(c, err)
+			return
+		}
+		if err := recommendations.UpdateRule(db, rule); err != nil {
+			recommendationError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+func DeleteRecommendationRule(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := recommendations.DeleteRule(db, c.Param("id")); err != nil {
+			recommendationError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Règle supprimée"})
+	}
+}
+
+func SetRecommendationThreshold(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Threshold float64 `json:"threshold"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		category := c.Param("category")
+		if _, ok := calculator.Lookup(category); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Catégorie inconnue"})
+			return
+		}
+		if input.Threshold < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Le seuil doit être positif"})
+			return
+		}
+
+		if err := recommendations.SetThreshold(db, category, input.Threshold); err != nil {
+			logging.Errorf("SetRecommendationThreshold - Erreur: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible d'enregistrer le seuil"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"category": category, "threshold": input.Threshold})
+	}
+}
+
+func bindRule(c *gin.Context) (recommendations.Rule, bool) {
+	var rule recommendations.Rule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return rule, false
+	}
+	if rule.Name == "" || rule.Condition.Type == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name et condition.type sont requis"})
+		return rule, false
+	}
+	if err := recommendations.ValidateCondition(rule.Condition); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return rule, false
+	}
+	if _, ok := calculator.Lookup(rule.Category); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Catégorie inconnue"})
+		return rule, false
+	}
+	return rule, true
+}
+
+func recommendationError(c *gin.Context, err error) {
+	if errors.Is(err, recommendations.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	logging.Errorf("Règles de recommandation - Erreur: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur sur les règles de recommandation"})
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCreateRecommendationRuleValidatesCondition(t *testing.T) {
+	db, _ := openTestDB(t)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/rules", CreateRecommendationRule(db))
+
+	cases := map[string]struct {
+		condition string
+		want      int
+	}{
+		"type inconnu":            {`{"type": "below_threshold"}`, http.StatusBadRequest},
+		"sous-condition inconnue": {`{"type": "all", "conditions": [{"type": "above_threshold"}, {"type": "any"}]}`, http.StatusBadRequest},
+		"all vide":                {`{"type": "all"}`, http.StatusBadRequest},
+		"valide":                  {`{"type": "all", "conditions": [{"type": "input_above", "input": "flightKm", "value": 500}]}`, http.StatusCreated},
+	}
+	for name, c := range cases {
+		body := `{"name": "Avion", "category": "Transports", "active": true, "condition": ` + c.condition + `}`
+		req := httptest.NewRequest(http.MethodPost, "/rules", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != c.want {
+			t.Errorf("%s: status %d (%s), attendu %d", name, w.Code, w.Body, c.want)
+		}
+	}
+}
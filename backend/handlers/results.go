@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"carbone-app/logging"
+	"carbone-app/models"
+	"carbone-app/store"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ResultETag identifie la révision d'un résultat, pour les requêtes
+// conditionnelles.
+func ResultETag(result models.Result) string {
+	return fmt.Sprintf(`"%d"`, result.Revision)
+}
+
+// IfMatch lit la révision attendue dans l'en-tête If-Match, obligatoire pour
+// modifier, restaurer ou supprimer un résultat : "*" accepte toute révision
+// (0). En cas d'échec, la réponse est déjà envoyée.
+func IfMatch(c *gin.Context) (int, bool) {
+	if strings.TrimSpace(c.GetHeader("If-Match")) == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "En-tête If-Match requis, rechargez le résultat pour obtenir son ETag"})
+		return 0, false
+	}
+	return OptionalIfMatch(c)
+}
+
+// OptionalIfMatch lit la révision attendue dans l'en-tête If-Match : 0 si
+// l'en-tête est absent ou vaut "*". Une valeur illisible ne correspond à
+// aucune révision.
+func OptionalIfMatch(c *gin.Context) (int, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return 0, true
+	}
+	revision, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(header, "W/"), `"`))
+	if err != nil || revision < 1 {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "En-tête If-Match invalide"})
+		return 0, false
+	}
+	return revision, true
+}
+
+// GetResultHistory renvoie un résultat et ses révisions, de la plus récente
+// à la plus ancienne.
+func GetResultHistory(results store.ResultStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+		id := c.Param("id")
+
+		result, err := results.Get(userID, id)
+		if err == nil {
+			revisions, historyErr := results.History(userID, id)
+			if historyErr == nil {
+				c.Header("ETag", ResultETag(result))
+				c.JSON(http.StatusOK, gin.H{"result": result, "revisions": revisions})
+				return
+			}
+			err = historyErr
+		}
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Résultat introuvable"})
+			return
+		}
+		logging.Errorf("GetResultHistory - Erreur: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de récupérer l'historique"})
+	}
+}
+
+// RestoreResult rétablit les valeurs d'une révision antérieure. La
+// restauration crée une nouvelle révision : l'historique n'est jamais réécrit.
+// Comme une modification, elle est refusée si le résultat a changé depuis la
+// révision de l'en-tête If-Match.
+func RestoreResult(results store.ResultStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		expected, ok := IfMatch(c)
+		if !ok {
+			return
+		}
+
+		var input struct {
+			Revision int `json:"revision" binding:"required,min=1"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Numéro de révision requis"})
+			return
+		}
+
+		userID := c.GetString("userID")
+		result, err := results.Restore(userID, c.Param("id"), input.Revision, expected, userID)
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Résultat ou révision introuvable"})
+			return
+		}
+		if errors.Is(err, store.ErrConflict) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Le résultat a été modifié entre-temps, rechargez-le avant de réessayer"})
+			return
+		}
+		if err != nil {
+			logging.Errorf("RestoreResult - Erreur: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de restaurer le résultat"})
+			return
+		}
+
+		c.Header("ETag", ResultETag(result))
+		c.JSON(http.StatusOK, gin.H{"result": result, "restoredFrom": input.Revision})
+	}
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"carbone-app/factorsets"
+	"carbone-app/logging"
+	"carbone-app/scenarios"
+	"carbone-app/store"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateScenario simule des surcharges d'entrées sur un mois enregistré
+// (month) ou sur des entrées explicites (inputs), qui complètent le mois si
+// les deux sont fournis. Le scénario n'est conservé que si save est vrai.
+func CreateScenario(results store.ResultStore, db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Name      string           `json:"name"`
+			Month     string           `json:"month"` // Format: "2024-01"
+			Inputs    scenarios.Inputs `json:"inputs"`
+			Overrides scenarios.Inputs `json:"overrides"`
+			Save      bool             `json:"save"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if input.Month == "" && len(input.Inputs) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "month ou inputs est requis"})
+			return
+		}
+
+		userID := c.GetString("userID")
+
+		month := time.Now()
+		var baseMonth *time.Time
+		base := scenarios.Inputs{}
+		if input.Month != "" {
+			parsed, err := time.Parse("2006-01", input.Month)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Format de mois invalide"})
+				return
+			}
+			month = parsed
+			baseMonth = &parsed
+
+			saved, err := monthInputs(results, userID, parsed)
+			if err != nil {
+				logging.Errorf("CreateScenario - Erreur des résultats: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de charger le mois"})
+				return
+			}
+			base = saved
+		}
+		base = scenarios.Apply(base, input.Inputs)
+
+		scenarioInputs := scenarios.Apply(base, input.Overrides)
+		if errs := scenarios.Validate(scenarioInputs); len(errs) > 0 {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Entrées invalides", "fields": errs})
+			return
+		}
+
+		set, err := factorsets.ForMonth(db, month)
+		if err != nil {
+			logging.Errorf("CreateScenario - Erreur des facteurs: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Facteurs d'émission indisponibles"})
+			return
+		}
+		factors, err := factorsets.Factors(set)
+		if err != nil {
+			logging.Errorf("CreateScenario - Facteurs illisibles: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Facteurs d'émission indisponibles"})
+			return
+		}
+
+		outcome, err := scenarios.Run(base, input.Overrides, factors)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+
+		scenario := scenarios.Scenario{
+			UserID:      userID,
+			Name:        input.Name,
+			BaseMonth:   baseMonth,
+			BaseInputs:  base,
+			Overrides:   input.Overrides,
+			FactorSetID: set.ID,
+			Outcome:     outcome,
+		}
+		if scenario.Overrides == nil {
+			scenario.Overrides = scenarios.Inputs{}
+		}
+
+		if !input.Save {
+			c.JSON(http.StatusOK, scenario)
+			return
+		}
+
+		if scenario.Name == "" {
+			scenario.Name = "Scénario du " + time.Now().Format("02/01/2006 15:04")
+		}
+		if err := scenarios.Create(db, &scenario); err != nil {
+			logging.Errorf("CreateScenario - Erreur d'insertion: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible d'enregistrer le scénario"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, scenario)
+	}
+}
+
+func GetScenarios(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := scenarios.List(db, c.GetString("userID"))
+		if err != nil {
+			logging.Errorf("GetScenarios - Erreur: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de récupérer les scénarios"})
+			return
+		}
+
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+func GetScenario(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scenario, err := scenarios.Get(db, c.GetString("userID"), c.Param("id"))
+		if err != nil {
+			scenarioError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, scenario)
+	}
+}
+
+func DeleteScenario(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := scenarios.Delete(db, c.GetString("userID"), c.Param("id")); err != nil {
+			scenarioError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Scénario supprimé"})
+	}
+}
+
+// monthInputs charge les entrées enregistrées de chaque catégorie d'un mois.
+func monthInputs(results store.ResultStore, userID string, month time.Time) (scenarios.Inputs, error) {
+	saved, err := results.Find(userID, store.ResultQuery{From: &month, To: &month})
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := scenarios.Inputs{}
+	for _, result := range saved {
+		values := map[string]any{}
+		if len(result.Inputs) > 0 {
+			if err := json.Unmarshal(result.Inputs, &values); err != nil {
+				return nil, err
+			}
+		}
+		inputs[result.Category] = values
+	}
+	return inputs, nil
+}
+
+func scenarioError(c *gin.Context, err error) {
+	if errors.Is(err, scenarios.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	logging.Errorf("Scénarios - Erreur: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur sur les scénarios"})
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"carbone-app/logging"
+	"carbone-app/models"
+	"carbone-app/store"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Nombre de mois couverts par chaque granularité
+var granularities = map[string]int{
+	"month":   1,
+	"quarter": 3,
+	"year":    12,
+}
+
+type periodSummary struct {
+	Period        string             `json:"period"`
+	Start         string             `json:"start"`
+	Total         float64            `json:"total"`
+	Categories    map[string]float64 `json:"categories"`
+	PreviousTotal float64            `json:"previousTotal"`
+	Change        float64            `json:"change"`
+	ChangePercent *float64           `json:"changePercent"`
+}
+
+// GetResultsSummary agrège les résultats de l'utilisateur par période
+// (?granularity=month|quarter|year) entre ?from= et ?to= (format "2024-01",
+// les 12 derniers mois par défaut).
+func GetResultsSummary(results store.ResultStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+
+		granularity := c.DefaultQuery("granularity", "month")
+		step, ok := granularities[granularity]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Granularité invalide (month, quarter ou year)"})
+			return
+		}
+
+		now := time.Now().UTC()
+		to := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		if value := c.Query("to"); value != "" {
+			parsed, err := time.Parse("2006-01", value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Format de mois invalide pour to"})
+				return
+			}
+			to = parsed
+		}
+		from := to.AddDate(0, -11, 0)
+		if value := c.Query("from"); value != "" {
+			parsed, err := time.Parse("2006-01", value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Format de mois invalide pour from"})
+				return
+			}
+			from = parsed
+		}
+		if from.After(to) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from doit précéder to"})
+			return
+		}
+
+		// La plage commence au début de la période de from ; la période
+		// précédente a la même durée, juste avant
+		start := monthIndex(from) / step * step
+		end := monthIndex(to)
+		span := monthsBetween(from, to, step)
+		first := min(start-span, start-step, end-11)
+		last := end/step*step + step - 1
+
+		rangeFrom, rangeTo := monthStart(first), monthStart(last)
+		saved, err := results.Find(userID, store.ResultQuery{From: &rangeFrom, To: &rangeTo, Ascending: true})
+		if err != nil {
+			logging.Errorf("GetResultsSummary - Erreur des résultats: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de calculer le bilan"})
+			return
+		}
+
+		c.JSON(http.StatusOK, summarize(saved, granularity, step, from, to))
+	}
+}
+
+// summarize calcule le bilan à partir des résultats couvrant la plage, la
+// période qui la précède et les 12 mois jusqu'à to. Les totaux des périodes
+// couvrent la période entière, leur détail par catégorie s'arrête à to.
+func summarize(saved []models.Result, granularity string, step int, from, to time.Time) gin.H {
+	start := monthIndex(from) / step * step
+	end := monthIndex(to)
+	span := monthsBetween(from, to, step)
+
+	// Totaux par période, y compris les périodes vides ; la première ne sert
+	// qu'à l'évolution de la suivante
+	totals := map[int]float64{}
+	categoryTotals := map[int]map[string]float64{}
+	total, previousTotal, rolling := 0.0, 0.0, 0.0
+	categories := map[string]float64{}
+	for _, result := range saved {
+		month := monthIndex(result.Month)
+		period := month / step * step
+		totals[period] += result.Value
+
+		if month >= start && month <= end {
+			total += result.Value
+			categories[result.Category] += result.Value
+			if categoryTotals[period] == nil {
+				categoryTotals[period] = map[string]float64{}
+			}
+			categoryTotals[period][result.Category] += result.Value
+		}
+		if month >= start-span && month < start {
+			previousTotal += result.Value
+		}
+		if month > end-12 && month <= end {
+			rolling += result.Value
+		}
+	}
+
+	periods := []periodSummary{}
+	for period := start; period <= end/step*step; period += step {
+		begin := monthStart(period)
+		summary := periodSummary{
+			Period:        periodLabel(begin, granularity),
+			Start:         begin.Format("2006-01-02"),
+			Total:         totals[period],
+			Categories:    map[string]float64{},
+			PreviousTotal: totals[period-step],
+		}
+		for category, value := range categoryTotals[period] {
+			summary.Categories[category] = value
+		}
+		summary.Change = summary.Total - summary.PreviousTotal
+		summary.ChangePercent = percentChange(summary.PreviousTotal, summary.Total)
+		periods = append(periods, summary)
+	}
+
+	return gin.H{
+		"granularity": granularity,
+		"from":        from.Format("2006-01"),
+		"to":          to.Format("2006-01"),
+		"periods":     periods,
+		"total":       total,
+		"categories":  categories,
+		"previous": gin.H{
+			"total":         previousTotal,
+			"change":        total - previousTotal,
+			"changePercent": percentChange(previousTotal, total),
+		},
+		"rolling12Months": rolling,
+	}
+}
+
+// monthIndex numérote les mois depuis janvier de l'an 0, pour tronquer et
+// décaler les mois par simple arithmétique.
+func monthIndex(t time.Time) int {
+	return t.Year()*12 + int(t.Month()) - 1
+}
+
+func monthStart(index int) time.Time {
+	return time.Date(index/12, time.Month(index%12+1), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func periodLabel(start time.Time, granularity string) string {
+	switch granularity {
+	case "quarter":
+		return fmt.Sprintf("%d-Q%d", start.Year(), (int(start.Month())-1)/3+1)
+	case "year":
+		return fmt.Sprintf("%d", start.Year())
+	default:
+		return start.Format("2006-01")
+	}
+}
+
+// monthsBetween renvoie la durée en mois de la plage, arrondie à la
+// granularité.
+func monthsBetween(from, to time.Time, step int) int {
+	start := monthIndex(from) / step * step
+	end := monthIndex(to) / step * step
+	return end - start + step
+}
+
+func percentChange(previous, current float64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	change := (current - previous) / previous * 100
+	return &change
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"carbone-app/logging"
+	"carbone-app/store"
+	"carbone-app/twofactor"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func GetTwoFactorStatus(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, err := twofactor.GetStatus(db, c.GetString("userID"))
+		if err != nil {
+			twoFactorError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, status)
+	}
+}
+
+// SetupTwoFactor génère un secret TOTP et renvoie l'URI à scanner. La double
+// authentification n'est active qu'après EnableTwoFactor.
+func SetupTwoFactor(users store.UserStore, db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := users.Get(c.GetString("userID"))
+		if err != nil {
+			twoFactorError(c, err)
+			return
+		}
+
+		secret, uri, err := twofactor.Enroll(db, user.ID, user.Email)
+		if err != nil {
+			twoFactorError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"secret": secret, "uri": uri})
+	}
+}
+
+// EnableTwoFactor confirme le secret avec un premier code et renvoie les codes
+// de secours, qui ne seront plus jamais affichés.
+func EnableTwoFactor(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Code string `json:"code" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		codes, err := twofactor.Confirm(db, c.GetString("userID"), input.Code)
+		if err != nil {
+			twoFactorError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+	}
+}
+
+// DisableTwoFactor demande le mot de passe et un code valide.
+func DisableTwoFactor(users store.UserStore, db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Password string `json:"password" binding:"required"`
+			Code     string `json:"code" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userID := c.GetString("userID")
+		if !checkPassword(c, users, userID, input.Password) {
+			return
+		}
+		if err := twofactor.Check(db, userID, input.Code); err != nil {
+			twoFactorError(c, err)
+			return
+		}
+		if err := twofactor.Disable(db, userID); err != nil {
+			twoFactorError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Double authentification désactivée"})
+	}
+}
+
+func RegenerateRecoveryCodes(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Code string `json:"code" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userID := c.GetString("userID")
+		if err := twofactor.Check(db, userID, input.Code); err != nil {
+			twoFactorError(c, err)
+			return
+		}
+		codes, err := twofactor.RegenerateRecoveryCodes(db, userID)
+		if err != nil {
+			twoFactorError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+	}
+}
+
+// ResetUserTwoFactor permet à un administrateur de désactiver la double
+// authentification d'un utilisateur qui a perdu son téléphone et ses codes.
+func ResetUserTwoFactor(users store.UserStore, db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := findUser(c, users)
+		if !ok {
+			return
+		}
+		if err := twofactor.Disable(db, user.ID); err != nil {
+			twoFactorError(c, err)
+			return
+		}
+
+		logging.Infof("Double authentification réinitialisée pour %s par %s", user.ID, c.GetString("userID"))
+		c.JSON(http.StatusOK, gin.H{"message": "Double authentification réinitialisée"})
+	}
+}
+
+func checkPassword(c *gin.Context, users store.UserStore, userID, password string) bool {
+	user, err := users.Get(userID)
+	if err != nil {
+		twoFactorError(c, err)
+		return false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Mot de passe invalide"})
+		return false
+	}
+	return true
+}
+
+func twoFactorError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, twofactor.ErrInvalidCode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, twofactor.ErrAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, twofactor.ErrNotEnrolled), errors.Is(err, twofactor.ErrNotEnabled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		logging.Errorf("Double authentification - Erreur: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur de double authentification"})
+	}
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"carbone-app/logging"
+	"carbone-app/loginguard"
+	"carbone-app/models"
+	"carbone-app/sessions"
+	"carbone-app/store"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// ListUsers liste les utilisateurs, paginés (?page=&pageSize=), filtrés par
+// ?search= sur l'email ou le nom d'utilisateur et par ?role=.
+func ListUsers(users store.UserStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+		if err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "page invalide"})
+			return
+		}
+		pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", strconv.Itoa(defaultPageSize)))
+		if err != nil || pageSize < 1 || pageSize > maxPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "pageSize invalide"})
+			return
+		}
+		role := c.Query("role")
+		if role != "" && !models.ValidRole(role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Rôle inconnu"})
+			return
+		}
+
+		list, total, err := users.List(store.UserQuery{
+			Search: c.Query("search"),
+			Role:   role,
+			Limit:  pageSize,
+			Offset: (page - 1) * pageSize,
+		})
+		if err != nil {
+			logging.Errorf("ListUsers - Erreur: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de récupérer les utilisateurs"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"users":    list,
+			"page":     page,
+			"pageSize": pageSize,
+			"total":    total,
+		})
+	}
+}
+
+func GetUser(users store.UserStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := findUser(c, users)
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+// UpdateUserRole change le rôle d'un utilisateur et révoque ses sessions :
+// ses access tokens portent l'ancien rôle, il doit se reconnecter.
+func UpdateUserRole(users store.UserStore, db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Role string `json:"role" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !models.ValidRole(input.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Rôle inconnu"})
+			return
+		}
+
+		user, ok := findUser(c, users)
+		if !ok {
+			return
+		}
+		if user.ID == c.GetString("userID") {
+			c.JSON(http.StatusConflict, gin.H{"error": "Impossible de modifier son propre rôle"})
+			return
+		}
+
+		if err := users.UpdateRole(user.ID, input.Role); err != nil {
+			logging.Errorf("UpdateUserRole - Erreur: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de modifier le rôle"})
+			return
+		}
+		if err := sessions.RevokeAll(db, user.ID); err != nil {
+			logging.Errorf("UpdateUserRole - Erreur de révocation des sessions: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Rôle modifié, mais impossible de révoquer les sessions"})
+			return
+		}
+
+		user.Role = input.Role
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+// DeleteUser supprime un utilisateur ; ses données suivent par cascade.
+func DeleteUser(users store.UserStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := findUser(c, users)
+		if !ok {
+			return
+		}
+		if user.ID == c.GetString("userID") {
+			c.JSON(http.StatusConflict, gin.H{"error": "Impossible de supprimer son propre compte depuis l'administration"})
+			return
+		}
+
+		if err := users.Delete(user.ID); err != nil {
+			logging.Errorf("DeleteUser - Erreur: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de supprimer l'utilisateur"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Utilisateur supprimé"})
+	}
+}
+
+func findUser(c *gin.Context, users store.UserStore) (models.User, bool) {
+	user, err := users.Get(c.Param("id"))
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Utilisateur introuvable"})
+		return user, false
+	}
+	if err != nil {
+		logging.Errorf("Utilisateurs - Erreur de lecture: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de récupérer l'utilisateur"})
+		return user, false
+	}
+	return user, true
+}
+
+// ListLoginAttempts consulte le journal des connexions, filtré par ?userId=,
+// ?ip= et ?failed=true, paginé comme ListUsers.
+func ListLoginAttempts(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+		if err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "page invalide"})
+			return
+		}
+		pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", strconv.Itoa(defaultPageSize)))
+		if err != nil || pageSize < 1 || pageSize > maxPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "pageSize invalide"})
+			return
+		}
+
+		attempts, total, err := loginguard.List(db, loginguard.Filter{
+			UserID: c.Query("userId"),
+			IP:     c.Query("ip"),
+			Failed: c.Query("failed") == "true",
+			Limit:  pageSize,
+			Offset: (page - 1) * pageSize,
+		})
+		if err != nil {
+			logging.Errorf("ListLoginAttempts - Erreur: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible de récupérer le journal des connexions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"attempts": attempts,
+			"page":     page,
+			"pageSize": pageSize,
+			"total":    total,
+		})
+	}
+}
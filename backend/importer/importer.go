@@ -0,0 +1,311 @@
+// Package importer lit des résultats mensuels historiques depuis un tableur
+// (CSV ou XLSX) : une ligne par mois et par catégorie, les entrées de la
+// catégorie dans des colonnes portant le nom des champs du calculateur.
+package importer
+
+import (
+	"bytes"
+	"carbone-app/calculator"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// MaxRows limite le nombre de lignes d'un import.
+const MaxRows = 5000
+
+var (
+	ErrEmpty       = errors.New("fichier vide")
+	ErrTooManyRows = fmt.Errorf("plus de %d lignes", MaxRows)
+)
+
+// HeaderError signale des colonnes obligatoires absentes ou inconnues.
+type HeaderError struct {
+	Missing []string `json:"missing,omitempty"`
+	Unknown []string `json:"unknown,omitempty"`
+}
+
+func (e *HeaderError) Error() string {
+	var parts []string
+	if len(e.Missing) > 0 {
+		parts = append(parts, "colonnes manquantes: "+strings.Join(e.Missing, ", "))
+	}
+	if len(e.Unknown) > 0 {
+		parts = append(parts, "colonnes inconnues: "+strings.Join(e.Unknown, ", "))
+	}
+	return strings.Join(parts, " ; ")
+}
+
+// Row est une ligne du fichier. Line est le numéro de ligne dans le fichier
+// (l'en-tête est la ligne 1). Errors est vide si la ligne est valide.
+type Row struct {
+	Line     int                     `json:"line"`
+	Month    string                  `json:"month"`
+	Category string                  `json:"category"`
+	Inputs   map[string]any          `json:"inputs"`
+	Errors   []calculator.FieldError `json:"errors,omitempty"`
+
+	month time.Time
+}
+
+// MonthDate renvoie le premier jour du mois de la ligne.
+func (r Row) MonthDate() time.Time {
+	return r.month
+}
+
+// ReadCSV lit un fichier CSV séparé par des virgules ou, comme souvent avec
+// les tableurs français, par des points-virgules.
+func ReadCSV(r io.Reader) ([][]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	return reader.ReadAll()
+}
+
+// ReadXLSX lit la première feuille d'un classeur XLSX.
+func ReadXLSX(r io.Reader) ([][]string, error) {
+	file, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sheets := file.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, ErrEmpty
+	}
+	return file.GetRows(sheets[0])
+}
+
+// Parse associe les colonnes aux champs des catégories et convertit chaque
+// ligne. Les colonnes month et category sont obligatoires ; une colonne value
+// est acceptée mais ignorée, la valeur étant toujours recalculée. Les
+// erreurs propres à une ligne sont renvoyées dans Row.Errors.
+func Parse(records [][]string) ([]Row, error) {
+	if len(records) == 0 {
+		return nil, ErrEmpty
+	}
+	if len(records)-1 > MaxRows {
+		return nil, ErrTooManyRows
+	}
+
+	fields := knownFields()
+	monthCol, categoryCol := -1, -1
+	type column struct {
+		index int
+		name  string
+	}
+	var columns []column
+	headerErr := &HeaderError{}
+	for i, header := range records[0] {
+		name := strings.TrimSpace(header)
+		switch strings.ToLower(name) {
+		case "":
+			continue
+		case "month", "mois":
+			monthCol = i
+		case "category", "catégorie", "categorie":
+			categoryCol = i
+		case "value", "valeur":
+		default:
+			canonical, ok := fields[strings.ToLower(name)]
+			if !ok {
+				headerErr.Unknown = append(headerErr.Unknown, name)
+				continue
+			}
+			columns = append(columns, column{i, canonical})
+		}
+	}
+	if monthCol < 0 {
+		headerErr.Missing = append(headerErr.Missing, "month")
+	}
+	if categoryCol < 0 {
+		headerErr.Missing = append(headerErr.Missing, "category")
+	}
+	if len(headerErr.Missing) > 0 || len(headerErr.Unknown) > 0 {
+		return nil, headerErr
+	}
+
+	rows := []Row{}
+	seen := map[string]int{}
+	for n, record := range records[1:] {
+		if blank(record) {
+			continue
+		}
+		row := Row{
+			Line:     n + 2,
+			Month:    cell(record, monthCol),
+			Category: cell(record, categoryCol),
+			Inputs:   map[string]any{},
+		}
+
+		month, err := parseMonth(row.Month)
+		if err != nil {
+			row.Errors = append(row.Errors, calculator.FieldError{
+				Field: "month", Code: calculator.CodeInvalidValue, Message: "mois attendu au format AAAA-MM",
+			})
+		} else {
+			row.month = month
+			row.Month = month.Format("2006-01")
+		}
+
+		category, ok := lookupCategory(row.Category)
+		if !ok {
+			row.Errors = append(row.Errors, calculator.Validate(row.Category, nil)...)
+			rows = append(rows, row)
+			continue
+		}
+		row.Category = category.Name
+
+		for _, col := range columns {
+			name := col.name
+			value := cell(record, col.index)
+			if value == "" {
+				continue
+			}
+			field, ok := fieldOf(category, name)
+			if !ok {
+				row.Errors = append(row.Errors, calculator.FieldError{
+					Field: name, Code: calculator.CodeUnknownField, Message: "entrée inconnue pour cette catégorie",
+				})
+				continue
+			}
+			row.Inputs[name] = convert(field, value)
+		}
+		row.Errors = append(row.Errors, calculator.Validate(category.Name, row.Inputs)...)
+
+		if row.month.IsZero() {
+			rows = append(rows, row)
+			continue
+		}
+		key := category.Name + "|" + row.Month
+		if first, ok := seen[key]; ok {
+			row.Errors = append(row.Errors, calculator.FieldError{
+				Field:   "month",
+				Code:    calculator.CodeInvalidValue,
+				Message: fmt.Sprintf("doublon de la ligne %d pour ce mois et cette catégorie", first),
+			})
+		} else {
+			seen[key] = row.Line
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// knownFields associe le nom en minuscules de chaque champ du calculateur à
+// son nom exact. Un même nom peut servir à plusieurs catégories.
+func knownFields() map[string]string {
+	fields := map[string]string{}
+	for _, category := range calculator.Categories() {
+		for _, field := range category.Fields {
+			fields[strings.ToLower(field.Name)] = field.Name
+		}
+	}
+	return fields
+}
+
+// lookupCategory cherche une catégorie sans tenir compte de la casse.
+func lookupCategory(name string) (calculator.Category, bool) {
+	for _, category := range calculator.Categories() {
+		if strings.EqualFold(category.Name, name) {
+			return category, true
+		}
+	}
+	return calculator.Category{}, false
+}
+
+func fieldOf(category calculator.Category, name string) (calculator.Field, bool) {
+	for _, field := range category.Fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return calculator.Field{}, false
+}
+
+// convert transforme une cellule en nombre pour les champs numériques
+// (virgule décimale acceptée). Une cellule illisible est conservée telle
+// quelle pour que la validation la signale.
+func convert(field calculator.Field, value string) any {
+	if field.Type != calculator.Number {
+		return value
+	}
+	number, err := strconv.ParseFloat(strings.ReplaceAll(strings.ReplaceAll(value, " ", ""), ",", "."), 64)
+	if err != nil {
+		return value
+	}
+	return number
+}
+
+var monthLayouts = []string{"2006-01", "2006-01-02", "2006/01", "01/2006", "1/2006", "02/01/2006"}
+
+func parseMonth(value string) (time.Time, error) {
+	for _, layout := range monthLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("mois invalide: %q", value)
+}
+
+func cell(record []string, i int) string {
+	if i < 0 || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+func blank(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Action prévue (ou effectuée) pour une ligne
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionInvalid = "invalid"
+)
+
+// RowReport complète une ligne avec la valeur recalculée et l'action prévue.
+type RowReport struct {
+	Row
+	Value  *float64 `json:"value,omitempty"`
+	Action string   `json:"action"`
+}
+
+type Summary struct {
+	Rows    int `json:"rows"`
+	Valid   int `json:"valid"`
+	Invalid int `json:"invalid"`
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+}
+
+type Report struct {
+	DryRun    bool        `json:"dryRun"`
+	Committed bool        `json:"committed"`
+	Summary   Summary     `json:"summary"`
+	Rows      []RowReport `json:"rows"`
+}
@@ -0,0 +1,68 @@
+// Package logging filtre le journal de l'application selon un niveau
+// (debug, info, warn ou error). Les messages retenus passent par le logger
+// standard, préfixés de leur niveau ; log.Fatalf reste réservé au démarrage.
+package logging
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var names = map[string]Level{
+	"debug": LevelDebug,
+	"info":  LevelInfo,
+	"warn":  LevelWarn,
+	"error": LevelError,
+}
+
+var prefixes = map[Level]string{
+	LevelDebug: "DEBUG ",
+	LevelInfo:  "INFO ",
+	LevelWarn:  "WARN ",
+	LevelError: "ERROR ",
+}
+
+var current atomic.Int32
+
+func init() {
+	current.Store(int32(LevelInfo))
+}
+
+// ParseLevel renvoie le niveau nommé name.
+func ParseLevel(name string) (Level, bool) {
+	level, ok := names[name]
+	return level, ok
+}
+
+// SetLevel fixe le niveau en dessous duquel les messages sont ignorés.
+func SetLevel(level Level) {
+	current.Store(int32(level))
+}
+
+// Enabled indique si les messages du niveau donné sont écrits.
+func Enabled(level Level) bool {
+	return int32(level) >= current.Load()
+}
+
+func Debugf(format string, args ...any) { output(LevelDebug, format, args...) }
+func Infof(format string, args ...any)  { output(LevelInfo, format, args...) }
+func Warnf(format string, args ...any)  { output(LevelWarn, format, args...) }
+func Errorf(format string, args ...any) { output(LevelError, format, args...) }
+
+func output(level Level, format string, args ...any) {
+	if !Enabled(level) {
+		return
+	}
+	// 3 : l'appelant de Debugf, Infof, Warnf ou Errorf
+	log.Output(3, prefixes[level]+fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"carbone-app/config"
+	"carbone-app/loginguard"
+	"carbone-app/migrations"
+	"carbone-app/models"
+	"carbone-app/store"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// loginRouter monte le handler de connexion sur une base SQLite migrée
+// contenant le compte alice.
+func loginRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	cfg := config.Default().Database
+	cfg.Driver = config.DriverSQLite
+	cfg.DSN = filepath.Join(t.TempDir(), "login.db")
+	db, err := config.InitDB(cfg)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := migrations.Up(db, config.DriverSQLite); err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+
+	stores := store.NewSQLite(db)
+	hash, err := bcrypt.GenerateFromPassword([]byte("bon mot de passe"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{Email: "alice@example.com", Username: "alice", Password: string(hash), Role: models.RoleUser}
+	if err := stores.Users.Create(&user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/login", login(stores.Users, db))
+	return r
+}
+
+func postLogin(r *gin.Engine, identifier, password string) *httptest.ResponseRecorder {
+	body := `{"identifier": "` + identifier + `", "password": "` + password + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// Une fois le compte bloqué, la réponse ne dit ni si le mot de passe est le
+// bon, ni si le compte existe.
+func TestLoginLockedResponseIsUniform(t *testing.T) {
+	r := loginRouter(t)
+
+	for i := 0; i < loginguard.AccountPolicy.Threshold; i++ {
+		if w := postLogin(r, "alice", "mauvais"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("échec %d: status %d, attendu 401", i+1, w.Code)
+		}
+	}
+	for i := 0; i < loginguard.AccountPolicy.Threshold; i++ {
+		if w := postLogin(r, "personne", "mauvais"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("échec %d d'un compte inconnu: status %d, attendu 401", i+1, w.Code)
+		}
+	}
+
+	wrong := postLogin(r, "alice", "mauvais")
+	right := postLogin(r, "alice", "bon mot de passe")
+	unknown := postLogin(r, "personne", "mauvais")
+	if wrong.Code != http.StatusTooManyRequests {
+		t.Fatalf("compte bloqué: status %d, attendu 429", wrong.Code)
+	}
+	for name, w := range map[string]*httptest.ResponseRecorder{"bon mot de passe": right, "compte inconnu": unknown} {
+		if w.Code != wrong.Code || w.Body.String() != wrong.Body.String() ||
+			w.Header().Get("Retry-After") != wrong.Header().Get("Retry-After") {
+			t.Errorf("%s: %d %s (Retry-After %s), attendu %d %s (Retry-After %s)", name,
+				w.Code, w.Body, w.Header().Get("Retry-After"),
+				wrong.Code, wrong.Body, wrong.Header().Get("Retry-After"))
+		}
+	}
+}
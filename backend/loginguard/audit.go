@@ -0,0 +1,102 @@
+package loginguard
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Issues d'une tentative de connexion
+const (
+	ReasonSuccess            = "success"
+	ReasonInvalidCredentials = "invalid_credentials"
+	ReasonAccountLocked      = "account_locked"
+	ReasonIPLocked           = "ip_locked"
+
+	ReasonSecondFactorRequired = "second_factor_required"
+	ReasonInvalidSecondFactor  = "invalid_second_factor"
+)
+
+type Attempt struct {
+	ID         int64     `json:"id"`
+	UserID     *string   `json:"user_id"`
+	Identifier string    `json:"identifier"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	Success    bool      `json:"success"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func Record(db *sql.DB, attempt Attempt) error {
+	_, err := db.Exec(`
+		INSERT INTO login_attempts (user_id, identifier, ip, user_agent, success, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, attempt.UserID, attempt.Identifier, attempt.IP, attempt.UserAgent, attempt.Success, attempt.Reason, attempt.CreatedAt)
+	return err
+}
+
+// Filter restreint la liste des tentatives ; les champs vides sont ignorés.
+type Filter struct {
+	UserID string
+	IP     string
+	Failed bool
+	Limit  int
+	Offset int
+}
+
+// List renvoie les tentatives les plus récentes d'abord, et leur nombre total.
+func List(db *sql.DB, filter Filter) ([]Attempt, int, error) {
+	conditions := []string{"TRUE"}
+	args := []any{}
+	if filter.UserID != "" {
+		if _, err := uuid.Parse(filter.UserID); err != nil {
+			return []Attempt{}, 0, nil
+		}
+		args = append(args, filter.UserID)
+		conditions = append(conditions, fmt.Sprintf("user_id = $%d", len(args)))
+	}
+	if filter.IP != "" {
+		args = append(args, filter.IP)
+		conditions = append(conditions, fmt.Sprintf("ip = $%d", len(args)))
+	}
+	if filter.Failed {
+		conditions = append(conditions, "NOT success")
+	}
+	where := " WHERE " + strings.Join(conditions, " AND ")
+
+	var total int
+	err := db.QueryRow("SELECT COUNT(*) FROM login_attempts"+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT id, user_id, identifier, ip, COALESCE(user_agent, ''), success, reason, created_at
+		FROM login_attempts%s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)+1, len(args)+2), append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	attempts := []Attempt{}
+	for rows.Next() {
+		var attempt Attempt
+		var userID sql.NullString
+		if err := rows.Scan(&attempt.ID, &userID, &attempt.Identifier, &attempt.IP, &attempt.UserAgent,
+			&attempt.Success, &attempt.Reason, &attempt.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		if userID.Valid {
+			attempt.UserID = &userID.String
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, total, rows.Err()
+}
@@ -0,0 +1,91 @@
+// Package loginguard protège la connexion contre la force brute : compteurs
+// d'échecs par compte et par IP avec blocage exponentiel, et journal des
+// tentatives.
+package loginguard
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"strings"
+	"time"
+)
+
+// Policy règle le blocage d'une clé : à partir de Threshold échecs
+// consécutifs, la clé est bloquée Base, puis deux fois plus longtemps à chaque
+// nouvel échec, sans dépasser Max. Le compteur repart de zéro après Reset
+// sans échec.
+type Policy struct {
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+	Reset     time.Duration
+}
+
+var (
+	AccountPolicy = Policy{Threshold: 5, Base: 30 * time.Second, Max: time.Hour, Reset: 24 * time.Hour}
+	IPPolicy      = Policy{Threshold: 20, Base: 30 * time.Second, Max: time.Hour, Reset: time.Hour}
+)
+
+// Clés des compteurs. Un identifiant inconnu a son propre compteur, pour que
+// le blocage ne révèle pas quels comptes existent.
+func AccountKey(userID string) string        { return "account:" + userID }
+func IdentifierKey(identifier string) string { return "identifier:" + strings.ToLower(identifier) }
+func IPKey(ip string) string                 { return "ip:" + ip }
+
+// LockedUntil renvoie la fin du blocage de la clé, ou une date nulle si elle
+// n'est pas bloquée à l'instant now.
+func LockedUntil(db *sql.DB, key string, now time.Time) (time.Time, error) {
+	var until sql.NullTime
+	err := db.QueryRow("SELECT locked_until FROM login_lockouts WHERE key = $1", key).Scan(&until)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !until.Valid || !until.Time.After(now) {
+		return time.Time{}, nil
+	}
+	return until.Time, nil
+}
+
+// Fail enregistre un échec pour la clé et la bloque si le seuil est atteint.
+func Fail(db *sql.DB, key string, policy Policy, now time.Time) error {
+	var failures int
+	err := db.QueryRow(`
+		INSERT INTO login_lockouts (key, failures, last_failure_at)
+		VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_lockouts.last_failure_at < $3 THEN 1 ELSE login_lockouts.failures + 1 END,
+			last_failure_at = $2
+		RETURNING failures
+	`, key, now, now.Add(-policy.Reset)).Scan(&failures)
+	if err != nil {
+		return err
+	}
+
+	if failures < policy.Threshold {
+		return nil
+	}
+	_, err = db.Exec("UPDATE login_lockouts SET locked_until = $1 WHERE key = $2", now.Add(policy.Delay(failures)), key)
+	return err
+}
+
+// Delay renvoie la durée de blocage après failures échecs consécutifs.
+func (p Policy) Delay(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+	delay := float64(p.Base) * math.Pow(2, float64(failures-p.Threshold))
+	if delay > float64(p.Max) {
+		return p.Max
+	}
+	return time.Duration(delay)
+}
+
+// Reset efface le compteur de la clé après une connexion réussie.
+func Reset(db *sql.DB, key string) error {
+	_, err := db.Exec("DELETE FROM login_lockouts WHERE key = $1", key)
+	return err
+}
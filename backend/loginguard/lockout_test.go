@@ -0,0 +1,144 @@
+package loginguard
+
+import (
+	"carbone-app/config"
+	"carbone-app/migrations"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	cfg := config.Default().Database
+	cfg.Driver = config.DriverSQLite
+	cfg.DSN = filepath.Join(t.TempDir(), "loginguard.db")
+	db, err := config.InitDB(cfg)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := migrations.Up(db, config.DriverSQLite); err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+	return db
+}
+
+var testPolicy = Policy{Threshold: 3, Base: time.Minute, Max: 10 * time.Minute, Reset: time.Hour}
+
+// start est l'horloge des tests : chaque appel reçoit l'instant voulu.
+var start = time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+func TestDelay(t *testing.T) {
+	cases := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{6, 8 * time.Minute},
+		{7, 10 * time.Minute},
+		{50, 10 * time.Minute},
+	}
+	for _, c := range cases {
+		if got := testPolicy.Delay(c.failures); got != c.want {
+			t.Errorf("Delay(%d) = %s, attendu %s", c.failures, got, c.want)
+		}
+	}
+}
+
+// lockedFor renvoie la durée restante du blocage de la clé à l'instant now.
+func lockedFor(t *testing.T, db *sql.DB, key string, now time.Time) time.Duration {
+	t.Helper()
+	until, err := LockedUntil(db, key, now)
+	if err != nil {
+		t.Fatalf("LockedUntil: %v", err)
+	}
+	if until.IsZero() {
+		return 0
+	}
+	return until.Sub(now)
+}
+
+func fail(t *testing.T, db *sql.DB, key string, now time.Time) {
+	t.Helper()
+	if err := Fail(db, key, testPolicy, now); err != nil {
+		t.Fatalf("Fail: %v", err)
+	}
+}
+
+func TestFailLocksAtThreshold(t *testing.T) {
+	db := openDB(t)
+	key := AccountKey("alice")
+
+	now := start
+	for i := 1; i < testPolicy.Threshold; i++ {
+		fail(t, db, key, now)
+		if d := lockedFor(t, db, key, now); d != 0 {
+			t.Fatalf("bloqué %s après %d échec(s), sous le seuil", d, i)
+		}
+		now = now.Add(time.Second)
+	}
+
+	fail(t, db, key, now)
+	if d := lockedFor(t, db, key, now); d != time.Minute {
+		t.Fatalf("blocage au seuil = %s, attendu 1m", d)
+	}
+	// Le blocage expire de lui-même
+	if d := lockedFor(t, db, key, now.Add(time.Minute)); d != 0 {
+		t.Errorf("toujours bloqué à l'échéance: %s", d)
+	}
+
+	// Chaque échec suivant double la durée
+	now = now.Add(2 * time.Minute)
+	fail(t, db, key, now)
+	if d := lockedFor(t, db, key, now); d != 2*time.Minute {
+		t.Errorf("blocage après un échec de plus = %s, attendu 2m", d)
+	}
+
+	// Les autres clés ne sont pas touchées
+	if d := lockedFor(t, db, IdentifierKey("Alice"), now); d != 0 {
+		t.Errorf("autre clé bloquée: %s", d)
+	}
+}
+
+func TestFailResetWindow(t *testing.T) {
+	db := openDB(t)
+	key := IPKey("192.0.2.1")
+
+	fail(t, db, key, start)
+	fail(t, db, key, start.Add(time.Minute))
+
+	// Au-delà de Reset sans échec, le compteur repart de un : ce troisième
+	// échec n'atteint pas le seuil
+	later := start.Add(time.Minute + testPolicy.Reset + time.Second)
+	fail(t, db, key, later)
+	if d := lockedFor(t, db, key, later); d != 0 {
+		t.Fatalf("bloqué %s alors que le compteur aurait dû repartir de zéro", d)
+	}
+
+	// Dans la fenêtre, les échecs s'additionnent
+	fail(t, db, key, later.Add(time.Minute))
+	fail(t, db, key, later.Add(2*time.Minute))
+	if d := lockedFor(t, db, key, later.Add(2*time.Minute)); d != time.Minute {
+		t.Errorf("blocage dans la fenêtre = %s, attendu 1m", d)
+	}
+
+	// Reset efface le compteur et le blocage
+	if err := Reset(db, key); err != nil {
+		t.Fatal(err)
+	}
+	if d := lockedFor(t, db, key, later.Add(2*time.Minute)); d != 0 {
+		t.Errorf("bloqué après Reset: %s", d)
+	}
+}
+
+func TestIdentifierKeyIgnoresCase(t *testing.T) {
+	if IdentifierKey("Alice@Example.com") != IdentifierKey("alice@example.com") {
+		t.Error("IdentifierKey dépend de la casse")
+	}
+}
@@ -0,0 +1,88 @@
+package mailer
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeSMTP accepte une connexion et renvoie les commandes reçues, jusqu'au
+// corps du message inclus.
+func fakeSMTP(t *testing.T) (host string, port int, commands <-chan []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	out := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var received []string
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost")
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				break
+			}
+			line = strings.TrimRight(line, "\r\n")
+			received = append(received, line)
+			switch {
+			case inData:
+				if line == "." {
+					inData = false
+					reply("250 ok")
+				}
+			case strings.HasPrefix(line, "EHLO"), strings.HasPrefix(line, "HELO"):
+				reply("250 localhost")
+			case line == "DATA":
+				inData = true
+				reply("354 go ahead")
+			case line == "QUIT":
+				reply("221 bye")
+				out <- received
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+		out <- received
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, out
+}
+
+func TestSMTPEnvelopeSender(t *testing.T) {
+	host, port, commands := fakeSMTP(t)
+	m := &SMTP{Host: host, Port: port, From: "Calculateur carbone <no-reply@example.com>"}
+
+	if err := m.Send(Message{To: "alice@example.com", Subject: "Test", Body: "Bonjour"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	received := strings.Join(<-commands, "\n")
+	if !strings.Contains(received, "MAIL FROM:<no-reply@example.com>") {
+		t.Errorf("MAIL FROM attendu avec l'adresse seule:\n%s", received)
+	}
+	if !strings.Contains(received, "From: Calculateur carbone <no-reply@example.com>") {
+		t.Errorf("en-tête From attendu avec le nom affiché:\n%s", received)
+	}
+}
+
+func TestSMTPInvalidSender(t *testing.T) {
+	m := &SMTP{Host: "127.0.0.1", Port: 1, From: "pas une adresse"}
+	if err := m.Send(Message{To: "alice@example.com"}); err == nil {
+		t.Fatal("Send accepte un expéditeur invalide")
+	}
+}
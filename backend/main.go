@@ -1,12 +1,31 @@
 package main
 
 import (
+	"carbone-app/calculator"
 	"carbone-app/config"
+	"carbone-app/factorsets"
+	"carbone-app/handlers"
+	"carbone-app/logging"
+	"carbone-app/loginguard"
+	"carbone-app/mailer"
+	"carbone-app/migrations"
 	"carbone-app/models"
+	"carbone-app/privacy"
+	"carbone-app/sessions"
+	"carbone-app/signing"
+	"carbone-app/store"
+	"carbone-app/twofactor"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -16,707 +35,1524 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-var jwtKey = []byte("clé_secrète_ici")
+// Clés de signature des JWT, chargées au démarrage
+var signingKeys *signing.KeySet
 
+// Les access tokens sont courts ; la session est prolongée par le refresh token
+var accessTokenTTL = 15 * time.Minute
+
+// Politique de POST /api/results quand la valeur envoyée diffère du recalcul
+// serveur (voir config.ResultsConfig)
+var resultValuePolicy = config.ValuePolicyReject
+
+// Si vrai, le serveur renseigne lui-même la valeur quand le client l'omet.
+var resultValueFill = false
+
+// Écart relatif toléré entre la valeur envoyée et la valeur recalculée
+const valueTolerance = 1e-6
+
+// Claims porte l'identifiant de session ; StandardClaims.Id est l'identifiant
+// de l'access token, comparé à celui de la session à chaque requête.
 type Claims struct {
-	UserID string
+	UserID    string
+	Role      string
+	SessionID string
 	jwt.StandardClaims
 }
 
-func dbMiddleware(db *sql.DB) gin.HandlerFunc {
+// purgeDeletedAccounts purge régulièrement les comptes dont le délai de grâce
+// a expiré.
+func purgeDeletedAccounts(db *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purged, err := privacy.PurgeDue(db, time.Now().UTC())
+		if err != nil {
+			logging.Errorf("Erreur lors de la purge des comptes supprimés: %v", err)
+		} else if purged > 0 {
+			logging.Infof("%d compte(s) supprimé(s) définitivement", purged)
+		}
+		<-ticker.C
+	}
+}
+
+// mailMiddleware fournit aux handlers le transport d'email et l'adresse du
+// frontend utilisée dans les liens.
+func mailMiddleware(m mailer.Mailer, appURL string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Set("db", db)
+		c.Set("mailer", m)
+		c.Set("appURL", appURL)
 		c.Next()
 	}
 }
 
+func newMailer(cfg config.MailConfig) (mailer.Mailer, error) {
+	switch cfg.Driver {
+	case config.MailSMTP:
+		return &mailer.SMTP{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			From:     cfg.From,
+		}, nil
+	case config.MailFile:
+		return mailer.NewFile(cfg.File, cfg.From)
+	case config.MailMemory:
+		return mailer.NewMemory(), nil
+	default:
+		return mailer.NewWriter(os.Stdout, cfg.From), nil
+	}
+}
+
 func main() {
-	db, err := config.InitDB()
+	// Configuration : défauts, fichier (-config), environnement puis options
+	cfg, args, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Configuration invalide: %v", err)
+	}
+	level, _ := logging.ParseLevel(cfg.LogLevel)
+	logging.SetLevel(level)
+
+	db, err := config.InitDB(cfg.Database)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer db.Close()
 
+	resultValuePolicy = cfg.Results.ValuePolicy
+	resultValueFill = cfg.Results.ValueFill
+
+	// Sous-commande : carbone-app migrate up|down [n]|status
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrate(db, cfg.Database.Driver, args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	stores := openStores(db, cfg.Database.Driver)
+
+	// Sous-commande : carbone-app role <email> <user|facilitator|admin>
+	if len(args) > 0 && args[0] == "role" {
+		if err := runRole(stores.Users, db, args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	logging.Infof("Configuration effective:\n%s", cfg)
+
+	signingKeys, err = signing.New(cfg.JWT.ActiveKey, cfg.JWT.Keys)
+	if err != nil {
+		log.Fatalf("Clés JWT invalides: %v", err)
+	}
+	accessTokenTTL = cfg.JWT.AccessTokenTTL.Duration
+
+	// Le mode debug de gin détaille les routes et chaque requête
+	if level != logging.LevelDebug {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	mail, err := newMailer(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Transport d'email invalide: %v", err)
+	}
+
+	// Appliquer les migrations en attente au démarrage du serveur
+	if _, err := migrations.Up(db, cfg.Database.Driver); err != nil {
+		log.Fatal(err)
+	}
+
+	if cfg.Accounts.DeletionGracePeriod.Duration > 0 {
+		go purgeDeletedAccounts(db, time.Hour)
+	}
+
 	r := gin.Default()
-	r.Use(dbMiddleware(db))
+	r.Use(mailMiddleware(mail, strings.TrimSuffix(cfg.Mail.BaseURL, "/")))
+
+	corsConfig := cors.DefaultConfig()
+	corsConfig.AllowOrigins = cfg.Server.CORSOrigins
+	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "If-Match"}
+	// Le client lit la révision dans l'ETag pour ses écritures conditionnelles
+	corsConfig.ExposeHeaders = []string{"ETag"}
+	corsConfig.AllowCredentials = true
 
-	config := cors.DefaultConfig()
-	config.AllowOrigins = []string{"http://localhost:5173"}
-	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization"}
-	config.AllowCredentials = true
+	r.Use(cors.New(corsConfig))
 
-	r.Use(cors.New(config))
+	// Clés publiques de vérification des tokens, pour les autres services
+	r.GET("/.well-known/jwks.json", getJWKS)
 
 	// Routes pour les calculs carbone
 	api := r.Group("/api")
 	{
 		// Routes publiques
-		api.GET("/factors", getCarbonFactors)
-		api.POST("/register", register)
-		api.POST("/login", login)
-		api.GET("/verify", verifyToken)
-		api.DELETE("/users", deleteAllUsers)
-		api.GET("/users", getAllUsers)
+		api.GET("/factors", getCarbonFactors(db))
+		api.POST("/register", register(stores.Users, db))
+		api.POST("/login", login(stores.Users, db))
+		api.POST("/login/2fa", loginTwoFactor(stores.Users, db))
+		api.GET("/verify", verifyToken(stores.Users, db))
+		api.POST("/token/refresh", refreshToken(db))
+		api.POST("/email/verify", handlers.VerifyEmail(stores.Users, db))
+		api.POST("/password/forgot", handlers.ForgotPassword(stores.Users, db))
+		api.POST("/password/reset", handlers.ResetPassword(stores.Users, db))
 
 		// Routes protégées
 		authorized := api.Group("")
-		authorized.Use(authMiddleware())
+		authorized.Use(authMiddleware(db))
 		{
-			authorized.POST("/calculate", calculateCarbon)
-			authorized.POST("/results", saveResult)
-			authorized.GET("/results", getResults)
-			authorized.PUT("/user/profile", updateUserProfile)
-			authorized.PUT("/user/password", updateUserPassword)
+			authorized.POST("/calculate", calculateCarbon(db))
+			authorized.POST("/results", saveResult(stores.Results, db))
+			authorized.GET("/results", getResults(stores.Results))
+			authorized.DELETE("/results", deleteMonthResults(stores.Results))
+			authorized.GET("/results/summary", handlers.GetResultsSummary(stores.Results))
+			authorized.POST("/results/import", handlers.ImportResults(stores.Results, db))
+			authorized.GET("/results/:id", getResult(stores.Results))
+			authorized.PUT("/results/:id", updateResult(stores.Results, db))
+			authorized.DELETE("/results/:id", deleteResult(stores.Results))
+			authorized.GET("/results/:id/history", handlers.GetResultHistory(stores.Results))
+			authorized.POST("/results/:id/restore", handlers.RestoreResult(stores.Results))
+			authorized.GET("/recommendations", handlers.GetRecommendations(stores.Results, db))
+
+			// Scénarios "et si"
+			authorized.POST("/scenarios", handlers.CreateScenario(stores.Results, db))
+			authorized.GET("/scenarios", handlers.GetScenarios(db))
+			authorized.GET("/scenarios/:id", handlers.GetScenario(db))
+			authorized.DELETE("/scenarios/:id", handlers.DeleteScenario(db))
+			authorized.PUT("/user/profile", updateUserProfile(stores.Users, db))
+			authorized.PUT("/user/password", updateUserPassword(stores.Users, db))
+			authorized.GET("/user/export", handlers.ExportUserData(db))
+			authorized.DELETE("/user", handlers.DeleteAccount(stores.Users, db, cfg.Accounts.DeletionGracePeriod.Duration))
+			authorized.POST("/email/verification", handlers.ResendVerification(stores.Users, db))
+
+			// Double authentification
+			authorized.GET("/user/2fa", handlers.GetTwoFactorStatus(db))
+			authorized.POST("/user/2fa/setup", handlers.SetupTwoFactor(stores.Users, db))
+			authorized.POST("/user/2fa/enable", handlers.EnableTwoFactor(db))
+			authorized.POST("/user/2fa/disable", handlers.DisableTwoFactor(stores.Users, db))
+			authorized.POST("/user/2fa/recovery-codes", handlers.RegenerateRecoveryCodes(db))
+			authorized.POST("/logout", logout(db))
+			authorized.POST("/logout/all", logoutAll(db))
+
+			// Journal d'activités
+			authorized.GET("/activities", handlers.GetActivities(stores.Activities))
+			authorized.POST("/activities", handlers.CreateActivity(stores.Activities, db))
+			authorized.GET("/activities/total", handlers.GetCarbonTotal(stores.Activities))
+			authorized.GET("/activities/factors", handlers.GetActivityFactors(stores.Activities, db))
+			authorized.GET("/activities/:id", handlers.GetActivity(stores.Activities))
+			authorized.PUT("/activities/:id", handlers.UpdateActivity(stores.Activities, db))
+			authorized.DELETE("/activities/:id", handlers.DeleteActivity(stores.Activities))
+
+			// Groupes : adhésion par code, consentement et gestion des membres
+			// selon le rôle dans le groupe
+			authorized.GET("/groups", handlers.ListGroups(db))
+			authorized.POST("/groups/join", handlers.JoinGroup(db))
+			authorized.GET("/groups/:id", handlers.GetGroup(db))
+			authorized.DELETE("/groups/:id", handlers.DeleteGroup(db))
+			authorized.PUT("/groups/:id/consent", handlers.SetGroupConsent(db))
+			authorized.DELETE("/groups/:id/membership", handlers.LeaveGroup(db))
+			authorized.POST("/groups/:id/invite-code", handlers.RegenerateGroupCode(db))
+			authorized.PUT("/groups/:id/members/:userId/role", handlers.UpdateGroupMemberRole(db))
+			authorized.DELETE("/groups/:id/members/:userId", handlers.RemoveGroupMember(db))
 		}
-	}
 
-	r.Run(":8080")
-}
+		// Animation d'ateliers : réservée aux facilitateurs
+		facilitator := authorized.Group("")
+		facilitator.Use(requireRole(models.RoleFacilitator))
+		{
+			facilitator.POST("/groups", handlers.CreateGroup(db))
+			facilitator.GET("/groups/:id/results", handlers.GetGroupResults(db))
+		}
 
-func calculateCarbon(c *gin.Context) {
-	var input struct {
-		Category   string                 `json:"category"`
-		UserInputs map[string]interface{} `json:"userInputs"`
+		// Administration : réservée au rôle admin
+		admin := authorized.Group("/admin")
+		admin.Use(requireRole(models.RoleAdmin))
+		{
+			admin.GET("/users", handlers.ListUsers(stores.Users))
+			admin.GET("/users/:id", handlers.GetUser(stores.Users))
+			admin.PUT("/users/:id/role", handlers.UpdateUserRole(stores.Users, db))
+			admin.DELETE("/users/:id", handlers.DeleteUser(stores.Users))
+			admin.DELETE("/users/:id/2fa", handlers.ResetUserTwoFactor(stores.Users, db))
+			admin.GET("/login-attempts", handlers.ListLoginAttempts(db))
+
+			admin.GET("/factor-sets", handlers.ListFactorSets(db))
+			admin.POST("/factor-sets", handlers.CreateFactorSet(db))
+			admin.GET("/factor-sets/:id", handlers.GetFactorSet(db))
+			admin.GET("/factor-sets/:id/diff", handlers.DiffFactorSet(db))
+			admin.POST("/factor-sets/:id/publish", handlers.PublishFactorSet(db))
+
+			admin.GET("/recommendation-rules", handlers.ListRecommendationRules(db))
+			admin.POST("/recommendation-rules", handlers.CreateRecommendationRule(db))
+			admin.PUT("/recommendation-rules/:id", handlers.UpdateRecommendationRule(db))
+			admin.DELETE("/recommendation-rules/:id", handlers.DeleteRecommendationRule(db))
+			admin.PUT("/recommendation-thresholds/:category", handlers.SetRecommendationThreshold(db))
+		}
 	}
 
-	if err := c.BindJSON(&input); err != nil {
-		c.JSON(400, gin.H{"error": "Invalid input data"})
-		return
+	if cfg.Server.TLS.Enabled() {
+		err = r.RunTLS(cfg.Server.Addr, cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile)
+	} else {
+		err = r.Run(cfg.Server.Addr)
 	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
 
-	factors := getDefaultFactors()
-	var result float64
-
-	switch input.Category {
-	case "Transports":
-		if trainKm, ok := input.UserInputs["trainKm"].(float64); ok {
-			result += trainKm * factors.Transports.Train
-		}
-		if flightKm, ok := input.UserInputs["flightKm"].(float64); ok {
-			flightFactor := factors.Transports.Flight
-			if flightType, ok := input.UserInputs["flightType"].(string); ok {
-				if flightType == "domestic" {
-					flightFactor *= 0.85
-				}
-			}
-			result += flightKm * flightFactor
-		}
-		if carKm, ok := input.UserInputs["carKm"].(float64); ok {
-			if carType, ok := input.UserInputs["carType"].(string); ok {
-				if occupants, ok := input.UserInputs["carOccupants"].(float64); ok && occupants > 0 {
-					switch carType {
-					case "small":
-						result += (carKm * factors.Transports.Car.Small) / occupants
-					case "medium":
-						result += (carKm * factors.Transports.Car.Medium) / occupants
-					case "big":
-						result += (carKm * factors.Transports.Car.Big) / occupants
-					}
-				}
-			}
-		}
+func runMigrate(db *sql.DB, driver string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down [n]|status")
+	}
 
-	case "Logement_electromenagers":
-		if electricityKwh, ok := input.UserInputs["electricityKwh"].(float64); ok {
-			if homeOccupants, ok := input.UserInputs["homeOccupants"].(float64); ok && homeOccupants > 0 {
-				result += (electricityKwh * factors.LogementElectromenagers.Electricity) / homeOccupants
-			}
+	switch args[0] {
+	case "up":
+		count, err := migrations.Up(db, driver)
+		if err != nil {
+			return err
 		}
-		if gasKwh, ok := input.UserInputs["gasKwh"].(float64); ok {
-			if homeOccupants, ok := input.UserInputs["homeOccupants"].(float64); ok && homeOccupants > 0 {
-				result += (gasKwh * factors.LogementElectromenagers.Gas) / homeOccupants
+		fmt.Printf("%d migration(s) appliquée(s)\n", count)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("nombre de migrations invalide: %s", args[1])
 			}
+			steps = n
 		}
-		if housingType, ok := input.UserInputs["housingType"].(string); ok {
-			if homeSize, ok := input.UserInputs["homeSize"].(float64); ok {
-				if homeOccupants, ok := input.UserInputs["homeOccupants"].(float64); ok && homeOccupants > 0 {
-					switch housingType {
-					case "apartment":
-						result += (factors.LogementElectromenagers.Apartment * homeSize) / homeOccupants
-					case "house":
-						result += (factors.LogementElectromenagers.House * homeSize) / homeOccupants
-					}
-				}
-			}
+		count, err := migrations.Down(db, driver, steps)
+		if err != nil {
+			return err
 		}
-		if applianceCount, ok := input.UserInputs["applianceCount"].(float64); ok {
-			if homeOccupants, ok := input.UserInputs["homeOccupants"].(float64); ok && homeOccupants > 0 {
-				result += (applianceCount * factors.LogementElectromenagers.Appliance) / homeOccupants
-			}
+		fmt.Printf("%d migration(s) annulée(s)\n", count)
+	case "status":
+		statuses, err := migrations.List(db, driver)
+		if err != nil {
+			return err
 		}
-		if electronicCount, ok := input.UserInputs["electronicCount"].(float64); ok {
-			if homeOccupants, ok := input.UserInputs["homeOccupants"].(float64); ok && homeOccupants > 0 {
-				result += (electronicCount * factors.LogementElectromenagers.Electronic) / homeOccupants
+		for _, status := range statuses {
+			state := "en attente"
+			if status.Applied {
+				state = "appliquée le " + status.AppliedAt.Format("2006-01-02 15:04:05")
 			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, state)
 		}
+	default:
+		return fmt.Errorf("sous-commande migrate inconnue: %s", args[0])
+	}
+	return nil
+}
 
-	case "Alimentation":
-		if redMeatKg, ok := input.UserInputs["redMeatKg"].(float64); ok {
-			result += redMeatKg * factors.Alimentation.RedMeat
-		}
-		if whiteMeatKg, ok := input.UserInputs["whiteMeatKg"].(float64); ok {
-			result += whiteMeatKg * factors.Alimentation.WhiteMeat
-		}
-		if porkKg, ok := input.UserInputs["porkKg"].(float64); ok {
-			result += porkKg * factors.Alimentation.Pork
+// openStores renvoie les magasins du pilote configuré.
+func openStores(db *sql.DB, driver string) store.Stores {
+	if driver == config.DriverSQLite {
+		return store.NewSQLite(db)
+	}
+	return store.NewPostgres(db)
+}
+
+// runRole attribue un rôle à un utilisateur, notamment pour créer le premier
+// administrateur.
+func runRole(users store.UserStore, db *sql.DB, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: role <email> <user|facilitator|admin>")
+	}
+	email, role := args[0], args[1]
+	if !models.ValidRole(role) {
+		return fmt.Errorf("rôle inconnu: %s", role)
+	}
+
+	user, err := users.FindByEmail(email)
+	if errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("utilisateur introuvable: %s", email)
+	}
+	if err != nil {
+		return err
+	}
+	if err := users.UpdateRole(user.ID, role); err != nil {
+		return err
+	}
+	// Les access tokens en cours portent l'ancien rôle
+	if err := sessions.RevokeAll(db, user.ID); err != nil {
+		return err
+	}
+	fmt.Printf("%s a maintenant le rôle %s\n", email, role)
+	return nil
+}
+
+func calculateCarbon(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Category   string                 `json:"category"`
+			UserInputs map[string]interface{} `json:"userInputs"`
+			Month      string                 `json:"month"` // Format: "2024-01", mois courant par défaut
 		}
-		if bulkPurchase, ok := input.UserInputs["bulkPurchase"].(string); ok {
-			switch bulkPurchase {
-			case "none":
-				result *= factors.Alimentation.BulkFoodPurchase.None
-			case "partial":
-				result *= factors.Alimentation.BulkFoodPurchase.Partial
-			case "total":
-				result *= factors.Alimentation.BulkFoodPurchase.Total
-			}
+
+		if err := c.BindJSON(&input); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid input data"})
+			return
 		}
-		if shortCircuit, ok := input.UserInputs["shortCircuit"].(string); ok {
-			switch shortCircuit {
-			case "none":
-				result *= factors.Alimentation.ShortCircuit.None
-			case "partial":
-				result *= factors.Alimentation.ShortCircuit.Partial
-			case "majority":
-				result *= factors.Alimentation.ShortCircuit.Majority
+
+		month := time.Now()
+		if input.Month != "" {
+			parsed, err := time.Parse("2006-01", input.Month)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "Format de mois invalide"})
+				return
 			}
+			month = parsed
 		}
 
-	case "Vetements":
-		if largeItems, ok := input.UserInputs["largeItems"].(float64); ok {
-			result += largeItems * factors.Vetements.Large
+		if errs := calculator.Validate(input.Category, input.UserInputs); len(errs) > 0 {
+			c.JSON(422, gin.H{"error": "Invalid input data", "fields": errs})
+			return
 		}
-		if smallItems, ok := input.UserInputs["smallItems"].(float64); ok {
-			result += smallItems * factors.Vetements.Small
+
+		set, result, err := computeForMonth(db, input.Category, input.UserInputs, month)
+		if err != nil {
+			logging.Errorf("CalculateCarbon - Erreur de calcul: %v", err)
+			c.JSON(500, gin.H{"error": "Facteurs d'émission indisponibles"})
+			return
 		}
-		if origin, ok := input.UserInputs["origin"].(string); ok {
-			switch origin {
-			case "france":
-				result *= factors.Vetements.Madein.France
-			case "autre":
-				result *= factors.Vetements.Madein.Autre
+
+		c.JSON(200, gin.H{
+			"category":  input.Category,
+			"result":    result.Value,
+			"breakdown": result.Lines,
+			"factorSet": gin.H{
+				"id":      set.ID,
+				"version": set.Version,
+			},
+		})
+	}
+}
+
+// computeForMonth calcule une catégorie avec le jeu de facteurs valide pour
+// le mois donné.
+func computeForMonth(db *sql.DB, category string, inputs map[string]any, month time.Time) (models.FactorSet, calculator.Result, error) {
+	set, factors, err := factorsForMonth(db, month)
+	if err != nil {
+		return set, calculator.Result{}, err
+	}
+	result, err := calculator.Compute(category, inputs, factors)
+	return set, result, err
+}
+
+// factorsForMonth charge le jeu de facteurs publié valide pour le mois donné.
+func factorsForMonth(db *sql.DB, month time.Time) (models.FactorSet, calculator.Factors, error) {
+	set, err := factorsets.ForMonth(db, month)
+	if err != nil {
+		return set, nil, err
+	}
+	factors, err := factorsets.Factors(set)
+	return set, factors, err
+}
+
+func getCarbonFactors(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		month := time.Now()
+		if m := c.Query("month"); m != "" {
+			parsed, err := time.Parse("2006-01", m)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "Format de mois invalide"})
+				return
 			}
+			month = parsed
 		}
 
-	case "Numerique":
-		if googleSearches, ok := input.UserInputs["googleSearches"].(float64); ok {
-			result += (googleSearches * 30) * factors.Numerique.GoogleSearch
-		}
-		if chatgptPrompts, ok := input.UserInputs["chatgptPrompts"].(float64); ok {
-			result += (chatgptPrompts * 30) * factors.Numerique.ChatGPT
+		set, err := factorsets.ForMonth(db, month)
+		if err != nil {
+			logging.Errorf("GetCarbonFactors - Erreur: %v", err)
+			c.JSON(500, gin.H{"error": "Facteurs d'émission indisponibles"})
+			return
 		}
-		if smartphoneType, ok := input.UserInputs["smartphoneType"].(string); ok && smartphoneType != "" {
-			var baseEmission float64
-			switch smartphoneType {
-			case "small":
-				baseEmission = factors.Numerique.Smartphone.Small
-			case "large":
-				baseEmission = factors.Numerique.Smartphone.Large
-			}
 
-			if state, ok := input.UserInputs["smartphoneState"].(string); ok {
-				switch state {
-				case "used":
-					baseEmission *= factors.Numerique.Smartphone.Used
-				case "old":
-					baseEmission *= factors.Numerique.Smartphone.Old
-				}
-			}
+		c.Header("X-Factor-Set-Version", set.Version)
+		c.Data(200, "application/json; charset=utf-8", set.Factors)
+	}
+}
 
-			result += baseEmission
+func authMiddleware(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader("Authorization")
+		if token == "" {
+			c.JSON(401, gin.H{"error": "Authorization required"})
+			c.Abort()
+			return
+		}
+		// Vérifier le token JWT et sa session, puis ajouter l'userID, le rôle
+		// et la session au contexte
+		claims, err := authenticate(db, token)
+		if err != nil {
+			c.JSON(401, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
 		}
-		if socialHours, ok := input.UserInputs["socialHours"].(float64); ok {
-			result += (socialHours * 365) * factors.Numerique.SocialMedia
+		c.Set("userID", claims.UserID)
+		c.Set("role", claims.Role)
+		c.Set("sessionID", claims.SessionID)
+		c.Next()
+	}
+}
+
+// requireRole refuse l'accès aux utilisateurs qui n'ont pas au moins le rôle
+// demandé. Doit être placé après authMiddleware.
+func requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !models.HasRole(c.GetString("role"), role) {
+			c.JSON(403, gin.H{"error": "Forbidden"})
+			c.Abort()
+			return
 		}
+		c.Next()
+	}
+}
 
-	case "Consommation":
-		if amazonOrders, ok := input.UserInputs["amazonOrders"].(float64); ok {
-			result += amazonOrders * factors.Consommation.Ecommerce.Amazon
+func register(users store.UserStore, db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Email    string `json:"email" binding:"required"`
+			Username string `json:"username" binding:"required"`
+			Password string `json:"password" binding:"required"`
 		}
-		if leboncoinOrders, ok := input.UserInputs["leboncoinOrders"].(float64); ok {
-			result += leboncoinOrders * factors.Consommation.Ecommerce.LeBonCoin
+
+		if err := c.BindJSON(&input); err != nil {
+			c.JSON(400, gin.H{"error": "Email et mot de passe requis"})
+			return
 		}
-		if artisanatOrders, ok := input.UserInputs["artisanatOrders"].(float64); ok {
-			result += artisanatOrders * factors.Consommation.Ecommerce.Artisanat
+		if !validEmail(input.Email) {
+			c.JSON(400, gin.H{"error": "Adresse email invalide"})
+			return
 		}
-		if brocanteItems, ok := input.UserInputs["brocanteItems"].(float64); ok {
-			result += brocanteItems * factors.Consommation.Commerce.Brocante
+
+		// Hash du mot de passe
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+		if err != nil {
+			logging.Errorf("Erreur lors du hashage du mot de passe: %v", err)
+			c.JSON(500, gin.H{"error": "Impossible de créer l'utilisateur"})
+			return
 		}
-		if localShopOrders, ok := input.UserInputs["localShopOrders"].(float64); ok {
-			result += localShopOrders * factors.Consommation.Commerce.LocalShops
+
+		user := models.User{
+			ID:       uuid.New().String(),
+			Email:    input.Email,
+			Username: input.Username,
+			Password: string(hashedPassword),
+			Role:     models.RoleUser,
 		}
+		userID := user.ID
+		logging.Debugf("Tentative d'insertion utilisateur: ID=%s, Email=%s, Username=%s", userID, input.Email, input.Username)
 
-	case "Sport_loisirs":
-		if piscine, ok := input.UserInputs["piscine"].(float64); ok {
-			result += piscine * factors.SportLoisirs.Piscine
+		err = users.Create(&user)
+		if errors.Is(err, store.ErrEmailTaken) {
+			c.JSON(409, gin.H{"error": "Adresse email déjà utilisée"})
+			return
 		}
-		if skiDays, ok := input.UserInputs["skiDays"].(float64); ok {
-			result += skiDays * factors.SportLoisirs.Ski
+		if err != nil {
+			logging.Errorf("Erreur lors de l'insertion en base: %v", err)
+			c.JSON(500, gin.H{"error": "Impossible de créer l'utilisateur"})
+			return
 		}
-		if sportMecaniqueHours, ok := input.UserInputs["sportMecaniqueHours"].(float64); ok {
-			result += sportMecaniqueHours * factors.SportLoisirs.SportMecanique
+
+		// L'inscription aboutit même si l'email ne part pas ; il pourra être
+		// renvoyé depuis le compte
+		if err := handlers.SendVerification(c, db, userID, input.Email); err != nil {
+			logging.Errorf("Erreur lors de l'envoi de l'email de vérification: %v", err)
 		}
-		if salleDeSport, ok := input.UserInputs["salleDeSport"].(float64); ok {
-			result += salleDeSport * factors.SportLoisirs.SalleDeSport
+
+		tokens, err := startSession(c, db, userID, models.RoleUser)
+		if err != nil {
+			logging.Errorf("Erreur lors de l'ouverture de session: %v", err)
+			c.JSON(500, gin.H{"error": "Impossible d'ouvrir la session"})
+			return
 		}
-		if sportPleinAir, ok := input.UserInputs["sportPleinAir"].(float64); ok {
-			result += sportPleinAir * factors.SportLoisirs.SportPleinAir
+		tokens["user"] = gin.H{
+			"id":       userID,
+			"email":    input.Email,
+			"username": input.Username,
+			"role":     models.RoleUser,
 		}
+		c.JSON(200, tokens)
 	}
+}
 
-	c.JSON(200, gin.H{
-		"category": input.Category,
-		"result":   result,
-	})
+// validEmail accepte une adresse simple, sans nom affiché.
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
 }
 
-func getDefaultFactors() models.CarbonFactors {
-	factors := models.CarbonFactors{}
+// Hash bcrypt comparé quand l'identifiant ne correspond à aucun compte, pour
+// que la réponse prenne le même temps
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("mot de passe factice"), bcrypt.DefaultCost)
 
-	factors.Transports.Train = 0.014
-	factors.Transports.Flight = 0.285
-	factors.Transports.Car.Small = 0.1
-	factors.Transports.Car.Medium = 0.2
-	factors.Transports.Car.Big = 0.3
+// login accepte l'email ou le pseudonyme. Les erreurs sont identiques que le
+// compte existe ou non ; les échecs répétés bloquent le compte et l'IP pour
+// une durée croissante.
+func login(users store.UserStore, db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Identifier string `json:"identifier"`
+			Username   string `json:"username"` // ancien nom du champ
+			Password   string `json:"password"`
+		}
 
-	factors.LogementElectromenagers.Electricity = 0.57
-	factors.LogementElectromenagers.Gas = 0.2
-	factors.LogementElectromenagers.Apartment = 15
-	factors.LogementElectromenagers.House = 20
-	factors.LogementElectromenagers.Appliance = 0.5
-	factors.LogementElectromenagers.Electronic = 0.3
+		if err := c.BindJSON(&input); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid input"})
+			return
+		}
+		identifier := strings.TrimSpace(input.Identifier)
+		if identifier == "" {
+			identifier = strings.TrimSpace(input.Username)
+		}
+		if identifier == "" || input.Password == "" {
+			c.JSON(400, gin.H{"error": "Invalid input"})
+			return
+		}
 
-	factors.Alimentation.RedMeat = 27
-	factors.Alimentation.WhiteMeat = 6.9
-	factors.Alimentation.Pork = 7.2
-	factors.Alimentation.BulkFoodPurchase.None = 1
-	factors.Alimentation.BulkFoodPurchase.Partial = 0.9
-	factors.Alimentation.BulkFoodPurchase.Total = 0.8
+		now := time.Now().UTC()
+		attempt := loginguard.Attempt{
+			Identifier: identifier,
+			IP:         c.ClientIP(),
+			UserAgent:  c.Request.UserAgent(),
+			CreatedAt:  now,
+		}
 
-	factors.Alimentation.ShortCircuit.None = 1.0
-	factors.Alimentation.ShortCircuit.Partial = 0.9
-	factors.Alimentation.ShortCircuit.Majority = 0.8
+		ipKey := loginguard.IPKey(attempt.IP)
+		until, err := loginguard.LockedUntil(db, ipKey, now)
+		if err != nil {
+			logging.Errorf("Login - Erreur du verrouillage: %v", err)
+			c.JSON(500, gin.H{"error": "Database error"})
+			return
+		}
+		if !until.IsZero() {
+			attempt.Reason = loginguard.ReasonIPLocked
+			recordAttempt(db, attempt)
+			tooManyAttempts(c, until, now)
+			return
+		}
 
-	factors.Vetements.Large = 15
-	factors.Vetements.Small = 10
-	factors.Vetements.Madein.France = 1
-	factors.Vetements.Madein.Autre = 1.2
+		user, found, err := findLoginUser(users, identifier, input.Password)
+		if err != nil {
+			logging.Errorf("Login - Erreur de recherche: %v", err)
+			c.JSON(500, gin.H{"error": "Database error"})
+			return
+		}
 
-	factors.Numerique.GoogleSearch = 0.0002
-	factors.Numerique.ChatGPT = 0.000382
-	factors.Numerique.SocialMedia = 0.000380
-	factors.Numerique.Smartphone.Small = 35
-	factors.Numerique.Smartphone.Large = 75
-	factors.Numerique.Smartphone.Used = 0.5
-	factors.Numerique.Smartphone.Old = 0.5
+		accountKey := loginguard.IdentifierKey(identifier)
+		if user.ID != "" {
+			accountKey = loginguard.AccountKey(user.ID)
+			attempt.UserID = &user.ID
+		}
+		until, err = loginguard.LockedUntil(db, accountKey, now)
+		if err != nil {
+			logging.Errorf("Login - Erreur du verrouillage: %v", err)
+			c.JSON(500, gin.H{"error": "Database error"})
+			return
+		}
+		if !until.IsZero() {
+			attempt.Reason = loginguard.ReasonAccountLocked
+			recordAttempt(db, attempt)
+			tooManyAttempts(c, until, now)
+			return
+		}
 
-	factors.Consommation.Ecommerce.Amazon = 0.25
-	factors.Consommation.Ecommerce.LeBonCoin = 0.05
-	factors.Consommation.Ecommerce.Artisanat = 0.1
-	factors.Consommation.Commerce.Brocante = 0.03
-	factors.Consommation.Commerce.LocalShops = 0.08
+		if !found {
+			attempt.Reason = loginguard.ReasonInvalidCredentials
+			recordAttempt(db, attempt)
+			if err := loginguard.Fail(db, accountKey, loginguard.AccountPolicy, now); err != nil {
+				logging.Errorf("Login - Erreur du compteur d'échecs: %v", err)
+			}
+			if err := loginguard.Fail(db, ipKey, loginguard.IPPolicy, now); err != nil {
+				logging.Errorf("Login - Erreur du compteur d'échecs: %v", err)
+			}
+			c.JSON(401, gin.H{"error": "Identifiants invalides"})
+			return
+		}
 
-	factors.SportLoisirs.Piscine = 1
-	factors.SportLoisirs.Ski = 48.9
-	factors.SportLoisirs.SportMecanique = 10.0
-	factors.SportLoisirs.SalleDeSport = 1
-	factors.SportLoisirs.SportPleinAir = 0.0001
+		// Avec la double authentification, le mot de passe ne suffit pas : le
+		// client doit présenter un code avec le challenge à /login/2fa
+		enabled, err := twofactor.Enabled(db, user.ID)
+		if err != nil {
+			logging.Errorf("Login - Erreur de double authentification: %v", err)
+			c.JSON(500, gin.H{"error": "Database error"})
+			return
+		}
+		if enabled {
+			challenge, err := twofactor.CreateChallenge(db, user.ID)
+			if err != nil {
+				logging.Errorf("Login - Erreur de double authentification: %v", err)
+				c.JSON(500, gin.H{"error": "Database error"})
+				return
+			}
+			attempt.Reason = loginguard.ReasonSecondFactorRequired
+			recordAttempt(db, attempt)
+			c.JSON(200, gin.H{"twoFactorRequired": true, "challenge": challenge})
+			return
+		}
 
-	return factors
-}
+		if err := loginguard.Reset(db, accountKey); err != nil {
+			logging.Errorf("Login - Erreur de remise à zéro du compteur: %v", err)
+		}
+		attempt.Success = true
+		attempt.Reason = loginguard.ReasonSuccess
+		recordAttempt(db, attempt)
 
-func getCarbonFactors(c *gin.Context) {
-	factors := getDefaultFactors()
-	c.JSON(200, factors)
+		loginResponse(c, db, user)
+	}
 }
 
-func authMiddleware() gin.HandlerFunc {
+// loginTwoFactor termine une connexion avec double authentification : le
+// challenge reçu de /login et un code TOTP ou de secours.
+func loginTwoFactor(users store.UserStore, db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := c.GetHeader("Authorization")
-		if token == "" {
-			c.JSON(401, gin.H{"error": "Authorization required"})
-			c.Abort()
+		var input struct {
+			Challenge string `json:"challenge" binding:"required"`
+			Code      string `json:"code" binding:"required"`
+		}
+
+		if err := c.BindJSON(&input); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid input"})
 			return
 		}
-		// Vérifier le token JWT et ajouter l'userID au contexte
-		userID, err := validateToken(token)
+
+		now := time.Now().UTC()
+		attempt := loginguard.Attempt{
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			CreatedAt: now,
+		}
+
+		ipKey := loginguard.IPKey(attempt.IP)
+		until, err := loginguard.LockedUntil(db, ipKey, now)
 		if err != nil {
-			c.JSON(401, gin.H{"error": "Invalid token"})
-			c.Abort()
+			logging.Errorf("Login2FA - Erreur du verrouillage: %v", err)
+			c.JSON(500, gin.H{"error": "Database error"})
 			return
 		}
-		c.Set("userID", userID)
-		c.Next()
-	}
-}
+		if !until.IsZero() {
+			attempt.Reason = loginguard.ReasonIPLocked
+			recordAttempt(db, attempt)
+			tooManyAttempts(c, until, now)
+			return
+		}
+
+		userID, err := twofactor.CompleteChallenge(db, input.Challenge, input.Code)
+		if errors.Is(err, twofactor.ErrInvalidChallenge) {
+			c.JSON(401, gin.H{"error": err.Error()})
+			return
+		}
+
+		var user models.User
+		if userID != "" {
+			var scanErr error
+			user, scanErr = users.Get(userID)
+			if scanErr != nil {
+				logging.Errorf("Login2FA - Erreur de recherche: %v", scanErr)
+				c.JSON(500, gin.H{"error": "Database error"})
+				return
+			}
+			attempt.UserID = &user.ID
+			attempt.Identifier = user.Email
+		}
 
-func register(c *gin.Context) {
-	var input struct {
-		Email    string `json:"email" binding:"required"`
-		Username string `json:"username" binding:"required"`
-		Password string `json:"password" binding:"required"`
+		accountKey := loginguard.AccountKey(userID)
+		if errors.Is(err, twofactor.ErrInvalidCode) {
+			attempt.Reason = loginguard.ReasonInvalidSecondFactor
+			recordAttempt(db, attempt)
+			if err := loginguard.Fail(db, accountKey, loginguard.AccountPolicy, now); err != nil {
+				logging.Errorf("Login2FA - Erreur du compteur d'échecs: %v", err)
+			}
+			if err := loginguard.Fail(db, ipKey, loginguard.IPPolicy, now); err != nil {
+				logging.Errorf("Login2FA - Erreur du compteur d'échecs: %v", err)
+			}
+			c.JSON(401, gin.H{"error": "Code invalide"})
+			return
+		}
+		if err != nil {
+			logging.Errorf("Login2FA - Erreur: %v", err)
+			c.JSON(500, gin.H{"error": "Database error"})
+			return
+		}
+
+		if err := loginguard.Reset(db, accountKey); err != nil {
+			logging.Errorf("Login2FA - Erreur de remise à zéro du compteur: %v", err)
+		}
+		attempt.Success = true
+		attempt.Reason = loginguard.ReasonSuccess
+		recordAttempt(db, attempt)
+
+		loginResponse(c, db, user)
 	}
+}
 
-	if err := c.BindJSON(&input); err != nil {
-		c.JSON(400, gin.H{"error": "Email et mot de passe requis"})
+// loginResponse ouvre une session et renvoie les tokens et l'utilisateur.
+func loginResponse(c *gin.Context, db *sql.DB, user models.User) {
+	// Se reconnecter pendant le délai de grâce annule la suppression du compte
+	cancelled, err := privacy.CancelDeletion(db, user.ID)
+	if err != nil {
+		logging.Errorf("Erreur lors de l'annulation de la suppression: %v", err)
+		c.JSON(500, gin.H{"error": "Impossible d'ouvrir la session"})
 		return
 	}
+	if cancelled {
+		logging.Infof("Suppression du compte %s annulée par reconnexion", user.ID)
+	}
 
-	db := c.MustGet("db").(*sql.DB)
-
-	// Hash du mot de passe
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	tokens, err := startSession(c, db, user.ID, user.Role)
 	if err != nil {
-		log.Printf("Erreur lors du hashage du mot de passe: %v", err)
-		c.JSON(500, gin.H{"error": "Impossible de créer l'utilisateur"})
+		logging.Errorf("Erreur lors de l'ouverture de session: %v", err)
+		c.JSON(500, gin.H{"error": "Impossible d'ouvrir la session"})
 		return
 	}
+	tokens["deletionCancelled"] = cancelled
+	tokens["user"] = gin.H{
+		"id":       user.ID,
+		"email":    user.Email,
+		"username": user.Username,
+		"role":     user.Role,
+	}
+	c.JSON(200, tokens)
+}
 
-	userID := uuid.New().String()
-	log.Printf("Tentative d'insertion utilisateur: ID=%s, Email=%s, Username=%s", userID, input.Email, input.Username)
+// findLoginUser cherche le compte par email (sans tenir compte de la casse)
+// ou par pseudonyme et vérifie le mot de passe. Plusieurs comptes pouvant
+// partager un pseudonyme, le premier dont le mot de passe correspond est
+// retenu ; à défaut, user désigne le premier candidat et found est faux.
+func findLoginUser(users store.UserStore, identifier, password string) (user models.User, found bool, err error) {
+	candidates, err := users.FindByLogin(identifier)
+	if err != nil {
+		return user, false, err
+	}
 
-	_, err = db.Exec(`
-		INSERT INTO users (id, email, username, password)
-		VALUES ($1, $2, $3, $4)
-	`, userID, input.Email, input.Username, string(hashedPassword))
+	if len(candidates) == 0 {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return user, false, nil
+	}
+	for _, candidate := range candidates {
+		if bcrypt.CompareHashAndPassword([]byte(candidate.Password), []byte(password)) == nil {
+			return candidate, true, nil
+		}
+	}
+	return candidates[0], false, nil
+}
 
-	if err != nil {
-		log.Printf("Erreur lors de l'insertion en base: %v", err)
-		c.JSON(500, gin.H{"error": "Impossible de créer l'utilisateur"})
-		return
+func recordAttempt(db *sql.DB, attempt loginguard.Attempt) {
+	if err := loginguard.Record(db, attempt); err != nil {
+		logging.Errorf("Login - Erreur du journal des tentatives: %v", err)
 	}
+}
 
-	token := generateToken(userID)
-	c.JSON(200, gin.H{
-		"token": token,
-		"user": gin.H{
-			"id":       userID,
-			"email":    input.Email,
-			"username": input.Username,
-		},
-	})
+func tooManyAttempts(c *gin.Context, until, now time.Time) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(until.Sub(now).Seconds()))))
+	c.JSON(429, gin.H{"error": "Trop de tentatives, réessayez plus tard"})
 }
 
-func login(c *gin.Context) {
-	var input struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
+// startSession ouvre une session pour l'utilisateur et renvoie l'access token
+// et le refresh token.
+func startSession(c *gin.Context, db *sql.DB, userID, role string) (gin.H, error) {
+	session, refresh, err := sessions.Create(db, userID, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		return nil, err
 	}
+	session.Role = role
+	return sessionTokens(session, refresh)
+}
 
-	if err := c.BindJSON(&input); err != nil {
-		c.JSON(400, gin.H{"error": "Invalid input"})
-		return
+func sessionTokens(session sessions.Session, refresh string) (gin.H, error) {
+	token := generateToken(session)
+	if token == "" {
+		return nil, fmt.Errorf("génération du token impossible")
 	}
+	return gin.H{
+		"token":        token,
+		"refreshToken": refresh,
+		"expiresIn":    int(accessTokenTTL.Seconds()),
+	}, nil
+}
 
-	db := c.MustGet("db").(*sql.DB)
-	var user models.User
-	err := db.QueryRow(
-		"SELECT id, email, username, password FROM users WHERE username = $1",
-		input.Username,
-	).Scan(&user.ID, &user.Email, &user.Username, &user.Password)
+// refreshToken échange un refresh token contre une nouvelle paire de tokens.
+// L'ancien refresh token et l'access token associé deviennent invalides.
+func refreshToken(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			RefreshToken string `json:"refreshToken" binding:"required"`
+		}
 
-	if err != nil {
-		c.JSON(401, gin.H{"error": "User not found"})
-		return
+		if err := c.BindJSON(&input); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		session, refresh, err := sessions.Rotate(db, input.RefreshToken)
+		if errors.Is(err, sessions.ErrReused) {
+			logging.Warnf("RefreshToken - Réutilisation détectée, session révoquée")
+		}
+		if errors.Is(err, sessions.ErrInvalid) || errors.Is(err, sessions.ErrReused) || errors.Is(err, sessions.ErrRevoked) {
+			c.JSON(401, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		if err != nil {
+			logging.Errorf("RefreshToken - Erreur: %v", err)
+			c.JSON(500, gin.H{"error": "Impossible de renouveler la session"})
+			return
+		}
+
+		tokens, err := sessionTokens(session, refresh)
+		if err != nil {
+			logging.Errorf("RefreshToken - Erreur: %v", err)
+			c.JSON(500, gin.H{"error": "Impossible de renouveler la session"})
+			return
+		}
+		c.JSON(200, tokens)
 	}
+}
 
-	// Vérifier le mot de passe
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
-		c.JSON(401, gin.H{"error": "Invalid password"})
-		return
+func logout(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := sessions.Revoke(db, c.GetString("sessionID")); err != nil {
+			logging.Errorf("Logout - Erreur: %v", err)
+			c.JSON(500, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.JSON(200, gin.H{"message": "Déconnecté"})
 	}
+}
 
-	// Générer un nouveau token
-	token := generateToken(user.ID)
+// logoutAll ferme toutes les sessions de l'utilisateur, sur tous les appareils.
+func logoutAll(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := sessions.RevokeAll(db, c.GetString("userID")); err != nil {
+			logging.Errorf("LogoutAll - Erreur: %v", err)
+			c.JSON(500, gin.H{"error": "Database error"})
+			return
+		}
 
-	c.JSON(200, gin.H{
-		"token": token,
-		"user": gin.H{
-			"id":       user.ID,
-			"email":    user.Email,
-			"username": user.Username,
-		},
-	})
+		c.JSON(200, gin.H{"message": "Toutes les sessions ont été fermées"})
+	}
 }
 
-func saveResult(c *gin.Context) {
-	db := c.MustGet("db").(*sql.DB)
-	userID, _ := c.Get("userID")
+// saveResult enregistre le résultat d'un mois et d'une catégorie. Pour
+// remplacer un résultat existant, la requête indique la révision attendue,
+// dans l'en-tête If-Match ou le champ revision : l'enregistrement est refusé
+// si le résultat a changé depuis, par exemple dans un autre onglet. Sans
+// révision, seul un nouveau résultat est accepté ; If-Match: * remplace le
+// résultat quel qu'il soit.
+func saveResult(results store.ResultStore, db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+
+		revision, ok := handlers.OptionalIfMatch(c)
+		if !ok {
+			return
+		}
+
+		var input struct {
+			Category string         `json:"category"`
+			Value    *float64       `json:"value"`
+			Inputs   map[string]any `json:"inputs"`
+			Month    string         `json:"month"` // Format: "2024-01"
+			Revision int            `json:"revision"`
+		}
+
+		if err := c.BindJSON(&input); err != nil {
+			logging.Errorf("SaveResult - Erreur de binding: %v", err)
+			c.JSON(400, gin.H{"error": "Données invalides"})
+			return
+		}
+		anyRevision := strings.TrimSpace(c.GetHeader("If-Match")) == "*"
+		if revision == 0 && !anyRevision {
+			revision = input.Revision
+		}
+		if revision < 0 {
+			c.JSON(400, gin.H{"error": "Révision invalide"})
+			return
+		}
+
+		monthDate, err := time.Parse("2006-01", input.Month)
+		if err != nil {
+			logging.Errorf("SaveResult - Erreur de parsing du mois: %v", err)
+			c.JSON(400, gin.H{"error": "Format de mois invalide"})
+			return
+		}
+
+		result := models.Result{
+			UserID:    userID,
+			Category:  input.Category,
+			Month:     monthDate,
+			CreatedAt: time.Now().UTC(),
+		}
+		set, computed, ok := computeResult(c, db, &result, input.Value, input.Inputs)
+		if !ok {
+			return
+		}
+
+		change := store.Change{By: userID, Source: store.SourceSave}
+		switch {
+		case revision > 0:
+			err = updateExisting(results, &result, revision, change)
+		case anyRevision:
+			err = results.Upsert(&result, change)
+		default:
+			err = results.Insert(&result, change)
+			if errors.Is(err, store.ErrConflict) {
+				c.JSON(428, gin.H{"error": "Un résultat existe déjà pour ce mois et cette catégorie, indiquez sa révision pour le remplacer"})
+				return
+			}
+		}
+		if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrConflict) {
+			resultError(c, store.ErrConflict, "SaveResult")
+			return
+		}
+		if err != nil {
+			logging.Errorf("SaveResult - Erreur d'insertion/update: %v", err)
+			c.JSON(500, gin.H{"error": "Erreur lors de la sauvegarde"})
+			return
+		}
 
-	var input struct {
-		Category string         `json:"category"`
-		Value    float64        `json:"value"`
-		Inputs   map[string]any `json:"inputs"`
-		Month    string         `json:"month"` // Format: "2024-01"
+		c.Header("ETag", handlers.ResultETag(result))
+		c.JSON(200, gin.H{
+			"id":          result.ID,
+			"revision":    result.Revision,
+			"value":       computed.Value,
+			"flagged":     result.Flagged,
+			"factorSetId": set.ID,
+			"breakdown":   computed.Lines,
+			"message":     "Résultat sauvegardé avec succès",
+		})
 	}
+}
 
-	if err := c.BindJSON(&input); err != nil {
-		log.Printf("SaveResult - Erreur de binding: %v", err)
-		c.JSON(400, gin.H{"error": "Données invalides"})
-		return
+// updateExisting remplace le résultat du même mois et de la même catégorie
+// s'il en est à la révision attendue. Un résultat absent, par exemple supprimé
+// entre-temps, donne ErrNotFound.
+func updateExisting(results store.ResultStore, result *models.Result, revision int, change store.Change) error {
+	existing, err := results.Find(result.UserID, store.ResultQuery{
+		From:       &result.Month,
+		To:         &result.Month,
+		Categories: []string{result.Category},
+	})
+	if err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return store.ErrNotFound
+	}
+	result.ID = existing[0].ID
+	return results.Update(result, revision, change)
+}
+
+// computeResult valide les données saisies pour la catégorie et le mois du
+// résultat, puis renseigne sa valeur recalculée côté serveur, son détail et
+// son jeu de facteurs. En cas d'échec, la réponse est déjà envoyée.
+func computeResult(c *gin.Context, db *sql.DB, result *models.Result, value *float64, inputs map[string]any) (models.FactorSet, calculator.Result, bool) {
+	if errs := calculator.Validate(result.Category, inputs); len(errs) > 0 {
+		c.JSON(422, gin.H{"error": "Données invalides", "fields": errs})
+		return models.FactorSet{}, calculator.Result{}, false
 	}
 
-	monthDate, err := time.Parse("2006-01", input.Month)
+	inputsJSON, err := json.Marshal(inputs)
 	if err != nil {
-		log.Printf("SaveResult - Erreur de parsing du mois: %v", err)
-		c.JSON(400, gin.H{"error": "Format de mois invalide"})
-		return
+		logging.Errorf("Résultats - Erreur de marshalling des inputs: %v", err)
+		c.JSON(500, gin.H{"error": "Erreur lors de la sauvegarde"})
+		return models.FactorSet{}, calculator.Result{}, false
 	}
 
-	inputsJSON, err := json.Marshal(input.Inputs)
+	// Détail du calcul avec le jeu de facteurs du mois, conservé pour pouvoir
+	// expliquer le résultat plus tard
+	set, computed, err := computeForMonth(db, result.Category, inputs, result.Month)
 	if err != nil {
-		log.Printf("SaveResult - Erreur de marshalling des inputs: %v", err)
+		logging.Errorf("Résultats - Erreur de calcul: %v", err)
 		c.JSON(500, gin.H{"error": "Erreur lors de la sauvegarde"})
-		return
+		return set, computed, false
 	}
 
-	// Utiliser UPSERT pour mettre à jour ou insérer
-	query := `
-		INSERT INTO results (id, user_id, category, value, inputs, month, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		ON CONFLICT (user_id, category, month)
-		DO UPDATE SET
-			value = EXCLUDED.value,
-			inputs = EXCLUDED.inputs,
-			created_at = EXCLUDED.created_at
-	`
-
-	resultID := uuid.New().String()
-	_, err = db.Exec(query,
-		resultID,
-		userID,
-		input.Category,
-		input.Value,
-		inputsJSON,
-		monthDate,
-		time.Now(),
-	)
+	// La valeur enregistrée est toujours celle recalculée par le serveur
+	var submittedValue *float64
+	flagged := false
+	if value == nil {
+		if !resultValueFill {
+			c.JSON(400, gin.H{"error": "Valeur requise"})
+			return set, computed, false
+		}
+	} else if !sameValue(*value, computed.Value) {
+		if resultValuePolicy == config.ValuePolicyReject {
+			logging.Warnf("Résultats - Valeur rejetée: envoyée=%f recalculée=%f", *value, computed.Value)
+			c.JSON(422, gin.H{
+				"error":    "La valeur ne correspond pas au calcul serveur",
+				"value":    *value,
+				"computed": computed.Value,
+			})
+			return set, computed, false
+		}
+		submittedValue = value
+		flagged = true
+	}
 
+	breakdownJSON, err := json.Marshal(computed.Lines)
 	if err != nil {
-		log.Printf("SaveResult - Erreur d'insertion/update: %v", err)
+		logging.Errorf("Résultats - Erreur de marshalling du détail: %v", err)
 		c.JSON(500, gin.H{"error": "Erreur lors de la sauvegarde"})
-		return
+		return set, computed, false
 	}
 
-	c.JSON(200, gin.H{
-		"id":      resultID,
-		"message": "Résultat sauvegardé avec succès",
-	})
+	result.Value = computed.Value
+	result.Inputs = inputsJSON
+	result.FactorSetID = &set.ID
+	result.Breakdown = breakdownJSON
+	result.SubmittedValue = submittedValue
+	result.Flagged = flagged
+	return set, computed, true
 }
 
-func getResults(c *gin.Context) {
-	userID, _ := c.Get("userID")
-	db := c.MustGet("db").(*sql.DB)
+// sameValue compare une valeur envoyée par le client à la valeur recalculée,
+// avec une tolérance relative pour absorber les arrondis.
+func sameValue(submitted, computed float64) bool {
+	return math.Abs(submitted-computed) <= valueTolerance*math.Max(1, math.Abs(computed))
+}
 
-	log.Printf("GetResults - Récupération des résultats pour userID: %s", userID)
+// resultError répond à une erreur du magasin de résultats.
+func resultError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		c.JSON(404, gin.H{"error": "Résultat introuvable"})
+	case errors.Is(err, store.ErrConflict):
+		c.JSON(412, gin.H{"error": "Le résultat a été modifié entre-temps, rechargez-le avant de réessayer"})
+	default:
+		logging.Errorf("%s - Erreur: %v", action, err)
+		c.JSON(500, gin.H{"error": "Erreur lors de l'accès au résultat"})
+	}
+}
 
-	rows, err := db.Query(`
-		SELECT 
-			id,
-			category,
-			value,
-			inputs,
-			month,
-			created_at
-		FROM results 
-		WHERE user_id = $1
-		ORDER BY month DESC, category
-	`, userID)
+func getResult(results store.ResultStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := results.Get(c.GetString("userID"), c.Param("id"))
+		if err != nil {
+			resultError(c, err, "GetResult")
+			return
+		}
 
-	if err != nil {
-		log.Printf("Erreur lors de la récupération des résultats: %v", err)
-		c.JSON(500, gin.H{"error": "Impossible de récupérer les résultats"})
-		return
+		c.Header("ETag", handlers.ResultETag(result))
+		c.JSON(200, result)
 	}
-	defer rows.Close()
+}
+
+// updateResult remplace les données d'un mois et d'une catégorie existants ;
+// la modification est refusée si le résultat a changé depuis la révision de
+// l'en-tête If-Match.
+func updateResult(results store.ResultStore, db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+
+		revision, ok := handlers.IfMatch(c)
+		if !ok {
+			return
+		}
+
+		var input struct {
+			Value  *float64       `json:"value"`
+			Inputs map[string]any `json:"inputs"`
+		}
+		if err := c.BindJSON(&input); err != nil {
+			logging.Errorf("UpdateResult - Erreur de binding: %v", err)
+			c.JSON(400, gin.H{"error": "Données invalides"})
+			return
+		}
 
-	var results []models.Result
-	for rows.Next() {
-		var result models.Result
-		err := rows.Scan(&result.ID, &result.Category, &result.Value, &result.Inputs, &result.Month, &result.CreatedAt)
+		result, err := results.Get(userID, c.Param("id"))
 		if err != nil {
-			log.Printf("Erreur lors du scan des résultats: %v", err)
-			continue
+			resultError(c, err, "UpdateResult")
+			return
+		}
+		if revision > 0 && revision != result.Revision {
+			resultError(c, store.ErrConflict, "UpdateResult")
+			return
+		}
+
+		set, computed, ok := computeResult(c, db, &result, input.Value, input.Inputs)
+		if !ok {
+			return
 		}
-		log.Printf("GetResults - Résultat trouvé: %+v", result)
-		results = append(results, result)
-	}
 
-	log.Printf("GetResults - Nombre total de résultats: %d", len(results))
-	c.JSON(200, results)
+		err = results.Update(&result, revision, store.Change{By: userID, Source: store.SourceSave})
+		if err != nil {
+			resultError(c, err, "UpdateResult")
+			return
+		}
+
+		c.Header("ETag", handlers.ResultETag(result))
+		c.JSON(200, gin.H{
+			"result":      result,
+			"factorSetId": set.ID,
+			"breakdown":   computed.Lines,
+		})
+	}
 }
 
-func validateToken(tokenStr string) (string, error) {
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
+// deleteResult supprime un résultat à la révision de l'en-tête If-Match ; son
+// historique est conservé.
+func deleteResult(results store.ResultStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		revision, ok := handlers.IfMatch(c)
+		if !ok {
+			return
+		}
 
-	if err != nil {
-		log.Printf("Erreur parsing token: %v", err)
-		return "", err
+		if err := results.Delete(c.GetString("userID"), c.Param("id"), revision); err != nil {
+			resultError(c, err, "DeleteResult")
+			return
+		}
+
+		c.JSON(200, gin.H{"message": "Résultat supprimé"})
 	}
+}
 
-	if !token.Valid {
-		return "", fmt.Errorf("token invalide")
+// deleteMonthResults supprime toutes les catégories d'un mois. Le corps
+// indique la révision attendue de chaque résultat du mois, par ID : si le
+// mois a changé depuis, par exemple dans un autre onglet, rien n'est
+// supprimé. If-Match: * supprime le mois sans vérification.
+func deleteMonthResults(results store.ResultStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		month, err := time.Parse("2006-01", c.Query("month"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Paramètre month requis au format AAAA-MM"})
+			return
+		}
+
+		var expected map[string]int
+		if strings.TrimSpace(c.GetHeader("If-Match")) != "*" {
+			var input struct {
+				Revisions map[string]int `json:"revisions"`
+			}
+			if err := c.ShouldBindJSON(&input); err != nil || input.Revisions == nil {
+				c.JSON(428, gin.H{"error": "Révisions requises : indiquez la révision de chaque résultat du mois dans revisions"})
+				return
+			}
+			expected = input.Revisions
+		}
+
+		deleted, err := results.DeleteMonth(c.GetString("userID"), month, expected)
+		if err != nil {
+			resultError(c, err, "DeleteMonthResults")
+			return
+		}
+
+		c.JSON(200, gin.H{"deleted": deleted, "message": "Résultats du mois supprimés"})
 	}
+}
+
+// Taille des pages de GET /api/results
+const (
+	defaultResultsLimit = 100
+	maxResultsLimit     = 500
+)
 
-	return claims.UserID, nil
+// encodeResultCursor rend opaque la position (mois, catégorie) d'un résultat.
+func encodeResultCursor(result models.Result) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(result.Month.Format("2006-01") + "|" + result.Category))
 }
 
-func generateToken(userID string) string {
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
-		UserID: userID,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
-		},
+func decodeResultCursor(cursor string) (*store.ResultCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	monthPart, category, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, errors.New("curseur incomplet")
+	}
+	month, err := time.Parse("2006-01", monthPart)
 	if err != nil {
-		log.Printf("Erreur génération token: %v", err)
-		return ""
+		return nil, err
 	}
-
-	return tokenString
+	return &store.ResultCursor{Month: month, Category: category}, nil
 }
 
-func verifyToken(c *gin.Context) {
-	token := c.GetHeader("Authorization")
-	if token == "" {
-		c.JSON(401, gin.H{"error": "No token provided"})
-		return
+// resultQuery lit les paramètres de GET /api/results : from et to (mois
+// AAAA-MM inclus), category (répété ou séparé par des virgules), order
+// (desc par défaut, ou asc), limit et cursor. La requête demande un résultat
+// de plus que la page pour savoir s'il en reste.
+func resultQuery(c *gin.Context) (store.ResultQuery, int, bool) {
+	var q store.ResultQuery
+	for _, param := range []struct {
+		name string
+		dest **time.Time
+	}{{"from", &q.From}, {"to", &q.To}} {
+		if value := c.Query(param.name); value != "" {
+			month, err := time.Parse("2006-01", value)
+			if err != nil {
+				c.JSON(400, gin.H{"error": fmt.Sprintf("Paramètre %s invalide, format attendu AAAA-MM", param.name)})
+				return q, 0, false
+			}
+			*param.dest = &month
+		}
 	}
 
-	// Enlever le préfixe "Bearer " si présent
-	if len(token) > 7 && token[:7] == "Bearer " {
-		token = token[7:]
+	for _, value := range c.QueryArray("category") {
+		for _, category := range strings.Split(value, ",") {
+			if category = strings.TrimSpace(category); category != "" {
+				q.Categories = append(q.Categories, category)
+			}
+		}
 	}
 
-	userID, err := validateToken(token)
-	if err != nil {
-		c.JSON(401, gin.H{"error": "Invalid token"})
-		return
+	switch c.DefaultQuery("order", "desc") {
+	case "desc":
+	case "asc":
+		q.Ascending = true
+	default:
+		c.JSON(400, gin.H{"error": "Paramètre order invalide, valeurs possibles : asc, desc"})
+		return q, 0, false
 	}
 
-	// Récupérer l'utilisateur depuis la base de données
-	db := c.MustGet("db").(*sql.DB)
-	var user models.User
-	err = db.QueryRow("SELECT id, email, username FROM users WHERE id = $1", userID).Scan(&user.ID, &user.Email, &user.Username)
-	if err != nil {
-		log.Printf("Erreur de recherche utilisateur: %v", err)
-		c.JSON(401, gin.H{"error": "User not found"})
-		return
+	limit := defaultResultsLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxResultsLimit {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Paramètre limit invalide, entre 1 et %d", maxResultsLimit)})
+			return q, 0, false
+		}
+		limit = parsed
 	}
+	q.Limit = limit + 1
 
-	c.JSON(200, user)
+	if value := c.Query("cursor"); value != "" {
+		after, err := decodeResultCursor(value)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Curseur invalide"})
+			return q, 0, false
+		}
+		q.After = after
+	}
+	return q, limit, true
 }
 
-func updateUserProfile(c *gin.Context) {
-	var input struct {
-		Username string `json:"username"`
-		Email    string `json:"email"`
-	}
+func getResults(results store.ResultStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q, limit, ok := resultQuery(c)
+		if !ok {
+			return
+		}
 
-	if err := c.BindJSON(&input); err != nil {
-		c.JSON(400, gin.H{"error": "Invalid input"})
-		return
-	}
+		list, err := results.Find(c.GetString("userID"), q)
+		if err != nil {
+			logging.Errorf("GetResults - Erreur: %v", err)
+			c.JSON(500, gin.H{"error": "Impossible de récupérer les résultats"})
+			return
+		}
+
+		var nextCursor *string
+		hasMore := len(list) > limit
+		if hasMore {
+			list = list[:limit]
+			cursor := encodeResultCursor(list[len(list)-1])
+			nextCursor = &cursor
+		}
 
-	userID := c.GetString("userID")
-	db := c.MustGet("db").(*sql.DB)
+		c.JSON(200, gin.H{
+			"results": list,
+			"pagination": gin.H{
+				"limit":      limit,
+				"count":      len(list),
+				"hasMore":    hasMore,
+				"nextCursor": nextCursor,
+			},
+		})
+	}
+}
 
-	_, err := db.Exec(
-		"UPDATE users SET username = $1, email = $2 WHERE id = $3",
-		input.Username, input.Email, userID,
-	)
+func validateToken(tokenStr string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := signingKeys.Parse(tokenStr, claims)
 
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Database error"})
-		return
+		logging.Errorf("Erreur parsing token: %v", err)
+		return nil, err
 	}
 
-	c.JSON(200, gin.H{
-		"id":       userID,
-		"username": input.Username,
-		"email":    input.Email,
-	})
-}
-
-func updateUserPassword(c *gin.Context) {
-	var input struct {
-		CurrentPassword string `json:"currentPassword"`
-		NewPassword     string `json:"newPassword"`
+	if !token.Valid {
+		return nil, fmt.Errorf("token invalide")
 	}
 
-	if err := c.BindJSON(&input); err != nil {
-		c.JSON(400, gin.H{"error": "Invalid input"})
-		return
+	// Les tokens émis avant l'ajout des rôles n'en portent pas
+	if claims.Role == "" {
+		claims.Role = models.RoleUser
 	}
 
-	userID := c.GetString("userID")
-	db := c.MustGet("db").(*sql.DB)
+	return claims, nil
+}
 
-	var storedHash string
-	err := db.QueryRow("SELECT password FROM users WHERE id = $1", userID).Scan(&storedHash)
+// authenticate valide le token puis vérifie que sa session est active et
+// qu'il n'a pas été remplacé par un rafraîchissement.
+func authenticate(db *sql.DB, tokenStr string) (*Claims, error) {
+	claims, err := validateToken(tokenStr)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Database error"})
-		return
+		return nil, err
 	}
-
-	if err := bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(input.CurrentPassword)); err != nil {
-		c.JSON(401, gin.H{"error": "Invalid current password"})
-		return
+	if err := sessions.Check(db, claims.SessionID, claims.Id); err != nil {
+		return nil, err
 	}
+	return claims, nil
+}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
-	if err != nil {
-		c.JSON(500, gin.H{"error": "Password hashing error"})
-		return
+func generateToken(session sessions.Session) string {
+	expirationTime := time.Now().Add(accessTokenTTL)
+	claims := &Claims{
+		UserID:    session.UserID,
+		Role:      session.Role,
+		SessionID: session.ID,
+		StandardClaims: jwt.StandardClaims{
+			Id:        session.AccessID,
+			ExpiresAt: expirationTime.Unix(),
+		},
 	}
 
-	_, err = db.Exec("UPDATE users SET password = $1 WHERE id = $2", string(hashedPassword), userID)
+	tokenString, err := signingKeys.Sign(claims)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Database error"})
-		return
+		logging.Errorf("Erreur génération token: %v", err)
+		return ""
 	}
 
-	c.JSON(200, gin.H{"message": "Password updated successfully"})
+	return tokenString
 }
 
-func deleteAllUsers(c *gin.Context) {
-	db := c.MustGet("db").(*sql.DB)
-	_, err := db.Exec("DELETE FROM users")
-	if err != nil {
-		c.JSON(500, gin.H{"error": "Impossible de supprimer les utilisateurs"})
-		return
-	}
-	c.JSON(200, gin.H{"message": "Tous les utilisateurs ont été supprimés"})
+func getJWKS(c *gin.Context) {
+	c.JSON(200, gin.H{"keys": signingKeys.JWKS()})
 }
 
-func getAllUsers(c *gin.Context) {
-	db := c.MustGet("db").(*sql.DB)
-	rows, err := db.Query("SELECT id, email, username FROM users")
-	if err != nil {
-		c.JSON(500, gin.H{"error": "Impossible de récupérer les utilisateurs"})
-		return
+func verifyToken(users store.UserStore, db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader("Authorization")
+		if token == "" {
+			c.JSON(401, gin.H{"error": "No token provided"})
+			return
+		}
+
+		// Enlever le préfixe "Bearer " si présent
+		if len(token) > 7 && token[:7] == "Bearer " {
+			token = token[7:]
+		}
+
+		claims, err := authenticate(db, token)
+		if err != nil {
+			c.JSON(401, gin.H{"error": "Invalid token"})
+			return
+		}
+
+		// Récupérer l'utilisateur depuis la base de données
+		user, err := users.Get(claims.UserID)
+		if err != nil {
+			logging.Errorf("Erreur de recherche utilisateur: %v", err)
+			c.JSON(401, gin.H{"error": "User not found"})
+			return
+		}
+
+		c.JSON(200, user)
 	}
-	defer rows.Close()
+}
+
+func updateUserProfile(users store.UserStore, db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Username string `json:"username"`
+			Email    string `json:"email"`
+		}
+
+		if err := c.BindJSON(&input); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		if !validEmail(input.Email) {
+			c.JSON(400, gin.H{"error": "Adresse email invalide"})
+			return
+		}
+
+		userID := c.GetString("userID")
+		previous, err := users.Get(userID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Database error"})
+			return
+		}
 
-	var users []gin.H
-	for rows.Next() {
-		var id, email, username string
-		if err := rows.Scan(&id, &email, &username); err != nil {
-			continue
+		// Une nouvelle adresse doit être vérifiée à nouveau
+		err = users.UpdateProfile(userID, input.Username, input.Email)
+		if errors.Is(err, store.ErrEmailTaken) {
+			c.JSON(409, gin.H{"error": "Adresse email déjà utilisée"})
+			return
+		}
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Database error"})
+			return
 		}
-		users = append(users, gin.H{
-			"id":       id,
-			"email":    email,
-			"username": username,
+
+		if input.Email != previous.Email {
+			if err := handlers.SendVerification(c, db, userID, input.Email); err != nil {
+				logging.Errorf("UpdateUserProfile - Erreur d'envoi de la vérification: %v", err)
+			}
+		}
+
+		c.JSON(200, gin.H{
+			"id":       userID,
+			"username": input.Username,
+			"email":    input.Email,
 		})
 	}
+}
+
+func updateUserPassword(users store.UserStore, db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			CurrentPassword string `json:"currentPassword"`
+			NewPassword     string `json:"newPassword"`
+		}
+
+		if err := c.BindJSON(&input); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		userID := c.GetString("userID")
+
+		user, err := users.Get(userID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Database error"})
+			return
+		}
+
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.CurrentPassword)); err != nil {
+			c.JSON(401, gin.H{"error": "Invalid current password"})
+			return
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Password hashing error"})
+			return
+		}
+
+		if err := users.UpdatePassword(userID, string(hashedPassword)); err != nil {
+			c.JSON(500, gin.H{"error": "Database error"})
+			return
+		}
+
+		// Un changement de mot de passe ferme toutes les sessions existantes ;
+		// une nouvelle session est ouverte pour l'appareil courant
+		if err := sessions.RevokeAll(db, userID); err != nil {
+			logging.Errorf("UpdateUserPassword - Erreur de révocation: %v", err)
+			c.JSON(500, gin.H{"error": "Database error"})
+			return
+		}
+		tokens, err := startSession(c, db, userID, c.GetString("role"))
+		if err != nil {
+			logging.Errorf("UpdateUserPassword - Erreur d'ouverture de session: %v", err)
+			c.JSON(500, gin.H{"error": "Database error"})
+			return
+		}
 
-	c.JSON(200, users)
+		tokens["message"] = "Password updated successfully"
+		c.JSON(200, tokens)
+	}
 }
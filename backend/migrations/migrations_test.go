@@ -0,0 +1,74 @@
+package migrations_test
+
+import (
+	"carbone-app/config"
+	"carbone-app/migrations"
+	"path/filepath"
+	"testing"
+)
+
+// Les deux pilotes doivent porter les mêmes migrations, sans quoi une base
+// ne pourrait pas passer de l'un à l'autre au même schéma.
+func TestDialectsMatch(t *testing.T) {
+	postgres, err := migrations.Load(config.DriverPostgres)
+	if err != nil {
+		t.Fatalf("Load(postgres): %v", err)
+	}
+	sqlite, err := migrations.Load(config.DriverSQLite)
+	if err != nil {
+		t.Fatalf("Load(sqlite): %v", err)
+	}
+
+	if len(postgres) != len(sqlite) {
+		t.Fatalf("postgres a %d migrations, sqlite %d", len(postgres), len(sqlite))
+	}
+	for i := range postgres {
+		p, s := postgres[i], sqlite[i]
+		if p.Version != s.Version || p.Name != s.Name {
+			t.Errorf("migration %d: postgres %04d_%s, sqlite %04d_%s", i, p.Version, p.Name, s.Version, s.Name)
+		}
+		if p.Down == "" || s.Down == "" {
+			t.Errorf("migration %04d_%s: fichier down manquant", p.Version, p.Name)
+		}
+	}
+}
+
+func TestSQLiteUpDown(t *testing.T) {
+	cfg := config.Default().Database
+	cfg.Driver = config.DriverSQLite
+	cfg.DSN = filepath.Join(t.TempDir(), "migrations.db")
+	db, err := config.InitDB(cfg)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	all, err := migrations.Load(config.DriverSQLite)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if n, err := migrations.Up(db, config.DriverSQLite); err != nil || n != len(all) {
+		t.Fatalf("Up = %d, %v; attendu %d", n, err, len(all))
+	}
+	if n, err := migrations.Up(db, config.DriverSQLite); err != nil || n != 0 {
+		t.Fatalf("second Up = %d, %v; attendu 0", n, err)
+	}
+
+	statuses, err := migrations.List(db, config.DriverSQLite)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	for _, s := range statuses {
+		if !s.Applied || s.AppliedAt == nil {
+			t.Errorf("migration %04d_%s non appliquée", s.Version, s.Name)
+		}
+	}
+
+	if n, err := migrations.Down(db, config.DriverSQLite, len(all)); err != nil || n != len(all) {
+		t.Fatalf("Down = %d, %v; attendu %d", n, err, len(all))
+	}
+	if n, err := migrations.Up(db, config.DriverSQLite); err != nil || n != len(all) {
+		t.Fatalf("Up après Down = %d, %v; attendu %d", n, err, len(all))
+	}
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS results CASCADE;
+DROP TABLE IF EXISTS users CASCADE;
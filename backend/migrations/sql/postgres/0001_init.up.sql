@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS users (
+	id UUID PRIMARY KEY,
+	email VARCHAR(255) UNIQUE NOT NULL,
+	username VARCHAR(50) NOT NULL,
+	password VARCHAR(255) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS results (
+	id UUID PRIMARY KEY,
+	user_id UUID REFERENCES users(id),
+	category VARCHAR(50) NOT NULL,
+	value FLOAT NOT NULL,
+	inputs JSONB,
+	month DATE NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(user_id, category, month)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE results DROP COLUMN IF EXISTS breakdown;
+ALTER TABLE results DROP COLUMN IF EXISTS factor_set_id;
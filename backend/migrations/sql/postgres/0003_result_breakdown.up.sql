@@ -0,0 +1,2 @@
+ALTER TABLE results ADD COLUMN IF NOT EXISTS factor_set_id UUID REFERENCES factor_sets(id);
+ALTER TABLE results ADD COLUMN IF NOT EXISTS breakdown JSONB;
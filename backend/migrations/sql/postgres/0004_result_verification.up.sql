@@ -0,0 +1,2 @@
+ALTER TABLE results ADD COLUMN IF NOT EXISTS submitted_value FLOAT;
+ALTER TABLE results ADD COLUMN IF NOT EXISTS flagged BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS carbon_factors (
+	id VARCHAR(100) PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	category VARCHAR(50) NOT NULL,
+	carbon_factor FLOAT NOT NULL,
+	unit VARCHAR(50) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS activities (
+	id SERIAL PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	activity_id VARCHAR(100) NOT NULL REFERENCES carbon_factors(id),
+	quantity FLOAT NOT NULL CHECK (quantity >= 0),
+	date DATE NOT NULL,
+	carbon_amount FLOAT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS activities_user_date_idx ON activities (user_id, date);
+
+-- Catalogue initial, repris des facteurs par défaut du calculateur
+INSERT INTO carbon_factors (id, name, category, carbon_factor, unit) VALUES
+	('train', 'Train', 'Transports', 0.014, 'km'),
+	('flight', 'Avion', 'Transports', 0.285, 'km'),
+	('car_small', 'Petite voiture', 'Transports', 0.1, 'km'),
+	('car_medium', 'Voiture moyenne', 'Transports', 0.2, 'km'),
+	('car_big', 'Grande voiture', 'Transports', 0.3, 'km'),
+	('red_meat', 'Viande rouge', 'Alimentation', 27, 'kg'),
+	('white_meat', 'Viande blanche', 'Alimentation', 6.9, 'kg'),
+	('pork', 'Porc', 'Alimentation', 7.2, 'kg'),
+	('clothing_large', 'Vêtement (grande pièce)', 'Vetements', 15, 'article'),
+	('clothing_small', 'Vêtement (petite pièce)', 'Vetements', 10, 'article'),
+	('smartphone_small', 'Smartphone (petit modèle)', 'Numerique', 35, 'appareil'),
+	('smartphone_large', 'Smartphone (grand modèle)', 'Numerique', 75, 'appareil'),
+	('amazon_order', 'Commande Amazon', 'Consommation', 0.25, 'commande'),
+	('leboncoin_order', 'Commande Leboncoin', 'Consommation', 0.05, 'commande'),
+	('artisanat_order', 'Commande artisanat', 'Consommation', 0.1, 'commande'),
+	('brocante_item', 'Achat en brocante', 'Consommation', 0.03, 'article'),
+	('local_shop_order', 'Achat en commerce local', 'Consommation', 0.08, 'achat'),
+	('ski_day', 'Journée de ski', 'Sport_loisirs', 48.9, 'jour')
+ON CONFLICT (id) DO NOTHING;
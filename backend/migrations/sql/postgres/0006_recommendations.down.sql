@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS recommendation_rules;
+DROP TABLE IF EXISTS recommendation_thresholds;
@@ -0,0 +1,59 @@
+CREATE TABLE IF NOT EXISTS recommendation_thresholds (
+	category VARCHAR(50) PRIMARY KEY,
+	threshold FLOAT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS recommendation_rules (
+	id UUID PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	category VARCHAR(50) NOT NULL,
+	condition JSONB NOT NULL,
+	actions JSONB NOT NULL,
+	priority INTEGER NOT NULL DEFAULT 0,
+	active BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+-- Seuils et actions jusqu'ici codés en dur dans la page facilitateur
+INSERT INTO recommendation_thresholds (category, threshold) VALUES
+	('Transports', 200),
+	('Logement_electromenagers', 300),
+	('Alimentation', 150),
+	('Vetements', 50),
+	('Numerique', 30),
+	('Consommation', 100)
+ON CONFLICT (category) DO NOTHING;
+
+INSERT INTO recommendation_rules (id, name, category, condition, actions, priority) VALUES
+	('00000000-0000-0000-0001-000000000001', 'Transports au-dessus du seuil', 'Transports',
+		'{"type": "above_threshold"}',
+		'[{"action": "Passer au vélo pour les trajets courts", "impact": "- 50 kg CO2/mois"}, {"action": "Privilégier le train à l''avion", "impact": "- 200 kg CO2/trajet", "changes": [{"input": "flightKm", "scale": 0}, {"input": "trainKm", "addFrom": "flightKm"}]}, {"action": "Opter pour le covoiturage", "impact": "- 30% d''émissions", "changes": [{"input": "carOccupants", "add": 1}]}]',
+		0),
+	('00000000-0000-0000-0001-000000000002', 'Trajets en avion importants', 'Transports',
+		'{"type": "input_above", "input": "flightKm", "value": 1000}',
+		'[{"action": "Remplacer les vols par le train", "changes": [{"input": "flightKm", "scale": 0}, {"input": "trainKm", "addFrom": "flightKm"}]}]',
+		10),
+	('00000000-0000-0000-0001-000000000003', 'Logement au-dessus du seuil', 'Logement_electromenagers',
+		'{"type": "above_threshold"}',
+		'[{"action": "Installer des LED", "impact": "- 80% sur l''éclairage"}, {"action": "Réduire le chauffage de 1°C", "impact": "- 7% sur le chauffage", "changes": [{"input": "gasKwh", "scale": 0.93}]}, {"action": "Isoler les fenêtres", "impact": "- 15% sur le chauffage", "changes": [{"input": "gasKwh", "scale": 0.85}]}]',
+		0),
+	('00000000-0000-0000-0001-000000000004', 'Alimentation au-dessus du seuil', 'Alimentation',
+		'{"type": "above_threshold"}',
+		'[{"action": "Réduire la viande rouge", "impact": "- 30 kg CO2/mois"}, {"action": "Revaloriser votre caca", "impact": "- 60 kg CO2/mois"}, {"action": "Privilégier le local", "impact": "- 20% sur l''alimentation", "changes": [{"input": "shortCircuit", "set": "majority"}]}, {"action": "Éviter le gaspillage", "impact": "- 15% sur l''alimentation"}]',
+		0),
+	('00000000-0000-0000-0001-000000000005', 'La viande rouge domine l''alimentation', 'Alimentation',
+		'{"type": "input_share", "input": "redMeatKg", "share": 0.5}',
+		'[{"action": "Diviser par deux la viande rouge", "changes": [{"input": "redMeatKg", "scale": 0.5}]}, {"action": "Remplacer la viande rouge par de la viande blanche", "changes": [{"input": "redMeatKg", "scale": 0}, {"input": "whiteMeatKg", "addFrom": "redMeatKg"}]}]',
+		10),
+	('00000000-0000-0000-0001-000000000006', 'Vêtements au-dessus du seuil', 'Vetements',
+		'{"type": "above_threshold"}',
+		'[{"action": "Acheter en seconde main", "impact": "- 70% sur les vêtements"}, {"action": "Réparer plutôt que remplacer", "impact": "- 40% sur les vêtements"}]',
+		0),
+	('00000000-0000-0000-0001-000000000007', 'Numérique au-dessus du seuil', 'Numerique',
+		'{"type": "above_threshold"}',
+		'[{"action": "Garder son smartphone plus longtemps", "impact": "- 30 kg CO2/an", "changes": [{"input": "smartphoneState", "set": "old"}]}, {"action": "Limiter le streaming", "impact": "- 5 kg CO2/mois"}]',
+		0),
+	('00000000-0000-0000-0001-000000000008', 'Consommation au-dessus du seuil', 'Consommation',
+		'{"type": "above_threshold"}',
+		'[{"action": "Privilégier l''occasion", "impact": "- 50% sur les achats", "changes": [{"input": "amazonOrders", "scale": 0}, {"input": "leboncoinOrders", "addFrom": "amazonOrders"}]}, {"action": "Acheter local", "impact": "- 30% sur le transport"}]',
+		0)
+ON CONFLICT (id) DO NOTHING;
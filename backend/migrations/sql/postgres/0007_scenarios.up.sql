@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS scenarios (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name VARCHAR(255) NOT NULL,
+	base_month DATE,
+	base_inputs JSONB NOT NULL,
+	overrides JSONB NOT NULL,
+	factor_set_id UUID REFERENCES factor_sets(id),
+	outcome JSONB NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS scenarios_user_idx ON scenarios (user_id, created_at);
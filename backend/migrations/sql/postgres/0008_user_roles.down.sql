@@ -0,0 +1,6 @@
+ALTER TABLE results DROP CONSTRAINT IF EXISTS results_user_id_fkey;
+ALTER TABLE results ADD CONSTRAINT results_user_id_fkey
+	FOREIGN KEY (user_id) REFERENCES users(id);
+
+ALTER TABLE users DROP COLUMN IF EXISTS created_at;
+ALTER TABLE users DROP COLUMN IF EXISTS role;
@@ -0,0 +1,8 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user'
+	CHECK (role IN ('user', 'facilitator', 'admin'));
+ALTER TABLE users ADD COLUMN IF NOT EXISTS created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+
+-- La suppression d'un utilisateur entraîne celle de ses résultats
+ALTER TABLE results DROP CONSTRAINT IF EXISTS results_user_id_fkey;
+ALTER TABLE results ADD CONSTRAINT results_user_id_fkey
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS result_revisions;
+ALTER TABLE results DROP COLUMN IF EXISTS revision;
+ALTER TABLE results DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,34 @@
+-- Historique des résultats : chaque enregistrement ou restauration ajoute une
+-- révision au lieu d'écraser silencieusement la précédente. revision est le
+-- numéro de la révision courante ; created_at reste la date de première
+-- saisie du mois, updated_at celle de la dernière modification.
+ALTER TABLE results ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+ALTER TABLE results ADD COLUMN IF NOT EXISTS revision INT NOT NULL DEFAULT 1;
+UPDATE results SET updated_at = COALESCE(created_at, CURRENT_TIMESTAMP) WHERE updated_at IS NULL;
+ALTER TABLE results ALTER COLUMN updated_at SET DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE results ALTER COLUMN updated_at SET NOT NULL;
+
+CREATE TABLE IF NOT EXISTS result_revisions (
+    id UUID PRIMARY KEY,
+    result_id UUID NOT NULL REFERENCES results(id) ON DELETE CASCADE,
+    revision INT NOT NULL,
+    value FLOAT NOT NULL,
+    inputs JSONB,
+    factor_set_id UUID REFERENCES factor_sets(id),
+    breakdown JSONB,
+    submitted_value FLOAT,
+    flagged BOOLEAN NOT NULL DEFAULT FALSE,
+    source VARCHAR(20) NOT NULL CHECK (source IN ('save', 'import', 'restore')),
+    restored_from INT,
+    changed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (result_id, revision)
+);
+
+-- L'état actuel des résultats existants devient leur première révision
+INSERT INTO result_revisions (id, result_id, revision, value, inputs, factor_set_id, breakdown,
+    submitted_value, flagged, source, changed_by, created_at)
+SELECT md5(id::text || ':1')::uuid, id, 1, value, inputs, factor_set_id, breakdown,
+    submitted_value, flagged, 'save', user_id, updated_at
+FROM results
+ON CONFLICT (result_id, revision) DO NOTHING;
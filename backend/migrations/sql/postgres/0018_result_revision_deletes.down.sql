@@ -0,0 +1,15 @@
+-- Les révisions des résultats supprimés n'ont plus de résultat auquel
+-- revenir
+DELETE FROM result_revisions WHERE result_id IS NULL OR source = 'delete';
+
+DROP INDEX IF EXISTS result_revisions_user_idx;
+ALTER TABLE result_revisions DROP CONSTRAINT IF EXISTS result_revisions_source_check;
+ALTER TABLE result_revisions ADD CONSTRAINT result_revisions_source_check
+    CHECK (source IN ('save', 'import', 'restore'));
+
+ALTER TABLE result_revisions DROP CONSTRAINT IF EXISTS result_revisions_result_id_fkey;
+ALTER TABLE result_revisions ADD CONSTRAINT result_revisions_result_id_fkey
+    FOREIGN KEY (result_id) REFERENCES results(id) ON DELETE CASCADE;
+ALTER TABLE result_revisions ALTER COLUMN result_id SET NOT NULL;
+
+ALTER TABLE result_revisions DROP COLUMN IF EXISTS user_id;
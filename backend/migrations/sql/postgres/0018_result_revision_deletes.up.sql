@@ -0,0 +1,19 @@
+-- La suppression d'un résultat ajoute une révision 'delete' et conserve son
+-- historique : les révisions perdent seulement leur lien avec le résultat.
+-- user_id les rattache au compte, dont la purge les supprime.
+ALTER TABLE result_revisions ADD COLUMN IF NOT EXISTS user_id UUID REFERENCES users(id) ON DELETE CASCADE;
+UPDATE result_revisions AS rv SET user_id = r.user_id
+FROM results AS r
+WHERE r.id = rv.result_id AND rv.user_id IS NULL;
+ALTER TABLE result_revisions ALTER COLUMN user_id SET NOT NULL;
+
+ALTER TABLE result_revisions ALTER COLUMN result_id DROP NOT NULL;
+ALTER TABLE result_revisions DROP CONSTRAINT IF EXISTS result_revisions_result_id_fkey;
+ALTER TABLE result_revisions ADD CONSTRAINT result_revisions_result_id_fkey
+    FOREIGN KEY (result_id) REFERENCES results(id) ON DELETE SET NULL;
+
+ALTER TABLE result_revisions DROP CONSTRAINT IF EXISTS result_revisions_source_check;
+ALTER TABLE result_revisions ADD CONSTRAINT result_revisions_source_check
+    CHECK (source IN ('save', 'import', 'restore', 'delete'));
+
+CREATE INDEX IF NOT EXISTS result_revisions_user_idx ON result_revisions (user_id);
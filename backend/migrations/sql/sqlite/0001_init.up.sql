@@ -0,0 +1,22 @@
+-- Schéma SQLite : les UUID et les documents JSON sont stockés en TEXT, les
+-- dates (DATE) au format AAAA-MM-JJ pour que l'unicité et les comparaisons
+-- portent sur le jour. SQLite ne sait pas modifier une clé étrangère : la
+-- suppression en cascade des résultats, ajoutée par 0008 sous PostgreSQL,
+-- est déclarée dès ici.
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	email TEXT UNIQUE NOT NULL,
+	username TEXT NOT NULL,
+	password TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS results (
+	id TEXT PRIMARY KEY,
+	user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+	category TEXT NOT NULL,
+	value REAL NOT NULL,
+	inputs TEXT,
+	month DATE NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(user_id, category, month)
+);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS factor_sets;
@@ -0,0 +1,95 @@
+CREATE TABLE IF NOT EXISTS factor_sets (
+	id TEXT PRIMARY KEY,
+	version TEXT UNIQUE NOT NULL,
+	source TEXT NOT NULL DEFAULT '',
+	valid_from DATE NOT NULL,
+	valid_to DATE,
+	status TEXT NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'published')),
+	factors TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	published_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS factor_sets_validity_idx ON factor_sets (status, valid_from);
+
+-- Jeu de facteurs historique, jusqu'ici compilé dans le binaire
+INSERT INTO factor_sets (id, version, source, valid_from, status, factors, published_at)
+VALUES (
+	'00000000-0000-0000-0000-000000000001',
+	'2024.1',
+	'Facteurs par défaut historiques du calculateur',
+	'2000-01-01',
+	'published',
+	'{
+		"Transports": {
+			"train": 0.014,
+			"flight": 0.285,
+			"car": {
+				"small": 0.1,
+				"medium": 0.2,
+				"big": 0.3
+			}
+		},
+		"Logement_electromenagers": {
+			"electricity": 0.57,
+			"gas": 0.2,
+			"apartment": 15,
+			"house": 20,
+			"appliance": 0.5,
+			"electronic": 0.3
+		},
+		"Alimentation": {
+			"redMeat": 27,
+			"whiteMeat": 6.9,
+			"pork": 7.2,
+			"bulkFoodPurchase": {
+				"none": 1,
+				"partial": 0.9,
+				"total": 0.8
+			},
+			"shortCircuit": {
+				"none": 1,
+				"partial": 0.9,
+				"majority": 0.8
+			}
+		},
+		"Vetements": {
+			"large": 15,
+			"small": 10,
+			"madein": {
+				"france": 1,
+				"autre": 1.2
+			}
+		},
+		"Numerique": {
+			"googleSearch": 0.0002,
+			"chatGPT": 0.000382,
+			"socialMedia": 0.00038,
+			"smartphone": {
+				"small": 35,
+				"large": 75,
+				"used": 0.5,
+				"old": 0.5
+			}
+		},
+		"Consommation": {
+			"ecommerce": {
+				"amazon": 0.25,
+				"leboncoin": 0.05,
+				"artisanat": 0.1
+			},
+			"commerce": {
+				"brocante": 0.03,
+				"localShops": 0.08
+			}
+		},
+		"SportLoisirs": {
+			"piscine": 1,
+			"ski": 48.9,
+			"sportMecanique": 10,
+			"salleDeSport": 1,
+			"sportPleinAir": 0.0001
+		}
+	}',
+	CURRENT_TIMESTAMP
+);
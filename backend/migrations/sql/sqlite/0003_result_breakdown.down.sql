@@ -0,0 +1,2 @@
+ALTER TABLE results DROP COLUMN breakdown;
+ALTER TABLE results DROP COLUMN factor_set_id;
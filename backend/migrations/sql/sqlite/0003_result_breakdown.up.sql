@@ -0,0 +1,2 @@
+ALTER TABLE results ADD COLUMN factor_set_id TEXT REFERENCES factor_sets(id);
+ALTER TABLE results ADD COLUMN breakdown TEXT;
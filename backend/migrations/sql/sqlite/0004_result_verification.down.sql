@@ -0,0 +1,2 @@
+ALTER TABLE results DROP COLUMN flagged;
+ALTER TABLE results DROP COLUMN submitted_value;
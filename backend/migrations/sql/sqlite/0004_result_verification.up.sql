@@ -0,0 +1,2 @@
+ALTER TABLE results ADD COLUMN submitted_value REAL;
+ALTER TABLE results ADD COLUMN flagged BOOLEAN NOT NULL DEFAULT 0;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS scenarios (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	base_month DATE,
+	base_inputs TEXT NOT NULL,
+	overrides TEXT NOT NULL,
+	factor_set_id TEXT REFERENCES factor_sets(id),
+	outcome TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS scenarios_user_idx ON scenarios (user_id, created_at);
@@ -0,0 +1,7 @@
+-- SQLite n'accepte pas CURRENT_TIMESTAMP comme valeur par défaut d'une
+-- colonne ajoutée : les comptes existants sont datés par l'UPDATE, les
+-- nouveaux par l'application. La cascade des résultats est déclarée par 0001.
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user'
+	CHECK (role IN ('user', 'facilitator', 'admin'));
+ALTER TABLE users ADD COLUMN created_at TIMESTAMP;
+UPDATE users SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL;
@@ -0,0 +1,23 @@
+-- Journal de toutes les tentatives de connexion
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+    identifier TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    user_agent TEXT,
+    success BOOLEAN NOT NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_user ON login_attempts(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts(ip, created_at);
+
+-- Compteurs d'échecs consécutifs par compte et par IP ("account:<id>",
+-- "ip:<adresse>"...) et date de fin du blocage en cours
+CREATE TABLE IF NOT EXISTS login_lockouts (
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_users_deletion_scheduled;
+ALTER TABLE users DROP COLUMN deletion_scheduled_at;
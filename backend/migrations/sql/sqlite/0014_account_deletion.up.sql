@@ -0,0 +1,6 @@
+-- Suppression de compte différée : le compte est purgé une fois
+-- deletion_scheduled_at passée, sauf si l'utilisateur se reconnecte avant
+ALTER TABLE users ADD COLUMN deletion_scheduled_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_users_deletion_scheduled
+    ON users(deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
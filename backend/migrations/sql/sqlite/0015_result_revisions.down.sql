@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS result_revisions;
+ALTER TABLE results DROP COLUMN revision;
+ALTER TABLE results DROP COLUMN updated_at;
@@ -0,0 +1,37 @@
+-- Historique des résultats : chaque enregistrement ou restauration ajoute une
+-- révision au lieu d'écraser silencieusement la précédente. revision est le
+-- numéro de la révision courante ; created_at reste la date de première
+-- saisie du mois, updated_at celle de la dernière modification, renseignée
+-- par l'application (SQLite n'accepte pas de valeur par défaut calculée pour
+-- une colonne ajoutée).
+ALTER TABLE results ADD COLUMN updated_at TIMESTAMP;
+ALTER TABLE results ADD COLUMN revision INTEGER NOT NULL DEFAULT 1;
+UPDATE results SET updated_at = COALESCE(created_at, CURRENT_TIMESTAMP) WHERE updated_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS result_revisions (
+    id TEXT PRIMARY KEY,
+    result_id TEXT NOT NULL REFERENCES results(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    value REAL NOT NULL,
+    inputs TEXT,
+    factor_set_id TEXT REFERENCES factor_sets(id),
+    breakdown TEXT,
+    submitted_value REAL,
+    flagged BOOLEAN NOT NULL DEFAULT 0,
+    source TEXT NOT NULL CHECK (source IN ('save', 'import', 'restore')),
+    restored_from INTEGER,
+    changed_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (result_id, revision)
+);
+
+-- L'état actuel des résultats existants devient leur première révision ;
+-- l'identifiant est un UUID aléatoire, SQLite n'ayant pas de md5
+INSERT INTO result_revisions (id, result_id, revision, value, inputs, factor_set_id, breakdown,
+    submitted_value, flagged, source, changed_by, created_at)
+SELECT lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' ||
+        substr('89AB', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))),
+    id, 1, value, inputs, factor_set_id, breakdown, submitted_value, flagged, 'save', user_id, updated_at
+FROM results
+WHERE true
+ON CONFLICT (result_id, revision) DO NOTHING;
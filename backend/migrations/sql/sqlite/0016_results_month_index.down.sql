@@ -0,0 +1 @@
+DROP INDEX IF EXISTS results_user_month_idx;
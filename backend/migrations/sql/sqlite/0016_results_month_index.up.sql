@@ -0,0 +1,2 @@
+-- Sert le filtrage par période et la pagination de GET /api/results
+CREATE INDEX IF NOT EXISTS results_user_month_idx ON results (user_id, month);
@@ -0,0 +1,25 @@
+ALTER TABLE activities DROP COLUMN factor_set_id;
+
+ALTER TABLE carbon_factors ADD COLUMN carbon_factor REAL NOT NULL DEFAULT 0;
+UPDATE carbon_factors SET carbon_factor = CASE id
+	WHEN 'train' THEN 0.014
+	WHEN 'flight' THEN 0.285
+	WHEN 'car_small' THEN 0.1
+	WHEN 'car_medium' THEN 0.2
+	WHEN 'car_big' THEN 0.3
+	WHEN 'red_meat' THEN 27
+	WHEN 'white_meat' THEN 6.9
+	WHEN 'pork' THEN 7.2
+	WHEN 'clothing_large' THEN 15
+	WHEN 'clothing_small' THEN 10
+	WHEN 'smartphone_small' THEN 35
+	WHEN 'smartphone_large' THEN 75
+	WHEN 'amazon_order' THEN 0.25
+	WHEN 'leboncoin_order' THEN 0.05
+	WHEN 'artisanat_order' THEN 0.1
+	WHEN 'brocante_item' THEN 0.03
+	WHEN 'local_shop_order' THEN 0.08
+	WHEN 'ski_day' THEN 48.9
+	ELSE 0
+END;
+ALTER TABLE carbon_factors DROP COLUMN factor;
@@ -0,0 +1,41 @@
+-- Les activités ne portent plus de facteur compilé : chaque entrée du
+-- catalogue désigne un facteur des jeux versionnés, et chaque activité
+-- enregistre le jeu utilisé pour calculer son empreinte.
+-- SQLite ne sait pas rendre obligatoire une colonne existante : elle l'est
+-- dès son ajout, avec une valeur par défaut vide aussitôt remplacée
+ALTER TABLE carbon_factors ADD COLUMN factor TEXT NOT NULL DEFAULT '';
+UPDATE carbon_factors SET factor = CASE id
+	WHEN 'train' THEN 'Transports.train'
+	WHEN 'flight' THEN 'Transports.flight'
+	WHEN 'car_small' THEN 'Transports.car.small'
+	WHEN 'car_medium' THEN 'Transports.car.medium'
+	WHEN 'car_big' THEN 'Transports.car.big'
+	WHEN 'red_meat' THEN 'Alimentation.redMeat'
+	WHEN 'white_meat' THEN 'Alimentation.whiteMeat'
+	WHEN 'pork' THEN 'Alimentation.pork'
+	WHEN 'clothing_large' THEN 'Vetements.large'
+	WHEN 'clothing_small' THEN 'Vetements.small'
+	WHEN 'smartphone_small' THEN 'Numerique.smartphone.small'
+	WHEN 'smartphone_large' THEN 'Numerique.smartphone.large'
+	WHEN 'amazon_order' THEN 'Consommation.ecommerce.amazon'
+	WHEN 'leboncoin_order' THEN 'Consommation.ecommerce.leboncoin'
+	WHEN 'artisanat_order' THEN 'Consommation.ecommerce.artisanat'
+	WHEN 'brocante_item' THEN 'Consommation.commerce.brocante'
+	WHEN 'local_shop_order' THEN 'Consommation.commerce.localShops'
+	WHEN 'ski_day' THEN 'SportLoisirs.ski'
+END
+WHERE factor = '';
+ALTER TABLE carbon_factors DROP COLUMN carbon_factor;
+
+ALTER TABLE activities ADD COLUMN factor_set_id TEXT REFERENCES factor_sets(id);
+
+-- Les activités existantes sont rattachées au jeu publié valide à leur date
+UPDATE activities AS a SET factor_set_id = (
+	SELECT f.id FROM factor_sets f
+	WHERE f.status = 'published'
+		AND f.valid_from <= a.date
+		AND (f.valid_to IS NULL OR f.valid_to >= a.date)
+	ORDER BY f.valid_from DESC
+	LIMIT 1
+)
+WHERE factor_set_id IS NULL;
@@ -0,0 +1,28 @@
+-- Les révisions des résultats supprimés n'ont plus de résultat auquel
+-- revenir
+CREATE TABLE result_revisions_old (
+    id TEXT PRIMARY KEY,
+    result_id TEXT NOT NULL REFERENCES results(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    value REAL NOT NULL,
+    inputs TEXT,
+    factor_set_id TEXT REFERENCES factor_sets(id),
+    breakdown TEXT,
+    submitted_value REAL,
+    flagged BOOLEAN NOT NULL DEFAULT 0,
+    source TEXT NOT NULL CHECK (source IN ('save', 'import', 'restore')),
+    restored_from INTEGER,
+    changed_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (result_id, revision)
+);
+
+INSERT INTO result_revisions_old (id, result_id, revision, value, inputs, factor_set_id, breakdown,
+    submitted_value, flagged, source, restored_from, changed_by, created_at)
+SELECT id, result_id, revision, value, inputs, factor_set_id, breakdown,
+    submitted_value, flagged, source, restored_from, changed_by, created_at
+FROM result_revisions
+WHERE result_id IS NOT NULL AND source <> 'delete';
+
+DROP TABLE result_revisions;
+ALTER TABLE result_revisions_old RENAME TO result_revisions;
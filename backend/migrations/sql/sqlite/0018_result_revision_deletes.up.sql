@@ -0,0 +1,33 @@
+-- La suppression d'un résultat ajoute une révision 'delete' et conserve son
+-- historique : les révisions perdent seulement leur lien avec le résultat.
+-- user_id les rattache au compte, dont la purge les supprime. SQLite ne
+-- modifie pas une clé étrangère existante : la table est reconstruite.
+CREATE TABLE result_revisions_new (
+    id TEXT PRIMARY KEY,
+    result_id TEXT REFERENCES results(id) ON DELETE SET NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    value REAL NOT NULL,
+    inputs TEXT,
+    factor_set_id TEXT REFERENCES factor_sets(id),
+    breakdown TEXT,
+    submitted_value REAL,
+    flagged BOOLEAN NOT NULL DEFAULT 0,
+    source TEXT NOT NULL CHECK (source IN ('save', 'import', 'restore', 'delete')),
+    restored_from INTEGER,
+    changed_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (result_id, revision)
+);
+
+INSERT INTO result_revisions_new (id, result_id, user_id, revision, value, inputs, factor_set_id, breakdown,
+    submitted_value, flagged, source, restored_from, changed_by, created_at)
+SELECT rv.id, rv.result_id, r.user_id, rv.revision, rv.value, rv.inputs, rv.factor_set_id, rv.breakdown,
+    rv.submitted_value, rv.flagged, rv.source, rv.restored_from, rv.changed_by, rv.created_at
+FROM result_revisions AS rv
+JOIN results AS r ON r.id = rv.result_id;
+
+DROP TABLE result_revisions;
+ALTER TABLE result_revisions_new RENAME TO result_revisions;
+
+CREATE INDEX IF NOT EXISTS result_revisions_user_idx ON result_revisions (user_id);
@@ -4,16 +4,24 @@ import "time"
 
 type Activity struct {
 	ID           uint      `json:"id" gorm:"primaryKey"`
+	UserID       string    `json:"user_id"`
 	ActivityID   string    `json:"activityId"`
 	Quantity     float64   `json:"quantity"`
 	Date         time.Time `json:"date"`
 	CarbonAmount float64   `json:"carbonAmount"`
+	// FactorSetID est le jeu de facteurs qui a servi à calculer CarbonAmount
+	FactorSetID *string   `json:"factor_set_id"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
+// CarbonFactor est une entrée du catalogue des activités. Factor désigne le
+// facteur des jeux versionnés (par exemple "Transports.train") ; sa valeur,
+// CarbonFactor, est celle du jeu en vigueur et n'est pas stockée.
 type CarbonFactor struct {
 	ID           string  `json:"id"`
 	Name         string  `json:"name"`
 	Category     string  `json:"category"`
+	Factor       string  `json:"factor"`
 	CarbonFactor float64 `json:"carbonFactor"`
 	Unit         string  `json:"unit"`
-} 
\ No newline at end of file
+}
@@ -90,11 +90,49 @@ type CarbonFactors struct {
 }
 
 type Result struct {
-	ID        string          `json:"id"`
-	UserID    string          `json:"user_id"`
-	Category  string          `json:"category"`
-	Value     float64         `json:"value"`
-	Inputs    json.RawMessage `json:"inputs"`
-	Month     time.Time       `json:"month"`
-	CreatedAt time.Time       `json:"created_at"`
+	ID               string          `json:"id"`
+	UserID           string          `json:"user_id"`
+	Category         string          `json:"category"`
+	Value            float64         `json:"value"`
+	Inputs           json.RawMessage `json:"inputs"`
+	Month            time.Time       `json:"month"`
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+	Revision         int             `json:"revision"`
+	FactorSetID      *string         `json:"factor_set_id"`
+	FactorSetVersion *string         `json:"factor_set_version"`
+	Breakdown        json.RawMessage `json:"breakdown"`
+	SubmittedValue   *float64        `json:"submitted_value"`
+	Flagged          bool            `json:"flagged"`
+}
+
+// ResultRevision est l'état d'un résultat après un enregistrement ou une
+// restauration. RestoredFrom désigne la révision restaurée.
+type ResultRevision struct {
+	ID             string          `json:"id"`
+	ResultID       string          `json:"result_id"`
+	UserID         string          `json:"user_id"`
+	Revision       int             `json:"revision"`
+	Value          float64         `json:"value"`
+	Inputs         json.RawMessage `json:"inputs"`
+	FactorSetID    *string         `json:"factor_set_id"`
+	Breakdown      json.RawMessage `json:"breakdown"`
+	SubmittedValue *float64        `json:"submitted_value"`
+	Flagged        bool            `json:"flagged"`
+	Source         string          `json:"source"`
+	RestoredFrom   *int            `json:"restored_from"`
+	ChangedBy      *string         `json:"changed_by"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+type FactorSet struct {
+	ID          string          `json:"id"`
+	Version     string          `json:"version"`
+	Source      string          `json:"source"`
+	ValidFrom   time.Time       `json:"valid_from"`
+	ValidTo     *time.Time      `json:"valid_to"`
+	Status      string          `json:"status"`
+	Factors     json.RawMessage `json:"factors"`
+	CreatedAt   time.Time       `json:"created_at"`
+	PublishedAt *time.Time      `json:"published_at"`
 }
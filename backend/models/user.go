@@ -1,8 +1,38 @@
 package models
 
+import "time"
+
+// Rôles, du moins au plus privilégié
+const (
+	RoleUser        = "user"
+	RoleFacilitator = "facilitator"
+	RoleAdmin       = "admin"
+)
+
+var roleRanks = map[string]int{
+	RoleUser:        1,
+	RoleFacilitator: 2,
+	RoleAdmin:       3,
+}
+
+// ValidRole indique si role est un rôle connu.
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// HasRole indique si role donne au moins les droits de required.
+func HasRole(role, required string) bool {
+	return roleRanks[role] >= roleRanks[required] && roleRanks[required] > 0
+}
+
 type User struct {
-	ID       string `json:"id"`
-	Email    string `json:"email"`
-	Username string `json:"username"`
-	Password string `json:"-"`
+	ID        string     `json:"id"`
+	Email     string     `json:"email"`
+	Username  string     `json:"username"`
+	Password  string     `json:"-"`
+	Role      string     `json:"role"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	// Nil tant que l'adresse n'a pas été confirmée
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
 }
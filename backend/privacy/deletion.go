@@ -0,0 +1,174 @@
+package privacy
+
+import (
+	"carbone-app/loginguard"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrNotFound = errors.New("compte introuvable")
+
+// RequestDeletion programme la purge du compte après le délai de grâce
+// gracePeriod, pendant lequel une reconnexion annule la suppression ; à
+// zéro, le compte est supprimé immédiatement. Elle renvoie la date de purge,
+// nulle si le compte est déjà supprimé.
+func RequestDeletion(db *sql.DB, userID string, now time.Time, gracePeriod time.Duration) (time.Time, error) {
+	if gracePeriod <= 0 {
+		return time.Time{}, Purge(db, userID)
+	}
+
+	scheduledAt := now.Add(gracePeriod)
+	res, err := db.Exec(`
+		UPDATE users SET deletion_scheduled_at = $1
+		WHERE id = $2 AND deletion_scheduled_at IS NULL
+	`, scheduledAt.UTC(), userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return scheduledAt, nil
+	}
+
+	// Suppression déjà demandée : la date initiale est conservée
+	var scheduled sql.NullTime
+	err = db.QueryRow("SELECT deletion_scheduled_at FROM users WHERE id = $1", userID).Scan(&scheduled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, ErrNotFound
+	}
+	return scheduled.Time, err
+}
+
+// CancelDeletion annule une suppression programmée et indique s'il y en
+// avait une.
+func CancelDeletion(db *sql.DB, userID string) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE users SET deletion_scheduled_at = NULL
+		WHERE id = $1 AND deletion_scheduled_at IS NOT NULL
+	`, userID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// Purge supprime définitivement le compte et toutes les données qui en
+// dépendent, en une seule transaction. Les groupes créés par l'utilisateur
+// passent au plus ancien facilitateur, à défaut au plus ancien membre, et
+// sont supprimés s'il n'en reste aucun.
+func Purge(db *sql.DB, userID string) error {
+	return purge(db, userID, nil)
+}
+
+// purge supprime le compte ; si due est renseigné, seulement si sa purge est
+// programmée au plus tard à cette date, pour ne pas supprimer un compte dont
+// l'utilisateur vient d'annuler la suppression.
+func purge(db *sql.DB, userID string, due *time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// La condition sur la date est vérifiée de nouveau par la suppression
+	// finale, au cas où l'utilisateur annulerait entre-temps
+	scheduled := ""
+	args := []any{userID}
+	if due != nil {
+		scheduled = " AND deletion_scheduled_at <= $2"
+		args = append(args, due.UTC())
+	}
+
+	var email string
+	err = tx.QueryRow("SELECT email FROM users WHERE id = $1"+scheduled, args...).Scan(&email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE group_members SET role = 'owner'
+		WHERE group_id IN (SELECT group_id FROM group_members WHERE user_id = $1 AND role = 'owner')
+			AND user_id = (
+				SELECT m.user_id
+				FROM group_members m
+				WHERE m.group_id = group_members.group_id AND m.user_id <> $1
+				ORDER BY m.role = 'facilitator' DESC, m.joined_at
+				LIMIT 1
+			)
+	`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		DELETE FROM groups
+		WHERE EXISTS (SELECT 1 FROM group_members m WHERE m.group_id = groups.id AND m.user_id = $1 AND m.role = 'owner')
+			AND NOT EXISTS (SELECT 1 FROM group_members m WHERE m.group_id = groups.id AND m.user_id <> $1)
+	`, userID)
+	if err != nil {
+		return err
+	}
+
+	// Le journal de connexion ne fait que perdre son lien avec le compte
+	// (ON DELETE SET NULL) : les tentatives contenant l'email sont effacées
+	_, err = tx.Exec("DELETE FROM login_attempts WHERE user_id = $1 OR LOWER(identifier) = LOWER($2)", userID, email)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM login_lockouts WHERE key IN ($1, $2)",
+		loginguard.AccountKey(userID), loginguard.IdentifierKey(email))
+	if err != nil {
+		return err
+	}
+
+	// Résultats et leur historique, activités, scénarios, sessions, jetons,
+	// codes de secours et adhésions suivent par ON DELETE CASCADE
+	res, err := tx.Exec("DELETE FROM users WHERE id = $1"+scheduled, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return tx.Commit()
+}
+
+// PurgeDue purge les comptes dont le délai de grâce a expiré à l'instant now
+// et renvoie leur nombre.
+func PurgeDue(db *sql.DB, now time.Time) (int, error) {
+	rows, err := db.Query("SELECT id FROM users WHERE deletion_scheduled_at <= $1", now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, id := range ids {
+		err := purge(db, id, &now)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
@@ -0,0 +1,235 @@
+// Package privacy regroupe les droits de l'utilisateur sur ses données :
+// export complet (JSON et CSV) et suppression du compte, immédiate ou après
+// un délai de grâce.
+package privacy
+
+import (
+	"archive/zip"
+	"carbone-app/models"
+	"carbone-app/scenarios"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+type Membership struct {
+	GroupID     string     `json:"group_id"`
+	Name        string     `json:"name"`
+	Role        string     `json:"role"`
+	ConsentedAt *time.Time `json:"consented_at"`
+	JoinedAt    time.Time  `json:"joined_at"`
+}
+
+// Archive contient toutes les données rattachées à un compte.
+type Archive struct {
+	ExportedAt time.Time            `json:"exported_at"`
+	Profile    models.User          `json:"profile"`
+	Results    []models.Result      `json:"results"`
+	Activities []models.Activity    `json:"activities"`
+	Scenarios  []scenarios.Scenario `json:"scenarios"`
+	Groups     []Membership         `json:"groups"`
+}
+
+func Export(db *sql.DB, userID string) (Archive, error) {
+	archive := Archive{ExportedAt: time.Now().UTC()}
+
+	var createdAt, verifiedAt sql.NullTime
+	err := db.QueryRow(`
+		SELECT id, email, username, role, created_at, email_verified_at
+		FROM users WHERE id = $1
+	`, userID).Scan(&archive.Profile.ID, &archive.Profile.Email, &archive.Profile.Username, &archive.Profile.Role,
+		&createdAt, &verifiedAt)
+	if err != nil {
+		return archive, err
+	}
+	if createdAt.Valid {
+		archive.Profile.CreatedAt = &createdAt.Time
+	}
+	if verifiedAt.Valid {
+		archive.Profile.EmailVerifiedAt = &verifiedAt.Time
+	}
+
+	if archive.Results, err = results(db, userID); err != nil {
+		return archive, err
+	}
+	if archive.Activities, err = activities(db, userID); err != nil {
+		return archive, err
+	}
+	if archive.Scenarios, err = scenarios.List(db, userID); err != nil {
+		return archive, err
+	}
+	if archive.Groups, err = memberships(db, userID); err != nil {
+		return archive, err
+	}
+	return archive, nil
+}
+
+func results(db *sql.DB, userID string) ([]models.Result, error) {
+	rows, err := db.Query(`
+		SELECT r.id, r.user_id, r.category, r.value, r.inputs, r.month, r.created_at, r.updated_at, r.revision,
+			r.factor_set_id, f.version, r.breakdown, r.submitted_value, r.flagged
+		FROM results r
+		LEFT JOIN factor_sets f ON f.id = r.factor_set_id
+		WHERE r.user_id = $1
+		ORDER BY r.month, r.category
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Result{}
+	for rows.Next() {
+		var result models.Result
+		var inputs, breakdown []byte
+		var factorSetID, factorSetVersion sql.NullString
+		err := rows.Scan(&result.ID, &result.UserID, &result.Category, &result.Value, &inputs, &result.Month,
+			&result.CreatedAt, &result.UpdatedAt, &result.Revision, &factorSetID, &factorSetVersion, &breakdown, &result.SubmittedValue, &result.Flagged)
+		if err != nil {
+			return nil, err
+		}
+		result.Inputs = inputs
+		result.Breakdown = breakdown
+		if factorSetID.Valid {
+			result.FactorSetID = &factorSetID.String
+			result.FactorSetVersion = &factorSetVersion.String
+		}
+		list = append(list, result)
+	}
+	return list, rows.Err()
+}
+
+func activities(db *sql.DB, userID string) ([]models.Activity, error) {
+	rows, err := db.Query(`
+		SELECT id, user_id, activity_id, quantity, date, carbon_amount, created_at
+		FROM activities
+		WHERE user_id = $1
+		ORDER BY date, id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Activity{}
+	for rows.Next() {
+		var activity models.Activity
+		err := rows.Scan(&activity.ID, &activity.UserID, &activity.ActivityID, &activity.Quantity, &activity.Date,
+			&activity.CarbonAmount, &activity.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, activity)
+	}
+	return list, rows.Err()
+}
+
+func memberships(db *sql.DB, userID string) ([]Membership, error) {
+	rows, err := db.Query(`
+		SELECT g.id, g.name, m.role, m.consented_at, m.joined_at
+		FROM group_members m
+		JOIN groups g ON g.id = m.group_id
+		WHERE m.user_id = $1
+		ORDER BY m.joined_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Membership{}
+	for rows.Next() {
+		var membership Membership
+		var consentedAt sql.NullTime
+		if err := rows.Scan(&membership.GroupID, &membership.Name, &membership.Role, &consentedAt, &membership.JoinedAt); err != nil {
+			return nil, err
+		}
+		if consentedAt.Valid {
+			membership.ConsentedAt = &consentedAt.Time
+		}
+		list = append(list, membership)
+	}
+	return list, rows.Err()
+}
+
+// WriteZip écrit l'archive au format zip : export.json contient tout, les
+// fichiers CSV reprennent le profil, les résultats (entrées en JSON) et les
+// activités pour un tableur.
+func (a Archive) WriteZip(w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	file, err := archive.Create("export.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(a); err != nil {
+		return err
+	}
+
+	profile := [][]string{
+		{"id", "email", "username", "role", "created_at", "email_verified_at"},
+		{a.Profile.ID, a.Profile.Email, a.Profile.Username, a.Profile.Role,
+			formatTime(a.Profile.CreatedAt), formatTime(a.Profile.EmailVerifiedAt)},
+	}
+	if err := writeCSV(archive, "profile.csv", profile); err != nil {
+		return err
+	}
+
+	results := [][]string{{"id", "month", "category", "value", "inputs", "factor_set_version", "submitted_value", "flagged", "created_at", "updated_at", "revision"}}
+	for _, r := range a.Results {
+		version := ""
+		if r.FactorSetVersion != nil {
+			version = *r.FactorSetVersion
+		}
+		submitted := ""
+		if r.SubmittedValue != nil {
+			submitted = formatFloat(*r.SubmittedValue)
+		}
+		results = append(results, []string{r.ID, r.Month.Format("2006-01"), r.Category, formatFloat(r.Value),
+			string(r.Inputs), version, submitted, strconv.FormatBool(r.Flagged), r.CreatedAt.Format(time.RFC3339),
+			r.UpdatedAt.Format(time.RFC3339), strconv.Itoa(r.Revision)})
+	}
+	if err := writeCSV(archive, "results.csv", results); err != nil {
+		return err
+	}
+
+	activities := [][]string{{"id", "activity_id", "quantity", "date", "carbon_amount", "created_at"}}
+	for _, act := range a.Activities {
+		activities = append(activities, []string{strconv.FormatUint(uint64(act.ID), 10), act.ActivityID,
+			formatFloat(act.Quantity), act.Date.Format("2006-01-02"), formatFloat(act.CarbonAmount),
+			act.CreatedAt.Format(time.RFC3339)})
+	}
+	if err := writeCSV(archive, "activities.csv", activities); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func writeCSV(archive *zip.Writer, name string, records [][]string) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(file)
+	if err := writer.WriteAll(records); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
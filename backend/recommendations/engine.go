@@ -0,0 +1,261 @@
+// Package recommendations évalue des règles stockées en base sur les
+// résultats d'un mois et propose des actions classées par réduction estimée.
+package recommendations
+
+import (
+	"carbone-app/calculator"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Types de conditions
+const (
+	AboveThreshold = "above_threshold" // valeur de la catégorie > seuil de la catégorie
+	ValueAbove     = "value_above"     // valeur de la catégorie > Value
+	InputAbove     = "input_above"     // entrée Input > Value
+	InputEquals    = "input_equals"    // entrée Input == Value
+	InputShare     = "input_share"     // part de l'entrée Input dans la catégorie >= Share
+	All            = "all"             // toutes les Conditions sont vraies
+)
+
+type Condition struct {
+	Type       string      `json:"type"`
+	Input      string      `json:"input,omitempty"`
+	Value      any         `json:"value,omitempty"`
+	Share      float64     `json:"share,omitempty"`
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// ValidateCondition vérifie que la condition et ses sous-conditions sont d'un
+// type connu : une condition inconnue ne serait jamais vraie.
+func ValidateCondition(condition Condition) error {
+	switch condition.Type {
+	case AboveThreshold, ValueAbove, InputAbove, InputEquals, InputShare:
+		return nil
+	case All:
+		if len(condition.Conditions) == 0 {
+			return fmt.Errorf("condition %s sans sous-condition", All)
+		}
+		for _, sub := range condition.Conditions {
+			if err := ValidateCondition(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("type de condition inconnu: %q", condition.Type)
+}
+
+// Change décrit la modification d'une entrée simulée par une action :
+// multiplication (Scale), remplacement (Set), ajout (Add) ou report de la
+// valeur initiale d'une autre entrée (AddFrom).
+type Change struct {
+	Input   string   `json:"input"`
+	Scale   *float64 `json:"scale,omitempty"`
+	Set     any      `json:"set,omitempty"`
+	Add     *float64 `json:"add,omitempty"`
+	AddFrom string   `json:"addFrom,omitempty"`
+}
+
+// Action est une suggestion. Impact est un libellé libre ; si Changes est
+// renseigné, la réduction est estimée avec le calculateur.
+type Action struct {
+	Action  string   `json:"action"`
+	Impact  string   `json:"impact,omitempty"`
+	Changes []Change `json:"changes,omitempty"`
+}
+
+type Rule struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Category  string    `json:"category"`
+	Condition Condition `json:"condition"`
+	Actions   []Action  `json:"actions"`
+	Priority  int       `json:"priority"`
+	Active    bool      `json:"active"`
+}
+
+// CategoryData regroupe le résultat enregistré d'une catégorie pour un mois.
+type CategoryData struct {
+	Value  float64
+	Inputs map[string]any
+}
+
+type CategoryStatus struct {
+	Category    string  `json:"category"`
+	Value       float64 `json:"value"`
+	Threshold   float64 `json:"threshold"`
+	IsExceeding bool    `json:"isExceeding"`
+}
+
+type SuggestedAction struct {
+	Action             string   `json:"action"`
+	Impact             string   `json:"impact,omitempty"`
+	EstimatedReduction *float64 `json:"estimatedReduction"`
+}
+
+type Suggestion struct {
+	RuleID             string            `json:"ruleId"`
+	Name               string            `json:"name"`
+	Category           string            `json:"category"`
+	Priority           int               `json:"priority"`
+	Actions            []SuggestedAction `json:"actions"`
+	EstimatedReduction float64           `json:"estimatedReduction"`
+}
+
+type Report struct {
+	Categories      []CategoryStatus `json:"categories"`
+	Recommendations []Suggestion     `json:"recommendations"`
+}
+
+// Evaluate applique les règles actives aux résultats d'un mois. Les
+// suggestions sont classées par réduction estimée décroissante, puis par
+// priorité ; les catégories en dépassement viennent en premier.
+func Evaluate(rules []Rule, thresholds map[string]float64, data map[string]CategoryData, factors calculator.Factors) Report {
+	report := Report{Categories: []CategoryStatus{}, Recommendations: []Suggestion{}}
+
+	for category, threshold := range thresholds {
+		value := data[category].Value
+		report.Categories = append(report.Categories, CategoryStatus{
+			Category:    category,
+			Value:       value,
+			Threshold:   threshold,
+			IsExceeding: value > threshold,
+		})
+	}
+	sort.Slice(report.Categories, func(i, j int) bool {
+		a, b := report.Categories[i], report.Categories[j]
+		if a.IsExceeding != b.IsExceeding {
+			return a.IsExceeding
+		}
+		return ratio(a) > ratio(b)
+	})
+
+	for _, rule := range rules {
+		category, ok := data[rule.Category]
+		if !rule.Active || !ok {
+			continue
+		}
+		if !matches(rule.Condition, rule.Category, category, thresholds, factors) {
+			continue
+		}
+
+		suggestion := Suggestion{
+			RuleID:   rule.ID,
+			Name:     rule.Name,
+			Category: rule.Category,
+			Priority: rule.Priority,
+			Actions:  []SuggestedAction{},
+		}
+		for _, action := range rule.Actions {
+			suggested := SuggestedAction{Action: action.Action, Impact: action.Impact}
+			if len(action.Changes) > 0 {
+				reduction := estimate(rule.Category, category.Inputs, action.Changes, factors)
+				suggested.EstimatedReduction = &reduction
+				suggestion.EstimatedReduction = math.Max(suggestion.EstimatedReduction, reduction)
+			}
+			suggestion.Actions = append(suggestion.Actions, suggested)
+		}
+		report.Recommendations = append(report.Recommendations, suggestion)
+	}
+
+	sort.SliceStable(report.Recommendations, func(i, j int) bool {
+		a, b := report.Recommendations[i], report.Recommendations[j]
+		if a.EstimatedReduction != b.EstimatedReduction {
+			return a.EstimatedReduction > b.EstimatedReduction
+		}
+		return a.Priority > b.Priority
+	})
+
+	return report
+}
+
+func ratio(status CategoryStatus) float64 {
+	if status.Threshold == 0 {
+		return 0
+	}
+	return status.Value / status.Threshold
+}
+
+func matches(condition Condition, categoryName string, category CategoryData, thresholds map[string]float64, factors calculator.Factors) bool {
+	switch condition.Type {
+	case AboveThreshold:
+		threshold, ok := thresholds[categoryName]
+		return ok && category.Value > threshold
+	case ValueAbove:
+		limit, ok := condition.Value.(float64)
+		return ok && category.Value > limit
+	case InputAbove:
+		value, ok := category.Inputs[condition.Input].(float64)
+		limit, limitOK := condition.Value.(float64)
+		return ok && limitOK && value > limit
+	case InputEquals:
+		return condition.Value != nil && category.Inputs[condition.Input] == condition.Value
+	case InputShare:
+		result, err := calculator.Compute(categoryName, category.Inputs, factors)
+		if err != nil || result.Value <= 0 {
+			return false
+		}
+		part := 0.0
+		for _, line := range result.Lines {
+			if line.Input == condition.Input {
+				part += line.Value
+			}
+		}
+		return part/result.Value >= condition.Share
+	case All:
+		for _, sub := range condition.Conditions {
+			if !matches(sub, categoryName, category, thresholds, factors) {
+				return false
+			}
+		}
+		return len(condition.Conditions) > 0
+	}
+	return false
+}
+
+// estimate calcule la réduction obtenue en appliquant les changements aux
+// entrées, avec les facteurs fournis.
+func estimate(categoryName string, inputs map[string]any, changes []Change, factors calculator.Factors) float64 {
+	before, err := calculator.Compute(categoryName, inputs, factors)
+	if err != nil {
+		return 0
+	}
+	after, err := calculator.Compute(categoryName, Apply(inputs, changes), factors)
+	if err != nil {
+		return 0
+	}
+	return before.Value - after.Value
+}
+
+// Apply renvoie une copie des entrées modifiées. AddFrom lit toujours la
+// valeur initiale, ce qui permet de reporter une quantité d'une entrée sur
+// une autre quel que soit l'ordre des changements.
+func Apply(inputs map[string]any, changes []Change) map[string]any {
+	modified := make(map[string]any, len(inputs))
+	for key, value := range inputs {
+		modified[key] = value
+	}
+
+	for _, change := range changes {
+		current, isNumber := modified[change.Input].(float64)
+		switch {
+		case change.Set != nil:
+			modified[change.Input] = change.Set
+		case change.Scale != nil:
+			if isNumber {
+				modified[change.Input] = current * *change.Scale
+			}
+		case change.Add != nil:
+			if isNumber {
+				modified[change.Input] = current + *change.Add
+			}
+		case change.AddFrom != "":
+			if source, ok := inputs[change.AddFrom].(float64); ok {
+				modified[change.Input] = current + source
+			}
+		}
+	}
+	return modified
+}
@@ -0,0 +1,171 @@
+package recommendations
+
+import (
+	"carbone-app/calculator"
+	"math"
+	"testing"
+)
+
+var factors = calculator.Factors{
+	"Transports.train":      0.014,
+	"Transports.flight":     0.285,
+	"Transports.car.small":  0.1,
+	"Transports.car.medium": 0.2,
+}
+
+// transports vaut 1,4 (train) + 285 (avion) + 20 (voiture) = 306,4 kg.
+var transports = CategoryData{
+	Value: 306.4,
+	Inputs: map[string]any{
+		"trainKm":      100.0,
+		"flightKm":     1000.0,
+		"flightType":   "international",
+		"carKm":        200.0,
+		"carType":      "small",
+		"carOccupants": 1.0,
+	},
+}
+
+// suggested renvoie la suggestion de la règle, si elle a été retenue.
+func suggested(report Report, ruleID string) (Suggestion, bool) {
+	for _, s := range report.Recommendations {
+		if s.RuleID == ruleID {
+			return s, true
+		}
+	}
+	return Suggestion{}, false
+}
+
+func TestEvaluateConditions(t *testing.T) {
+	cases := []struct {
+		name       string
+		condition  Condition
+		thresholds map[string]float64
+		want       bool
+	}{
+		{"above_threshold dépassé", Condition{Type: AboveThreshold}, map[string]float64{"Transports": 300}, true},
+		{"above_threshold respecté", Condition{Type: AboveThreshold}, map[string]float64{"Transports": 400}, false},
+		{"above_threshold sans seuil", Condition{Type: AboveThreshold}, nil, false},
+
+		{"value_above vrai", Condition{Type: ValueAbove, Value: 300.0}, nil, true},
+		{"value_above faux", Condition{Type: ValueAbove, Value: 306.4}, nil, false},
+		{"value_above non numérique", Condition{Type: ValueAbove, Value: "300"}, nil, false},
+
+		{"input_above vrai", Condition{Type: InputAbove, Input: "flightKm", Value: 500.0}, nil, true},
+		{"input_above faux", Condition{Type: InputAbove, Input: "trainKm", Value: 500.0}, nil, false},
+		{"input_above entrée absente", Condition{Type: InputAbove, Input: "busKm", Value: 0.0}, nil, false},
+		{"input_above entrée texte", Condition{Type: InputAbove, Input: "carType", Value: 0.0}, nil, false},
+
+		{"input_equals texte", Condition{Type: InputEquals, Input: "carType", Value: "small"}, nil, true},
+		{"input_equals nombre", Condition{Type: InputEquals, Input: "carOccupants", Value: 1.0}, nil, true},
+		{"input_equals différent", Condition{Type: InputEquals, Input: "carType", Value: "big"}, nil, false},
+		{"input_equals sans valeur", Condition{Type: InputEquals, Input: "busKm"}, nil, false},
+
+		// L'avion représente 285 / 306,4 = 93 % des transports
+		{"input_share atteinte", Condition{Type: InputShare, Input: "flightKm", Share: 0.9}, nil, true},
+		{"input_share insuffisante", Condition{Type: InputShare, Input: "carKm", Share: 0.1}, nil, false},
+		{"input_share entrée absente", Condition{Type: InputShare, Input: "busKm", Share: 0.01}, nil, false},
+
+		{"all vraie", Condition{Type: All, Conditions: []Condition{
+			{Type: InputEquals, Input: "carType", Value: "small"},
+			{Type: InputAbove, Input: "carKm", Value: 100.0},
+		}}, nil, true},
+		{"all avec une condition fausse", Condition{Type: All, Conditions: []Condition{
+			{Type: InputEquals, Input: "carType", Value: "small"},
+			{Type: InputAbove, Input: "carKm", Value: 1000.0},
+		}}, nil, false},
+		{"all vide", Condition{Type: All}, nil, false},
+
+		{"type inconnu", Condition{Type: "below_threshold"}, nil, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rules := []Rule{{ID: "r", Name: c.name, Category: "Transports", Condition: c.condition, Active: true}}
+			report := Evaluate(rules, c.thresholds, map[string]CategoryData{"Transports": transports}, factors)
+			if _, got := suggested(report, "r"); got != c.want {
+				t.Errorf("règle retenue = %v, attendu %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateSkipsInactiveAndMissing(t *testing.T) {
+	rules := []Rule{
+		{ID: "inactive", Category: "Transports", Condition: Condition{Type: ValueAbove, Value: 0.0}},
+		{ID: "absente", Category: "Alimentation", Condition: Condition{Type: ValueAbove, Value: 0.0}, Active: true},
+	}
+	report := Evaluate(rules, nil, map[string]CategoryData{"Transports": transports}, factors)
+	if len(report.Recommendations) != 0 {
+		t.Errorf("recommandations = %+v, attendu aucune", report.Recommendations)
+	}
+}
+
+func TestEvaluateEstimatesAndSorts(t *testing.T) {
+	half := 0.5
+	rules := []Rule{
+		{ID: "libellé", Category: "Transports", Priority: 10, Active: true,
+			Condition: Condition{Type: ValueAbove, Value: 0.0},
+			Actions:   []Action{{Action: "Y penser", Impact: "faible"}}},
+		{ID: "avion", Category: "Transports", Priority: 1, Active: true,
+			Condition: Condition{Type: ValueAbove, Value: 0.0},
+			Actions: []Action{
+				{Action: "Moitié moins d'avion", Changes: []Change{{Input: "flightKm", Scale: &half}}},
+				// Le train remplace la voiture : +200 km de train, 0 km de voiture
+				{Action: "Le train plutôt que la voiture", Changes: []Change{
+					{Input: "trainKm", AddFrom: "carKm"},
+					{Input: "carKm", Set: 0.0},
+				}},
+			}},
+	}
+	thresholds := map[string]float64{"Transports": 100, "Alimentation": 50}
+	data := map[string]CategoryData{"Transports": transports, "Alimentation": {Value: 20}}
+	report := Evaluate(rules, thresholds, data, factors)
+
+	if len(report.Recommendations) != 2 || report.Recommendations[0].RuleID != "avion" {
+		t.Fatalf("ordre = %+v, attendu la plus forte réduction en tête", report.Recommendations)
+	}
+	avion := report.Recommendations[0]
+	if math.Abs(avion.EstimatedReduction-142.5) > 1e-9 {
+		t.Errorf("réduction de la règle = %v, attendu 142.5", avion.EstimatedReduction)
+	}
+	want := []float64{142.5, 20 - 200*0.014}
+	for i, action := range avion.Actions {
+		if action.EstimatedReduction == nil || math.Abs(*action.EstimatedReduction-want[i]) > 1e-9 {
+			t.Errorf("action %q: réduction %v, attendu %v", action.Action, action.EstimatedReduction, want[i])
+		}
+	}
+	if report.Recommendations[1].Actions[0].EstimatedReduction != nil {
+		t.Error("une action sans changement ne doit pas avoir de réduction estimée")
+	}
+
+	if len(report.Categories) != 2 || report.Categories[0].Category != "Transports" ||
+		!report.Categories[0].IsExceeding || report.Categories[1].IsExceeding {
+		t.Errorf("catégories = %+v, attendu Transports en dépassement en tête", report.Categories)
+	}
+}
+
+func TestValidateCondition(t *testing.T) {
+	for _, valid := range []Condition{
+		{Type: AboveThreshold},
+		{Type: ValueAbove},
+		{Type: InputAbove},
+		{Type: InputEquals},
+		{Type: InputShare},
+		{Type: All, Conditions: []Condition{{Type: AboveThreshold}, {Type: All, Conditions: []Condition{{Type: InputShare}}}}},
+	} {
+		if err := ValidateCondition(valid); err != nil {
+			t.Errorf("%+v refusée: %v", valid, err)
+		}
+	}
+	for _, invalid := range []Condition{
+		{Type: "below_threshold"},
+		{Type: ""},
+		{Type: All},
+		{Type: All, Conditions: []Condition{{Type: AboveThreshold}, {Type: "any"}}},
+	} {
+		if err := ValidateCondition(invalid); err == nil {
+			t.Errorf("%+v acceptée", invalid)
+		}
+	}
+}
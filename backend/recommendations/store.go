@@ -0,0 +1,155 @@
+package recommendations
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+var ErrNotFound = errors.New("règle introuvable")
+
+func scanRule(row interface{ Scan(...any) error }) (Rule, error) {
+	var rule Rule
+	var condition, actions []byte
+	err := row.Scan(&rule.ID, &rule.Name, &rule.Category, &condition, &actions, &rule.Priority, &rule.Active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rule, ErrNotFound
+	}
+	if err != nil {
+		return rule, err
+	}
+	if err := json.Unmarshal(condition, &rule.Condition); err != nil {
+		return rule, err
+	}
+	if err := json.Unmarshal(actions, &rule.Actions); err != nil {
+		return rule, err
+	}
+	return rule, nil
+}
+
+// ListRules renvoie les règles, éventuellement limitées aux règles actives.
+func ListRules(db *sql.DB, activeOnly bool) ([]Rule, error) {
+	rows, err := db.Query(`
+		SELECT id, name, category, condition, actions, priority, active
+		FROM recommendation_rules
+		WHERE active OR NOT $1
+		ORDER BY category, priority DESC, name
+	`, activeOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []Rule{}
+	for rows.Next() {
+		rule, err := scanRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func GetRule(db *sql.DB, id string) (Rule, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return Rule{}, ErrNotFound
+	}
+	return scanRule(db.QueryRow(`
+		SELECT id, name, category, condition, actions, priority, active
+		FROM recommendation_rules
+		WHERE id = $1
+	`, id))
+}
+
+func CreateRule(db *sql.DB, rule *Rule) error {
+	condition, actions, err := encode(*rule)
+	if err != nil {
+		return err
+	}
+	rule.ID = uuid.New().String()
+	_, err = db.Exec(`
+		INSERT INTO recommendation_rules (id, name, category, condition, actions, priority, active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, rule.ID, rule.Name, rule.Category, condition, actions, rule.Priority, rule.Active)
+	return err
+}
+
+func UpdateRule(db *sql.DB, rule Rule) error {
+	condition, actions, err := encode(rule)
+	if err != nil {
+		return err
+	}
+	res, err := db.Exec(`
+		UPDATE recommendation_rules
+		SET name = $1, category = $2, condition = $3, actions = $4, priority = $5, active = $6
+		WHERE id = $7
+	`, rule.Name, rule.Category, condition, actions, rule.Priority, rule.Active, rule.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func DeleteRule(db *sql.DB, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrNotFound
+	}
+	res, err := db.Exec("DELETE FROM recommendation_rules WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Thresholds renvoie le seuil mensuel (kg CO2e) de chaque catégorie.
+func Thresholds(db *sql.DB) (map[string]float64, error) {
+	rows, err := db.Query("SELECT category, threshold FROM recommendation_thresholds")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	thresholds := map[string]float64{}
+	for rows.Next() {
+		var category string
+		var threshold float64
+		if err := rows.Scan(&category, &threshold); err != nil {
+			return nil, err
+		}
+		thresholds[category] = threshold
+	}
+	return thresholds, rows.Err()
+}
+
+func SetThreshold(db *sql.DB, category string, threshold float64) error {
+	_, err := db.Exec(`
+		INSERT INTO recommendation_thresholds (category, threshold)
+		VALUES ($1, $2)
+		ON CONFLICT (category) DO UPDATE SET threshold = EXCLUDED.threshold
+	`, category, threshold)
+	return err
+}
+
+func encode(rule Rule) ([]byte, []byte, error) {
+	condition, err := json.Marshal(rule.Condition)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rule.Actions == nil {
+		rule.Actions = []Action{}
+	}
+	actions, err := json.Marshal(rule.Actions)
+	if err != nil {
+		return nil, nil, err
+	}
+	return condition, actions, nil
+}
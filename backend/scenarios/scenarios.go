@@ -0,0 +1,120 @@
+// Package scenarios simule l'effet de modifications d'entrées sur
+// l'empreinte d'un mois, sans toucher aux résultats enregistrés.
+package scenarios
+
+import (
+	"carbone-app/calculator"
+	"sort"
+	"time"
+)
+
+// Inputs associe à chaque catégorie ses entrées.
+type Inputs map[string]map[string]any
+
+type CategoryOutcome struct {
+	Category string  `json:"category"`
+	Baseline float64 `json:"baseline"`
+	Scenario float64 `json:"scenario"`
+	Delta    float64 `json:"delta"`
+}
+
+type Outcome struct {
+	Baseline   float64           `json:"baseline"`
+	Scenario   float64           `json:"scenario"`
+	Delta      float64           `json:"delta"`
+	Categories []CategoryOutcome `json:"categories"`
+}
+
+type Scenario struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	Name        string     `json:"name"`
+	BaseMonth   *time.Time `json:"base_month"`
+	BaseInputs  Inputs     `json:"base_inputs"`
+	Overrides   Inputs     `json:"overrides"`
+	FactorSetID string     `json:"factor_set_id"`
+	Outcome     Outcome    `json:"outcome"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Apply renvoie les entrées de base complétées par les surcharges. Une
+// surcharge à null retire l'entrée.
+func Apply(base, overrides Inputs) Inputs {
+	merged := Inputs{}
+	for category, inputs := range base {
+		merged[category] = copyInputs(inputs)
+	}
+	for category, inputs := range overrides {
+		if merged[category] == nil {
+			merged[category] = map[string]any{}
+		}
+		for name, value := range inputs {
+			if value == nil {
+				delete(merged[category], name)
+				continue
+			}
+			merged[category][name] = value
+		}
+	}
+	return merged
+}
+
+// Validate vérifie les entrées de chaque catégorie ; les champs en erreur
+// sont préfixés par leur catégorie ("Transports.carKm").
+func Validate(inputs Inputs) []calculator.FieldError {
+	errs := []calculator.FieldError{}
+	for _, category := range sortedCategories(inputs) {
+		for _, err := range calculator.Validate(category, inputs[category]) {
+			err.Field = category + "." + err.Field
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Run calcule l'empreinte de référence et celle du scénario, catégorie par
+// catégorie, avec le même jeu de facteurs.
+func Run(base, overrides Inputs, factors calculator.Factors) (Outcome, error) {
+	scenario := Apply(base, overrides)
+	outcome := Outcome{Categories: []CategoryOutcome{}}
+
+	for _, category := range sortedCategories(scenario) {
+		entry := CategoryOutcome{Category: category}
+		if inputs, ok := base[category]; ok {
+			result, err := calculator.Compute(category, inputs, factors)
+			if err != nil {
+				return outcome, err
+			}
+			entry.Baseline = result.Value
+		}
+		result, err := calculator.Compute(category, scenario[category], factors)
+		if err != nil {
+			return outcome, err
+		}
+		entry.Scenario = result.Value
+		entry.Delta = entry.Scenario - entry.Baseline
+
+		outcome.Baseline += entry.Baseline
+		outcome.Scenario += entry.Scenario
+		outcome.Categories = append(outcome.Categories, entry)
+	}
+	outcome.Delta = outcome.Scenario - outcome.Baseline
+	return outcome, nil
+}
+
+func copyInputs(inputs map[string]any) map[string]any {
+	copied := make(map[string]any, len(inputs))
+	for name, value := range inputs {
+		copied[name] = value
+	}
+	return copied
+}
+
+func sortedCategories(inputs Inputs) []string {
+	categories := make([]string, 0, len(inputs))
+	for category := range inputs {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	return categories
+}
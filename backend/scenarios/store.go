@@ -0,0 +1,107 @@
+package scenarios
+
+import (
+	"carbone-app/store"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrNotFound = errors.New("scénario introuvable")
+
+const columns = `id, user_id, name, base_month, base_inputs, overrides, factor_set_id, outcome, created_at`
+
+func scan(row interface{ Scan(...any) error }) (Scenario, error) {
+	var scenario Scenario
+	var baseMonth sql.NullTime
+	var factorSetID sql.NullString
+	var baseInputs, overrides, outcome []byte
+	err := row.Scan(&scenario.ID, &scenario.UserID, &scenario.Name, &baseMonth, &baseInputs,
+		&overrides, &factorSetID, &outcome, &scenario.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return scenario, ErrNotFound
+	}
+	if err != nil {
+		return scenario, err
+	}
+	if baseMonth.Valid {
+		scenario.BaseMonth = &baseMonth.Time
+	}
+	scenario.FactorSetID = factorSetID.String
+	if err := json.Unmarshal(baseInputs, &scenario.BaseInputs); err != nil {
+		return scenario, err
+	}
+	if err := json.Unmarshal(overrides, &scenario.Overrides); err != nil {
+		return scenario, err
+	}
+	if err := json.Unmarshal(outcome, &scenario.Outcome); err != nil {
+		return scenario, err
+	}
+	return scenario, nil
+}
+
+func Create(db *sql.DB, scenario *Scenario) error {
+	baseInputs, err := json.Marshal(scenario.BaseInputs)
+	if err != nil {
+		return err
+	}
+	overrides, err := json.Marshal(scenario.Overrides)
+	if err != nil {
+		return err
+	}
+	outcome, err := json.Marshal(scenario.Outcome)
+	if err != nil {
+		return err
+	}
+
+	scenario.ID = uuid.New().String()
+	scenario.CreatedAt = time.Now().UTC()
+	_, err = db.Exec(`
+		INSERT INTO scenarios (`+columns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, scenario.ID, scenario.UserID, scenario.Name, store.NullDate(scenario.BaseMonth), baseInputs, overrides,
+		scenario.FactorSetID, outcome, scenario.CreatedAt)
+	return err
+}
+
+func List(db *sql.DB, userID string) ([]Scenario, error) {
+	rows, err := db.Query("SELECT "+columns+" FROM scenarios WHERE user_id = $1 ORDER BY created_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scenarios := []Scenario{}
+	for rows.Next() {
+		scenario, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		scenarios = append(scenarios, scenario)
+	}
+	return scenarios, rows.Err()
+}
+
+func Get(db *sql.DB, userID, id string) (Scenario, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return Scenario{}, ErrNotFound
+	}
+	return scan(db.QueryRow("SELECT "+columns+" FROM scenarios WHERE id = $1 AND user_id = $2", id, userID))
+}
+
+func Delete(db *sql.DB, userID, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrNotFound
+	}
+	res, err := db.Exec("DELETE FROM scenarios WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+// Package sessions gère les sessions de connexion : refresh tokens tournants
+// stockés hachés, révocation et détection de la réutilisation d'un ancien
+// refresh token.
+package sessions
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Durée de vie d'une session sans rafraîchissement
+const RefreshTTL = 30 * 24 * time.Hour
+
+// now renvoie l'instant courant en UTC. Les colonnes TIMESTAMP ne gardent pas
+// le fuseau : les dates sont écrites et comparées en UTC depuis Go, jamais
+// avec CURRENT_TIMESTAMP, qui dépend du fuseau de la session SQL.
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+var (
+	ErrInvalid = errors.New("refresh token invalide")
+	ErrReused  = errors.New("refresh token déjà utilisé, session révoquée")
+	ErrRevoked = errors.New("session révoquée ou expirée")
+)
+
+type Session struct {
+	ID        string
+	UserID    string
+	Role      string
+	AccessID  string
+	ExpiresAt time.Time
+}
+
+// Create ouvre une session et renvoie le refresh token en clair, qui n'est
+// jamais conservé tel quel.
+func Create(db *sql.DB, userID, userAgent, ip string) (Session, string, error) {
+	refreshToken, err := newToken()
+	if err != nil {
+		return Session{}, "", err
+	}
+
+	session := Session{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		AccessID:  uuid.New().String(),
+		ExpiresAt: now().Add(RefreshTTL),
+	}
+	_, err = db.Exec(`
+		INSERT INTO sessions (id, user_id, refresh_hash, access_id, user_agent, ip, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, session.ID, session.UserID, hash(refreshToken), session.AccessID, userAgent, ip, session.ExpiresAt)
+	if err != nil {
+		return Session{}, "", err
+	}
+	return session, refreshToken, nil
+}
+
+// Rotate échange un refresh token contre un nouveau et renouvelle l'access
+// token de la session. Présenter le refresh token précédent d'une session
+// signifie qu'il a fuité : la session entière est alors révoquée.
+func Rotate(db *sql.DB, refreshToken string) (Session, string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return Session{}, "", err
+	}
+	defer tx.Rollback()
+
+	hashed := hash(refreshToken)
+	var session Session
+	var revokedAt sql.NullTime
+	err = tx.QueryRow(`
+		SELECT s.id, s.user_id, u.role, s.expires_at, s.revoked_at
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.refresh_hash = $1
+	`, hashed).Scan(&session.ID, &session.UserID, &session.Role, &session.ExpiresAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		tx.Rollback()
+		if err := revokeReused(db, hashed); err != nil {
+			return Session{}, "", err
+		}
+		return Session{}, "", ErrInvalid
+	}
+	if err != nil {
+		return Session{}, "", err
+	}
+	current := now()
+	if revokedAt.Valid || current.After(session.ExpiresAt) {
+		return Session{}, "", ErrRevoked
+	}
+
+	next, err := newToken()
+	if err != nil {
+		return Session{}, "", err
+	}
+	session.AccessID = uuid.New().String()
+	session.ExpiresAt = current.Add(RefreshTTL)
+	// La condition sur refresh_hash écarte une rotation concurrente du même
+	// token : la seconde ne modifie rien et le token est traité comme rejoué
+	res, err := tx.Exec(`
+		UPDATE sessions
+		SET refresh_hash = $1, previous_hash = refresh_hash, access_id = $2,
+			last_used_at = $3, expires_at = $4
+		WHERE id = $5 AND refresh_hash = $6
+	`, hash(next), session.AccessID, current, session.ExpiresAt, session.ID, hashed)
+	if err != nil {
+		return Session{}, "", err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return Session{}, "", err
+	} else if n == 0 {
+		tx.Rollback()
+		if err := revokeReused(db, hashed); err != nil {
+			return Session{}, "", err
+		}
+		return Session{}, "", ErrInvalid
+	}
+	if err := tx.Commit(); err != nil {
+		return Session{}, "", err
+	}
+	return session, next, nil
+}
+
+// revokeReused révoque la session dont hashed était le refresh token
+// précédent, et renvoie ErrReused si c'est le cas.
+func revokeReused(db *sql.DB, hashed string) error {
+	res, err := db.Exec(`
+		UPDATE sessions SET revoked_at = $2
+		WHERE previous_hash = $1 AND revoked_at IS NULL
+	`, hashed, now())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return ErrReused
+	}
+	return nil
+}
+
+// Check vérifie que la session est active et que accessID est bien l'access
+// token courant de la session.
+func Check(db *sql.DB, sessionID, accessID string) error {
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return ErrRevoked
+	}
+
+	var current string
+	err := db.QueryRow(`
+		SELECT access_id FROM sessions
+		WHERE id = $1 AND revoked_at IS NULL AND expires_at > $2
+	`, sessionID, now()).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRevoked
+	}
+	if err != nil {
+		return err
+	}
+	if current != accessID {
+		return ErrRevoked
+	}
+	return nil
+}
+
+func Revoke(db *sql.DB, sessionID string) error {
+	_, err := db.Exec("UPDATE sessions SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL", sessionID, now())
+	return err
+}
+
+// RevokeAll révoque toutes les sessions actives d'un utilisateur.
+func RevokeAll(db *sql.DB, userID string) error {
+	_, err := db.Exec("UPDATE sessions SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL", userID, now())
+	return err
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,178 @@
+package sessions
+
+import (
+	"carbone-app/config"
+	"carbone-app/migrations"
+	"carbone-app/models"
+	"carbone-app/store"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setup ouvre une base SQLite migrée et y crée deux utilisateurs.
+func setup(t *testing.T) (*sql.DB, string, string) {
+	t.Helper()
+	cfg := config.Default().Database
+	cfg.Driver = config.DriverSQLite
+	cfg.DSN = filepath.Join(t.TempDir(), "sessions.db")
+	db, err := config.InitDB(cfg)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := migrations.Up(db, config.DriverSQLite); err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+
+	users := store.NewSQLite(db).Users
+	var ids []string
+	for _, name := range []string{"alice", "bob"} {
+		user := models.User{Email: name + "@example.com", Username: name, Password: "hash", Role: models.RoleUser}
+		if err := users.Create(&user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		ids = append(ids, user.ID)
+	}
+	return db, ids[0], ids[1]
+}
+
+func create(t *testing.T, db *sql.DB, userID string) (Session, string) {
+	t.Helper()
+	session, token, err := Create(db, userID, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return session, token
+}
+
+func TestRotate(t *testing.T) {
+	db, alice, _ := setup(t)
+	session, first := create(t, db, alice)
+	if err := Check(db, session.ID, session.AccessID); err != nil {
+		t.Fatalf("Check après Create: %v", err)
+	}
+
+	rotated, second, err := Rotate(db, first)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if rotated.ID != session.ID || rotated.UserID != alice || rotated.Role != models.RoleUser {
+		t.Errorf("Rotate = %+v, attendu la même session", rotated)
+	}
+	if second == first || rotated.AccessID == session.AccessID {
+		t.Error("Rotate doit renouveler le refresh token et l'access token")
+	}
+
+	// Seul le dernier access token est accepté
+	if err := Check(db, session.ID, session.AccessID); !errors.Is(err, ErrRevoked) {
+		t.Errorf("Check de l'ancien access token: %v, attendu ErrRevoked", err)
+	}
+	if err := Check(db, session.ID, rotated.AccessID); err != nil {
+		t.Errorf("Check du nouvel access token: %v", err)
+	}
+
+	if _, _, err := Rotate(db, second); err != nil {
+		t.Errorf("seconde rotation: %v", err)
+	}
+	if _, _, err := Rotate(db, "inconnu"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Rotate d'un token inconnu: %v, attendu ErrInvalid", err)
+	}
+}
+
+func TestRotateReuseRevokesSession(t *testing.T) {
+	db, alice, _ := setup(t)
+	session, first := create(t, db, alice)
+	other, otherToken := create(t, db, alice)
+
+	rotated, second, err := Rotate(db, first)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+
+	// Le token précédent rejoué trahit une fuite : toute la session tombe,
+	// y compris le token légitime obtenu par la rotation
+	if _, _, err := Rotate(db, first); !errors.Is(err, ErrReused) {
+		t.Fatalf("Rotate du token précédent: %v, attendu ErrReused", err)
+	}
+	if err := Check(db, session.ID, rotated.AccessID); !errors.Is(err, ErrRevoked) {
+		t.Errorf("Check après réutilisation: %v, attendu ErrRevoked", err)
+	}
+	if _, _, err := Rotate(db, second); !errors.Is(err, ErrRevoked) {
+		t.Errorf("Rotate du token courant après réutilisation: %v, attendu ErrRevoked", err)
+	}
+	// Un second rejeu ne révoque plus rien
+	if _, _, err := Rotate(db, first); !errors.Is(err, ErrInvalid) {
+		t.Errorf("second rejeu: %v, attendu ErrInvalid", err)
+	}
+
+	// Les autres sessions de l'utilisateur ne sont pas touchées
+	if err := Check(db, other.ID, other.AccessID); err != nil {
+		t.Errorf("Check d'une autre session: %v", err)
+	}
+	if _, _, err := Rotate(db, otherToken); err != nil {
+		t.Errorf("Rotate d'une autre session: %v", err)
+	}
+}
+
+func TestExpiredSession(t *testing.T) {
+	db, alice, _ := setup(t)
+	session, token := create(t, db, alice)
+	if _, err := db.Exec(`UPDATE sessions SET expires_at = $1 WHERE id = $2`,
+		time.Now().UTC().Add(-time.Minute), session.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Check(db, session.ID, session.AccessID); !errors.Is(err, ErrRevoked) {
+		t.Errorf("Check d'une session expirée: %v, attendu ErrRevoked", err)
+	}
+	if _, _, err := Rotate(db, token); !errors.Is(err, ErrRevoked) {
+		t.Errorf("Rotate d'une session expirée: %v, attendu ErrRevoked", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	db, alice, _ := setup(t)
+	session, _ := create(t, db, alice)
+
+	if err := Check(db, "pas-un-uuid", session.AccessID); !errors.Is(err, ErrRevoked) {
+		t.Errorf("Check d'un identifiant invalide: %v, attendu ErrRevoked", err)
+	}
+	if err := Check(db, session.AccessID, session.AccessID); !errors.Is(err, ErrRevoked) {
+		t.Errorf("Check d'une session inconnue: %v, attendu ErrRevoked", err)
+	}
+	if err := Revoke(db, session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := Check(db, session.ID, session.AccessID); !errors.Is(err, ErrRevoked) {
+		t.Errorf("Check après Revoke: %v, attendu ErrRevoked", err)
+	}
+}
+
+func TestRevokeAll(t *testing.T) {
+	db, alice, bob := setup(t)
+	first, firstToken := create(t, db, alice)
+	second, _ := create(t, db, alice)
+	bobs, bobsToken := create(t, db, bob)
+
+	if err := RevokeAll(db, alice); err != nil {
+		t.Fatalf("RevokeAll: %v", err)
+	}
+	for _, s := range []Session{first, second} {
+		if err := Check(db, s.ID, s.AccessID); !errors.Is(err, ErrRevoked) {
+			t.Errorf("Check après RevokeAll: %v, attendu ErrRevoked", err)
+		}
+	}
+	if _, _, err := Rotate(db, firstToken); !errors.Is(err, ErrRevoked) {
+		t.Errorf("Rotate après RevokeAll: %v, attendu ErrRevoked", err)
+	}
+
+	if err := Check(db, bobs.ID, bobs.AccessID); err != nil {
+		t.Errorf("RevokeAll ne doit pas toucher les autres utilisateurs: %v", err)
+	}
+	if _, _, err := Rotate(db, bobsToken); err != nil {
+		t.Errorf("Rotate d'un autre utilisateur: %v", err)
+	}
+}
@@ -0,0 +1,225 @@
+// Package signing gère les clés de signature des JWT : plusieurs clés
+// identifiées par leur kid peuvent être valides pendant une rotation, une
+// seule sert à signer, et chaque clé n'accepte que son propre algorithme.
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Algorithmes acceptés
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+var (
+	ErrUnknownKey   = errors.New("clé de signature inconnue")
+	ErrAlgorithm    = errors.New("algorithme de signature refusé")
+	ErrNoSigningKey = errors.New("aucune clé de signature active")
+)
+
+// KeyConfig décrit une clé telle qu'elle est configurée. Une clé RS256 ou
+// EdDSA sans clé privée ne sert qu'à vérifier (ancienne clé en rotation).
+type KeyConfig struct {
+	ID             string `json:"id" yaml:"id" toml:"id"`
+	Algorithm      string `json:"algorithm" yaml:"algorithm" toml:"algorithm"`
+	Secret         string `json:"secret,omitempty" yaml:"secret" toml:"secret"`
+	PrivateKeyFile string `json:"privateKeyFile,omitempty" yaml:"privateKeyFile" toml:"privateKeyFile"`
+	PublicKeyFile  string `json:"publicKeyFile,omitempty" yaml:"publicKeyFile" toml:"publicKeyFile"`
+}
+
+type key struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+}
+
+type KeySet struct {
+	active *key
+	keys   map[string]*key
+	order  []string
+}
+
+// New charge les clés configurées ; active est le kid de la clé qui signe.
+func New(active string, configs []KeyConfig) (*KeySet, error) {
+	set := &KeySet{keys: map[string]*key{}}
+	for _, cfg := range configs {
+		if cfg.ID == "" {
+			return nil, fmt.Errorf("clé sans id")
+		}
+		if _, ok := set.keys[cfg.ID]; ok {
+			return nil, fmt.Errorf("clé %s déclarée deux fois", cfg.ID)
+		}
+		k, err := load(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("clé %s: %w", cfg.ID, err)
+		}
+		set.keys[cfg.ID] = k
+		set.order = append(set.order, cfg.ID)
+	}
+
+	k, ok := set.keys[active]
+	if !ok {
+		return nil, fmt.Errorf("clé active %q: %w", active, ErrUnknownKey)
+	}
+	if k.signKey == nil {
+		return nil, fmt.Errorf("clé active %q: %w", active, ErrNoSigningKey)
+	}
+	set.active = k
+	return set, nil
+}
+
+func load(cfg KeyConfig) (*key, error) {
+	switch cfg.Algorithm {
+	case HS256:
+		if len(cfg.Secret) < 32 {
+			return nil, fmt.Errorf("le secret HS256 doit faire au moins 32 caractères")
+		}
+		secret := []byte(cfg.Secret)
+		return &key{id: cfg.ID, method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}, nil
+
+	case RS256:
+		k := &key{id: cfg.ID, method: jwt.SigningMethodRS256}
+		if cfg.PrivateKeyFile != "" {
+			private, err := readPEM(cfg.PrivateKeyFile, func(b []byte) (any, error) { return jwt.ParseRSAPrivateKeyFromPEM(b) })
+			if err != nil {
+				return nil, err
+			}
+			k.signKey = private
+			k.verifyKey = &private.(*rsa.PrivateKey).PublicKey
+		}
+		if cfg.PublicKeyFile != "" {
+			public, err := readPEM(cfg.PublicKeyFile, func(b []byte) (any, error) { return jwt.ParseRSAPublicKeyFromPEM(b) })
+			if err != nil {
+				return nil, err
+			}
+			k.verifyKey = public
+		}
+		if k.verifyKey == nil {
+			return nil, fmt.Errorf("privateKeyFile ou publicKeyFile requis")
+		}
+		return k, nil
+
+	case EdDSA:
+		k := &key{id: cfg.ID, method: jwt.SigningMethodEdDSA}
+		if cfg.PrivateKeyFile != "" {
+			private, err := readPEM(cfg.PrivateKeyFile, func(b []byte) (any, error) { return jwt.ParseEdPrivateKeyFromPEM(b) })
+			if err != nil {
+				return nil, err
+			}
+			k.signKey = private
+			k.verifyKey = private.(ed25519.PrivateKey).Public()
+		}
+		if cfg.PublicKeyFile != "" {
+			public, err := readPEM(cfg.PublicKeyFile, func(b []byte) (any, error) { return jwt.ParseEdPublicKeyFromPEM(b) })
+			if err != nil {
+				return nil, err
+			}
+			k.verifyKey = public
+		}
+		if k.verifyKey == nil {
+			return nil, fmt.Errorf("privateKeyFile ou publicKeyFile requis")
+		}
+		return k, nil
+	}
+	return nil, fmt.Errorf("algorithme %q: %w", cfg.Algorithm, ErrAlgorithm)
+}
+
+func readPEM(path string, parse func([]byte) (any, error)) (any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parse(data)
+}
+
+// Sign signe les claims avec la clé active et ajoute son kid à l'en-tête.
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.active.method, claims)
+	token.Header["kid"] = s.active.id
+	return token.SignedString(s.active.signKey)
+}
+
+// Parse vérifie un token : le kid doit désigner une clé connue et
+// l'algorithme de l'en-tête doit être exactement celui de cette clé.
+func (s *KeySet) Parse(tokenStr string, claims jwt.Claims) (*jwt.Token, error) {
+	parser := &jwt.Parser{ValidMethods: s.methods()}
+	return parser.ParseWithClaims(tokenStr, claims, s.keyfunc)
+}
+
+func (s *KeySet) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	k, ok := s.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, ErrAlgorithm
+	}
+	return k.verifyKey, nil
+}
+
+func (s *KeySet) methods() []string {
+	seen := map[string]bool{}
+	var methods []string
+	for _, id := range s.order {
+		alg := s.keys[id].method.Alg()
+		if !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+// JWK est une clé publique au format JSON Web Key (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS renvoie les clés publiques ; les secrets HS256 ne sont jamais publiés.
+func (s *KeySet) JWKS() []JWK {
+	keys := []JWK{}
+	for _, id := range s.order {
+		k := s.keys[id]
+		switch public := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, JWK{
+				Kty: "RSA",
+				Kid: id,
+				Use: "sig",
+				Alg: RS256,
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			keys = append(keys, JWK{
+				Kty: "OKP",
+				Kid: id,
+				Use: "sig",
+				Alg: EdDSA,
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+	return keys
+}
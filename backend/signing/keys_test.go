@@ -0,0 +1,294 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const secret = "0123456789abcdef0123456789abcdef"
+
+// writePEM écrit un bloc PEM dans le répertoire du test et renvoie son chemin.
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// rsaKey génère une clé RSA et renvoie la clé et les chemins de ses fichiers
+// privé et public.
+func rsaKey(t *testing.T) (*rsa.PrivateKey, string, string) {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return private,
+		writePEM(t, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(private)),
+		writePEM(t, "rsa.pub.pem", "PUBLIC KEY", public)
+}
+
+func edKey(t *testing.T) (ed25519.PublicKey, string) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return public, writePEM(t, "ed.pem", "PRIVATE KEY", der)
+}
+
+// cause renvoie l'erreur de la fonction de clé enveloppée par le parseur.
+func cause(err error) error {
+	var validation *jwt.ValidationError
+	if errors.As(err, &validation) && validation.Inner != nil {
+		return validation.Inner
+	}
+	return err
+}
+
+func claims() jwt.MapClaims {
+	return jwt.MapClaims{"sub": "alice"}
+}
+
+func TestSignAndParseByKid(t *testing.T) {
+	_, rsaPrivate, _ := rsaKey(t)
+	_, edPrivate := edKey(t)
+	configs := []KeyConfig{
+		{ID: "hs", Algorithm: HS256, Secret: secret},
+		{ID: "rs", Algorithm: RS256, PrivateKeyFile: rsaPrivate},
+		{ID: "ed", Algorithm: EdDSA, PrivateKeyFile: edPrivate},
+	}
+
+	for _, active := range []string{"hs", "rs", "ed"} {
+		set, err := New(active, configs)
+		if err != nil {
+			t.Fatalf("New(%s): %v", active, err)
+		}
+		signed, err := set.Sign(claims())
+		if err != nil {
+			t.Fatalf("Sign(%s): %v", active, err)
+		}
+		var got jwt.MapClaims
+		token, err := set.Parse(signed, &got)
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", active, err)
+		}
+		if token.Header["kid"] != active || got["sub"] != "alice" {
+			t.Errorf("token %s: kid %v, sub %v", active, token.Header["kid"], got["sub"])
+		}
+	}
+}
+
+func TestParseUnknownKid(t *testing.T) {
+	set, err := New("hs", []KeyConfig{{ID: "hs", Algorithm: HS256, Secret: secret}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kid := range []any{"autre", nil} {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+		if kid != nil {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := set.Parse(signed, &jwt.MapClaims{}); !errors.Is(cause(err), ErrUnknownKey) {
+			t.Errorf("kid %v: %v, attendu ErrUnknownKey", kid, err)
+		}
+	}
+}
+
+func TestParsePinsAlgorithm(t *testing.T) {
+	_, rsaPrivate, rsaPublic := rsaKey(t)
+	set, err := New("rs", []KeyConfig{
+		{ID: "rs", Algorithm: RS256, PrivateKeyFile: rsaPrivate},
+		{ID: "hs", Algorithm: HS256, Secret: secret},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Confusion d'algorithme : HMAC avec la clé publique RSA comme secret,
+	// sous le kid de la clé RS256, alors que HS256 est accepté pour une autre
+	// clé du jeu
+	publicPEM, err := os.ReadFile(rsaPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+	forged.Header["kid"] = "rs"
+	signed, err := forged.SignedString(publicPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := set.Parse(signed, &jwt.MapClaims{}); !errors.Is(cause(err), ErrAlgorithm) {
+		t.Errorf("HS256 sous un kid RS256: %v, attendu ErrAlgorithm", err)
+	}
+
+	// Un secret HS256 ne vérifie pas un token qui se dit RS256
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+	hs.Header["kid"] = "hs"
+	hs.Header["alg"] = RS256
+	signed, err = hs.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := set.Parse(signed, &jwt.MapClaims{}); err == nil {
+		t.Error("en-tête alg falsifié accepté")
+	}
+
+	// alg=none n'est jamais accepté
+	for _, kid := range []string{"rs", "hs"} {
+		none := jwt.NewWithClaims(jwt.SigningMethodNone, claims())
+		none.Header["kid"] = kid
+		signed, err := none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := set.Parse(signed, &jwt.MapClaims{}); err == nil {
+			t.Errorf("alg=none sous le kid %s accepté", kid)
+		}
+	}
+}
+
+func TestRotation(t *testing.T) {
+	_, rsaPrivate, rsaPublic := rsaKey(t)
+
+	// Avant : seule l'ancienne clé HS256 signe
+	before, err := New("old", []KeyConfig{{ID: "old", Algorithm: HS256, Secret: secret}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := before.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Pendant : la nouvelle clé signe, l'ancienne vérifie encore
+	during, err := New("new", []KeyConfig{
+		{ID: "old", Algorithm: HS256, Secret: secret},
+		{ID: "new", Algorithm: RS256, PrivateKeyFile: rsaPrivate},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := during.Parse(oldToken, &jwt.MapClaims{}); err != nil {
+		t.Errorf("ancien token pendant la rotation: %v", err)
+	}
+	newToken, err := during.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Après : l'ancienne clé est retirée. Une clé réduite à sa clé publique
+	// ne peut pas être la clé active
+	if _, err := New("new", []KeyConfig{{ID: "new", Algorithm: RS256, PublicKeyFile: rsaPublic}}); !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("clé active sans clé privée: %v, attendu ErrNoSigningKey", err)
+	}
+	after, err := New("new", []KeyConfig{{ID: "new", Algorithm: RS256, PrivateKeyFile: rsaPrivate}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// HS256 n'étant plus accepté par aucune clé, le token est refusé avant
+	// même la recherche du kid
+	if _, err := after.Parse(oldToken, &jwt.MapClaims{}); err == nil {
+		t.Error("ancien token accepté après la rotation")
+	}
+	if _, err := after.Parse(newToken, &jwt.MapClaims{}); err != nil {
+		t.Errorf("nouveau token après la rotation: %v", err)
+	}
+}
+
+func TestNewRejectsInvalidConfig(t *testing.T) {
+	cases := map[string]struct {
+		active  string
+		configs []KeyConfig
+		want    error
+	}{
+		"clé active inconnue": {"absente", []KeyConfig{{ID: "hs", Algorithm: HS256, Secret: secret}}, ErrUnknownKey},
+		"algorithme inconnu":  {"x", []KeyConfig{{ID: "x", Algorithm: "none"}}, ErrAlgorithm},
+		"secret trop court":   {"hs", []KeyConfig{{ID: "hs", Algorithm: HS256, Secret: "court"}}, nil},
+		"sans id":             {"", []KeyConfig{{Algorithm: HS256, Secret: secret}}, nil},
+		"RS256 sans fichier":  {"rs", []KeyConfig{{ID: "rs", Algorithm: RS256}}, nil},
+		"id en double": {"hs", []KeyConfig{
+			{ID: "hs", Algorithm: HS256, Secret: secret},
+			{ID: "hs", Algorithm: HS256, Secret: secret},
+		}, nil},
+	}
+	for name, c := range cases {
+		_, err := New(c.active, c.configs)
+		if err == nil || (c.want != nil && !errors.Is(err, c.want)) {
+			t.Errorf("%s: %v, attendu %v", name, err, c.want)
+		}
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaPrivate, rsaPrivateFile, rsaPublicFile := rsaKey(t)
+	edPublic, edPrivateFile := edKey(t)
+	set, err := New("hs", []KeyConfig{
+		{ID: "hs", Algorithm: HS256, Secret: secret},
+		{ID: "rs", Algorithm: RS256, PrivateKeyFile: rsaPrivateFile},
+		{ID: "rs-old", Algorithm: RS256, PublicKeyFile: rsaPublicFile},
+		{ID: "ed", Algorithm: EdDSA, PrivateKeyFile: edPrivateFile},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := set.JWKS()
+	if len(keys) != 3 {
+		t.Fatalf("JWKS = %+v, attendu 3 clés publiques sans le secret HS256", keys)
+	}
+	for _, k := range keys {
+		if k.Kid == "hs" || k.Use != "sig" {
+			t.Errorf("clé publiée: %+v", k)
+		}
+	}
+
+	for _, k := range keys[:2] {
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k.Kty != "RSA" || k.Alg != RS256 || new(big.Int).SetBytes(n).Cmp(rsaPrivate.N) != 0 ||
+			new(big.Int).SetBytes(e).Int64() != int64(rsaPrivate.E) {
+			t.Errorf("JWK RSA %s ne correspond pas à la clé", k.Kid)
+		}
+	}
+
+	ed := keys[2]
+	x, err := base64.RawURLEncoding.DecodeString(ed.X)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ed.Kid != "ed" || ed.Kty != "OKP" || ed.Crv != "Ed25519" || ed.Alg != EdDSA || !edPublic.Equal(ed25519.PublicKey(x)) {
+		t.Errorf("JWK Ed25519 = %+v", ed)
+	}
+}
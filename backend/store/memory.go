@@ -0,0 +1,638 @@
+package store
+
+import (
+	"carbone-app/models"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// memory garde toutes les données en mémoire, derrière un même verrou.
+type memory struct {
+	mu             sync.RWMutex
+	users          map[string]models.User
+	results        map[string]models.Result
+	revisions      map[string][]models.ResultRevision
+	activities     map[uint]models.Activity
+	factors        []models.CarbonFactor
+	nextActivityID uint
+}
+
+// NewMemory renvoie des magasins en mémoire, vides en dehors du catalogue
+// des facteurs d'activité. Ils servent aux tests et au développement.
+func NewMemory() Stores {
+	m := &memory{
+		users:      map[string]models.User{},
+		results:    map[string]models.Result{},
+		revisions:  map[string][]models.ResultRevision{},
+		activities: map[uint]models.Activity{},
+		factors:    defaultFactors,
+	}
+	return Stores{
+		Users:      memoryUsers{m},
+		Results:    memoryResults{m},
+		Activities: memoryActivities{m},
+	}
+}
+
+// day ramène une date à minuit UTC, comme une colonne DATE.
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+type memoryUsers struct {
+	*memory
+}
+
+func (s memoryUsers) emailTaken(email, except string) bool {
+	for id, user := range s.users {
+		if id != except && user.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+func (s memoryUsers) Create(user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.emailTaken(user.Email, "") {
+		return ErrEmailTaken
+	}
+	if user.ID == "" {
+		user.ID = uuid.New().String()
+	}
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	if user.CreatedAt == nil {
+		now := time.Now()
+		user.CreatedAt = &now
+	}
+	s.users[user.ID] = *user
+	return nil
+}
+
+func (s memoryUsers) Get(id string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (s memoryUsers) FindByEmail(email string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := []models.User{}
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, email) {
+			users = append(users, user)
+		}
+	}
+	if len(users) == 0 {
+		return models.User{}, ErrNotFound
+	}
+	sort.Slice(users, func(i, j int) bool {
+		ei, ej := users[i].Email == email, users[j].Email == email
+		if ei != ej {
+			return ei
+		}
+		return users[i].CreatedAt.Before(*users[j].CreatedAt)
+	})
+	return users[0], nil
+}
+
+func (s memoryUsers) FindByLogin(identifier string) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := []models.User{}
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, identifier) || user.Username == identifier {
+			users = append(users, user)
+		}
+	}
+	sort.SliceStable(users, func(i, j int) bool {
+		ei, ej := strings.EqualFold(users[i].Email, identifier), strings.EqualFold(users[j].Email, identifier)
+		if ei != ej {
+			return ei
+		}
+		return users[i].CreatedAt.Before(*users[j].CreatedAt)
+	})
+	return users, nil
+}
+
+func (s memoryUsers) UpdateProfile(id, username, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if s.emailTaken(email, id) {
+		return ErrEmailTaken
+	}
+	if user.Email != email {
+		user.EmailVerifiedAt = nil
+	}
+	user.Username = username
+	user.Email = email
+	s.users[id] = user
+	return nil
+}
+
+func (s memoryUsers) UpdatePassword(id, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Password = hash
+	s.users[id] = user
+	return nil
+}
+
+func (s memoryUsers) UpdateRole(id, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Role = role
+	s.users[id] = user
+	return nil
+}
+
+func (s memoryUsers) MarkEmailVerified(id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if user.EmailVerifiedAt == nil {
+		at = at.UTC()
+		user.EmailVerifiedAt = &at
+	}
+	s.users[id] = user
+	return nil
+}
+
+func (s memoryUsers) List(query UserQuery) ([]models.User, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	search := strings.ToLower(query.Search)
+	users := []models.User{}
+	for _, user := range s.users {
+		if (strings.Contains(strings.ToLower(user.Email), search) || strings.Contains(strings.ToLower(user.Username), search)) &&
+			(query.Role == "" || user.Role == query.Role) {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if !users[i].CreatedAt.Equal(*users[j].CreatedAt) {
+			return users[i].CreatedAt.After(*users[j].CreatedAt)
+		}
+		return users[i].Email < users[j].Email
+	})
+
+	total := len(users)
+	if query.Limit > 0 {
+		users = users[min(query.Offset, total):min(query.Offset+query.Limit, total)]
+	}
+	return users, total, nil
+}
+
+func (s memoryUsers) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.users, id)
+	for key, result := range s.results {
+		if result.UserID == id {
+			delete(s.results, key)
+		}
+	}
+	// L'historique des résultats déjà supprimés part aussi avec le compte
+	for resultID, revisions := range s.revisions {
+		if len(revisions) > 0 && revisions[0].UserID == id {
+			delete(s.revisions, resultID)
+		}
+	}
+	for key, activity := range s.activities {
+		if activity.UserID == id {
+			delete(s.activities, key)
+		}
+	}
+	return nil
+}
+
+type memoryResults struct {
+	*memory
+}
+
+func resultKey(result models.Result) string {
+	return result.UserID + "|" + result.Category + "|" + day(result.Month).Format("2006-01-02")
+}
+
+// byID cherche un résultat de l'utilisateur ; le verrou doit être tenu.
+func (s memoryResults) byID(userID, id string) (string, models.Result, bool) {
+	for key, result := range s.results {
+		if result.ID == id && result.UserID == userID {
+			return key, result, true
+		}
+	}
+	return "", models.Result{}, false
+}
+
+// record ajoute l'état du résultat à son historique ; le verrou doit être
+// tenu en écriture.
+func (s memoryResults) record(result models.Result, change Change, restoredFrom *int) {
+	revision := models.ResultRevision{
+		ID:             uuid.New().String(),
+		ResultID:       result.ID,
+		UserID:         result.UserID,
+		Revision:       result.Revision,
+		Value:          result.Value,
+		Inputs:         result.Inputs,
+		FactorSetID:    result.FactorSetID,
+		Breakdown:      result.Breakdown,
+		SubmittedValue: result.SubmittedValue,
+		Flagged:        result.Flagged,
+		Source:         change.Source,
+		RestoredFrom:   restoredFrom,
+		CreatedAt:      result.UpdatedAt,
+	}
+	if change.By != "" {
+		by := change.By
+		revision.ChangedBy = &by
+	}
+	s.revisions[result.ID] = append(s.revisions[result.ID], revision)
+}
+
+// upsert suppose le verrou tenu en écriture.
+func (s memoryResults) upsert(result *models.Result, change Change) {
+	if result.ID == "" {
+		result.ID = uuid.New().String()
+	}
+	now := time.Now()
+	if result.CreatedAt.IsZero() {
+		result.CreatedAt = now
+	}
+	result.Month = day(result.Month)
+	result.UpdatedAt = now
+	result.Revision = 1
+
+	key := resultKey(*result)
+	if existing, ok := s.results[key]; ok {
+		result.ID = existing.ID
+		result.CreatedAt = existing.CreatedAt
+		result.Revision = existing.Revision + 1
+	}
+	s.results[key] = *result
+	s.record(*result, change, nil)
+}
+
+func (s memoryResults) Upsert(result *models.Result, change Change) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.upsert(result, change)
+	return nil
+}
+
+func (s memoryResults) Insert(result *models.Result, change Change) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	probe := *result
+	probe.Month = day(probe.Month)
+	if _, ok := s.results[resultKey(probe)]; ok {
+		return ErrConflict
+	}
+	s.upsert(result, change)
+	return nil
+}
+
+func (s memoryResults) UpsertMany(results []models.Result, change Change) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range results {
+		s.upsert(&results[i], change)
+	}
+	return nil
+}
+
+func (s memoryResults) Get(userID, id string) (models.Result, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, result, ok := s.byID(userID, id)
+	if !ok {
+		return models.Result{}, ErrNotFound
+	}
+	return result, nil
+}
+
+func (s memoryResults) List(userID string) ([]models.Result, error) {
+	return s.Find(userID, ResultQuery{})
+}
+
+// before indique si a précède b dans l'ordre de la requête.
+func (q ResultQuery) before(a, b ResultCursor) bool {
+	if !a.Month.Equal(b.Month) {
+		return a.Month.Before(b.Month) == q.Ascending
+	}
+	return a.Category < b.Category
+}
+
+func (q ResultQuery) match(result models.Result) bool {
+	if q.From != nil && result.Month.Before(day(*q.From)) {
+		return false
+	}
+	if q.To != nil && result.Month.After(day(*q.To)) {
+		return false
+	}
+	if len(q.Categories) > 0 && !slices.Contains(q.Categories, result.Category) {
+		return false
+	}
+	if q.After != nil {
+		after := ResultCursor{day(q.After.Month), q.After.Category}
+		return q.before(after, ResultCursor{result.Month, result.Category})
+	}
+	return true
+}
+
+func (s memoryResults) Find(userID string, q ResultQuery) ([]models.Result, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	results := []models.Result{}
+	for _, result := range s.results {
+		if result.UserID == userID && q.match(result) {
+			results = append(results, result)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return q.before(ResultCursor{results[i].Month, results[i].Category}, ResultCursor{results[j].Month, results[j].Category})
+	})
+	if q.Limit > 0 && len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results, nil
+}
+
+func (s memoryResults) History(userID, id string) ([]models.ResultRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, _, ok := s.byID(userID, id); !ok {
+		return nil, ErrNotFound
+	}
+	revisions := []models.ResultRevision{}
+	for i := len(s.revisions[id]) - 1; i >= 0; i-- {
+		revisions = append(revisions, s.revisions[id][i])
+	}
+	return revisions, nil
+}
+
+func (s memoryResults) Restore(userID, id string, revision, expected int, by string) (models.Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, result, err := s.current(userID, id, expected)
+	if err != nil {
+		return models.Result{}, err
+	}
+	for _, rev := range s.revisions[id] {
+		if rev.Revision != revision {
+			continue
+		}
+		result.Value = rev.Value
+		result.Inputs = rev.Inputs
+		result.FactorSetID = rev.FactorSetID
+		result.Breakdown = rev.Breakdown
+		result.SubmittedValue = rev.SubmittedValue
+		result.Flagged = rev.Flagged
+		result.UpdatedAt = time.Now()
+		result.Revision++
+		s.results[key] = result
+		s.record(result, Change{By: by, Source: SourceRestore}, &revision)
+		return result, nil
+	}
+	return models.Result{}, ErrNotFound
+}
+
+// current cherche le résultat et vérifie sa révision ; le verrou doit être
+// tenu.
+func (s memoryResults) current(userID, id string, revision int) (string, models.Result, error) {
+	key, result, ok := s.byID(userID, id)
+	if !ok {
+		return "", result, ErrNotFound
+	}
+	if revision > 0 && result.Revision != revision {
+		return "", result, ErrConflict
+	}
+	return key, result, nil
+}
+
+func (s memoryResults) Update(result *models.Result, revision int, change Change) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, existing, err := s.current(result.UserID, result.ID, revision)
+	if err != nil {
+		return err
+	}
+	existing.Value = result.Value
+	existing.Inputs = result.Inputs
+	existing.FactorSetID = result.FactorSetID
+	existing.Breakdown = result.Breakdown
+	existing.SubmittedValue = result.SubmittedValue
+	existing.Flagged = result.Flagged
+	existing.UpdatedAt = time.Now()
+	existing.Revision++
+	s.results[key] = existing
+	s.record(existing, change, nil)
+	*result = existing
+	return nil
+}
+
+func (s memoryResults) Delete(userID, id string, revision int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, result, err := s.current(userID, id, revision)
+	if err != nil {
+		return err
+	}
+	s.remove(key, result)
+	return nil
+}
+
+// remove supprime le résultat en gardant son historique, clos par une
+// révision SourceDelete ; le verrou doit être tenu en écriture.
+func (s memoryResults) remove(key string, result models.Result) {
+	result.UpdatedAt = time.Now()
+	result.Revision++
+	s.record(result, Change{By: result.UserID, Source: SourceDelete}, nil)
+	delete(s.results, key)
+}
+
+func (s memoryResults) DeleteMonth(userID string, month time.Time, expected map[string]int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := map[string]models.Result{}
+	revisions := map[string]int{}
+	for key, result := range s.results {
+		if result.UserID == userID && result.Month.Equal(day(month)) {
+			keys[key] = result
+			revisions[result.ID] = result.Revision
+		}
+	}
+	if expected != nil && !sameRevisions(revisions, expected) {
+		return 0, ErrConflict
+	}
+	for key, result := range keys {
+		s.remove(key, result)
+	}
+	return len(keys), nil
+}
+
+type memoryActivities struct {
+	*memory
+}
+
+func (s memoryActivities) Factors() ([]models.CarbonFactor, error) {
+	factors := append([]models.CarbonFactor{}, s.factors...)
+	sort.Slice(factors, func(i, j int) bool {
+		if factors[i].Category != factors[j].Category {
+			return factors[i].Category < factors[j].Category
+		}
+		return factors[i].Name < factors[j].Name
+	})
+	return factors, nil
+}
+
+func (s memoryActivities) Factor(activityID string) (models.CarbonFactor, error) {
+	for _, factor := range s.factors {
+		if factor.ID == activityID {
+			return factor, nil
+		}
+	}
+	return models.CarbonFactor{}, ErrNotFound
+}
+
+// inRange indique si l'activité est de l'utilisateur et dans la période.
+func inRange(activity models.Activity, userID string, from, to *time.Time) bool {
+	return activity.UserID == userID &&
+		(from == nil || !activity.Date.Before(day(*from))) &&
+		(to == nil || !activity.Date.After(day(*to)))
+}
+
+func (s memoryActivities) List(userID string, from, to *time.Time) ([]models.Activity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	activities := []models.Activity{}
+	for _, activity := range s.activities {
+		if inRange(activity, userID, from, to) {
+			activities = append(activities, activity)
+		}
+	}
+	sort.Slice(activities, func(i, j int) bool {
+		if !activities[i].Date.Equal(activities[j].Date) {
+			return activities[i].Date.After(activities[j].Date)
+		}
+		return activities[i].ID > activities[j].ID
+	})
+	return activities, nil
+}
+
+func (s memoryActivities) Get(userID string, id uint) (models.Activity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	activity, ok := s.activities[id]
+	if !ok || activity.UserID != userID {
+		return models.Activity{}, ErrNotFound
+	}
+	return activity, nil
+}
+
+func (s memoryActivities) Create(activity *models.Activity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if activity.CreatedAt.IsZero() {
+		activity.CreatedAt = time.Now()
+	}
+	activity.Date = day(activity.Date)
+	s.nextActivityID++
+	activity.ID = s.nextActivityID
+	s.activities[activity.ID] = *activity
+	return nil
+}
+
+func (s memoryActivities) Update(activity models.Activity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.activities[activity.ID]
+	if !ok || existing.UserID != activity.UserID {
+		return ErrNotFound
+	}
+	activity.Date = day(activity.Date)
+	activity.CreatedAt = existing.CreatedAt
+	s.activities[activity.ID] = activity
+	return nil
+}
+
+func (s memoryActivities) Delete(userID string, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	activity, ok := s.activities[id]
+	if !ok || activity.UserID != userID {
+		return ErrNotFound
+	}
+	delete(s.activities, id)
+	return nil
+}
+
+func (s memoryActivities) Total(userID string, from, to *time.Time) (float64, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var total float64
+	var count int
+	for _, activity := range s.activities {
+		if inRange(activity, userID, from, to) {
+			total += activity.CarbonAmount
+			count++
+		}
+	}
+	return total, count, nil
+}
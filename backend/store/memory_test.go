@@ -0,0 +1,13 @@
+package store_test
+
+import (
+	"carbone-app/store"
+	"carbone-app/store/storetest"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Stores {
+		return store.NewMemory()
+	})
+}
@@ -0,0 +1,319 @@
+package store
+
+import (
+	"carbone-app/models"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// NewPostgres renvoie les magasins adossés à la base PostgreSQL.
+func NewPostgres(db *sql.DB) Stores {
+	return Stores{
+		Users:      postgresUsers{db},
+		Results:    sqlResults{db, postgresDialect},
+		Activities: postgresActivities{db},
+	}
+}
+
+type postgresUsers struct {
+	db *sql.DB
+}
+
+// uniqueViolation reconnaît la violation d'une contrainte d'unicité.
+func uniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func (s postgresUsers) Create(user *models.User) error {
+	if user.ID == "" {
+		user.ID = uuid.New().String()
+	}
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	if user.CreatedAt == nil {
+		now := time.Now()
+		user.CreatedAt = &now
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO users (id, email, username, password, role, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, user.ID, user.Email, user.Username, user.Password, user.Role, user.CreatedAt)
+	if uniqueViolation(err) {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+const userColumns = `id, email, username, password, role, created_at, email_verified_at`
+
+func scanUser(row interface{ Scan(...any) error }) (models.User, error) {
+	var user models.User
+	var createdAt, verifiedAt sql.NullTime
+	err := row.Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.Role, &createdAt, &verifiedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, ErrNotFound
+	}
+	if createdAt.Valid {
+		user.CreatedAt = &createdAt.Time
+	}
+	if verifiedAt.Valid {
+		user.EmailVerifiedAt = &verifiedAt.Time
+	}
+	return user, err
+}
+
+func (s postgresUsers) Get(id string) (models.User, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return models.User{}, ErrNotFound
+	}
+	return scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = $1", id))
+}
+
+func (s postgresUsers) FindByEmail(email string) (models.User, error) {
+	return scanUser(s.db.QueryRow(`
+		SELECT `+userColumns+`
+		FROM users
+		WHERE LOWER(email) = LOWER($1)
+		ORDER BY email = $1 DESC, created_at
+		LIMIT 1
+	`, email))
+}
+
+func (s postgresUsers) FindByLogin(identifier string) ([]models.User, error) {
+	rows, err := s.db.Query(`
+		SELECT `+userColumns+`
+		FROM users
+		WHERE LOWER(email) = LOWER($1) OR username = $1
+		ORDER BY LOWER(email) = LOWER($1) DESC, created_at
+	`, identifier)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s postgresUsers) UpdateProfile(id, username, email string) error {
+	res, err := s.db.Exec(`
+		UPDATE users
+		SET username = $1, email = $2,
+			email_verified_at = CASE WHEN email = $2 THEN email_verified_at ELSE NULL END
+		WHERE id = $3
+	`, username, email, id)
+	if uniqueViolation(err) {
+		return ErrEmailTaken
+	}
+	return affected(res, err)
+}
+
+func (s postgresUsers) UpdatePassword(id, hash string) error {
+	return affected(s.db.Exec("UPDATE users SET password = $1 WHERE id = $2", hash, id))
+}
+
+func (s postgresUsers) UpdateRole(id, role string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrNotFound
+	}
+	return affected(s.db.Exec("UPDATE users SET role = $1 WHERE id = $2", role, id))
+}
+
+func (s postgresUsers) MarkEmailVerified(id string, at time.Time) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrNotFound
+	}
+	return affected(s.db.Exec(`
+		UPDATE users SET email_verified_at = COALESCE(email_verified_at, $2)
+		WHERE id = $1
+	`, id, at.UTC()))
+}
+
+// likeEscaper neutralise les jokers de LIKE, pour chercher un texte tel quel.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (s postgresUsers) List(query UserQuery) ([]models.User, int, error) {
+	search := "%" + likeEscaper.Replace(query.Search) + "%"
+	filter := `
+		FROM users
+		WHERE (LOWER(email) LIKE LOWER($1) ESCAPE '\' OR LOWER(username) LIKE LOWER($1) ESCAPE '\')
+			AND ($2 = '' OR role = $2)`
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*)"+filter, search, query.Role).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	statement := "SELECT " + userColumns + filter + " ORDER BY created_at DESC, email"
+	args := []any{search, query.Role}
+	if query.Limit > 0 {
+		statement += " LIMIT $3 OFFSET $4"
+		args = append(args, query.Limit, query.Offset)
+	}
+	rows, err := s.db.Query(statement, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	return users, total, rows.Err()
+}
+
+func (s postgresUsers) Delete(id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrNotFound
+	}
+	return affected(s.db.Exec("DELETE FROM users WHERE id = $1", id))
+}
+
+// affected renvoie ErrNotFound si la requête n'a touché aucune ligne.
+func affected(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type postgresActivities struct {
+	db *sql.DB
+}
+
+func (s postgresActivities) Factors() ([]models.CarbonFactor, error) {
+	rows, err := s.db.Query("SELECT id, name, category, factor, unit FROM carbon_factors ORDER BY category, name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	factors := []models.CarbonFactor{}
+	for rows.Next() {
+		var factor models.CarbonFactor
+		if err := rows.Scan(&factor.ID, &factor.Name, &factor.Category, &factor.Factor, &factor.Unit); err != nil {
+			return nil, err
+		}
+		factors = append(factors, factor)
+	}
+	return factors, rows.Err()
+}
+
+func (s postgresActivities) Factor(activityID string) (models.CarbonFactor, error) {
+	var factor models.CarbonFactor
+	err := s.db.QueryRow("SELECT id, name, category, factor, unit FROM carbon_factors WHERE id = $1", activityID).
+		Scan(&factor.ID, &factor.Name, &factor.Category, &factor.Factor, &factor.Unit)
+	if errors.Is(err, sql.ErrNoRows) {
+		return factor, ErrNotFound
+	}
+	return factor, err
+}
+
+const activityColumns = `id, user_id, activity_id, quantity, date, carbon_amount, factor_set_id, created_at`
+
+func scanActivity(row interface{ Scan(...any) error }) (models.Activity, error) {
+	var activity models.Activity
+	var factorSetID sql.NullString
+	err := row.Scan(&activity.ID, &activity.UserID, &activity.ActivityID, &activity.Quantity,
+		&activity.Date, &activity.CarbonAmount, &factorSetID, &activity.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return activity, ErrNotFound
+	}
+	if factorSetID.Valid {
+		activity.FactorSetID = &factorSetID.String
+	}
+	return activity, err
+}
+
+func (s postgresActivities) List(userID string, from, to *time.Time) ([]models.Activity, error) {
+	rows, err := s.db.Query(`
+		SELECT `+activityColumns+`
+		FROM activities
+		WHERE user_id = $1
+			AND ($2::date IS NULL OR date >= $2)
+			AND ($3::date IS NULL OR date <= $3)
+		ORDER BY date DESC, id DESC
+	`, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activities := []models.Activity{}
+	for rows.Next() {
+		activity, err := scanActivity(rows)
+		if err != nil {
+			return nil, err
+		}
+		activities = append(activities, activity)
+	}
+	return activities, rows.Err()
+}
+
+func (s postgresActivities) Get(userID string, id uint) (models.Activity, error) {
+	return scanActivity(s.db.QueryRow(`
+		SELECT `+activityColumns+`
+		FROM activities
+		WHERE id = $1 AND user_id = $2
+	`, id, userID))
+}
+
+func (s postgresActivities) Create(activity *models.Activity) error {
+	if activity.CreatedAt.IsZero() {
+		activity.CreatedAt = time.Now()
+	}
+	return s.db.QueryRow(`
+		INSERT INTO activities (user_id, activity_id, quantity, date, carbon_amount, factor_set_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, activity.UserID, activity.ActivityID, activity.Quantity, activity.Date, activity.CarbonAmount, activity.FactorSetID,
+		activity.CreatedAt).Scan(&activity.ID)
+}
+
+func (s postgresActivities) Update(activity models.Activity) error {
+	return affected(s.db.Exec(`
+		UPDATE activities
+		SET activity_id = $1, quantity = $2, date = $3, carbon_amount = $4, factor_set_id = $5
+		WHERE id = $6 AND user_id = $7
+	`, activity.ActivityID, activity.Quantity, activity.Date, activity.CarbonAmount, activity.FactorSetID,
+		activity.ID, activity.UserID))
+}
+
+func (s postgresActivities) Delete(userID string, id uint) error {
+	return affected(s.db.Exec("DELETE FROM activities WHERE id = $1 AND user_id = $2", id, userID))
+}
+
+func (s postgresActivities) Total(userID string, from, to *time.Time) (float64, int, error) {
+	var total float64
+	var count int
+	err := s.db.QueryRow(`
+		SELECT COALESCE(SUM(carbon_amount), 0), COUNT(*)
+		FROM activities
+		WHERE user_id = $1
+			AND ($2::date IS NULL OR date >= $2)
+			AND ($3::date IS NULL OR date <= $3)
+	`, userID, from, to).Scan(&total, &count)
+	return total, count, err
+}
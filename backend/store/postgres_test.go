@@ -0,0 +1,35 @@
+package store_test
+
+import (
+	"carbone-app/config"
+	"carbone-app/migrations"
+	"carbone-app/store"
+	"carbone-app/store/storetest"
+	"os"
+	"testing"
+)
+
+// TestPostgres exécute le contrat sur la base désignée par
+// STORE_TEST_POSTGRES_DSN, de préférence une base de test : les cas créent et
+// suppriment leurs propres comptes.
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("STORE_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("STORE_TEST_POSTGRES_DSN non défini")
+	}
+
+	cfg := config.Default().Database
+	cfg.Driver = config.DriverPostgres
+	cfg.DSN = dsn
+	db, err := config.InitDB(cfg)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := migrations.Up(db, config.DriverPostgres); err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+
+	stores := store.NewPostgres(db)
+	storetest.Run(t, func(t *testing.T) store.Stores { return stores })
+}
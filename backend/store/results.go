@@ -0,0 +1,497 @@
+package store
+
+import (
+	"carbone-app/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// dialect regroupe ce qui distingue PostgreSQL de SQLite dans les requêtes
+// communes sur les résultats.
+type dialect struct {
+	// date convertit une date en valeur de colonne DATE
+	date func(time.Time) any
+	// json convertit un document JSON en valeur de colonne, NULL s'il est vide
+	json func([]byte) any
+}
+
+var postgresDialect = dialect{
+	date: func(t time.Time) any { return t },
+	json: func(raw []byte) any {
+		if len(raw) == 0 {
+			return nil
+		}
+		return raw
+	},
+}
+
+// SQLite stocke les dates en AAAA-MM-JJ et le JSON en TEXT
+var sqliteDialect = dialect{
+	date: func(t time.Time) any { return Date(t) },
+	json: func(raw []byte) any {
+		if len(raw) == 0 {
+			return nil
+		}
+		return string(raw)
+	},
+}
+
+// sqlResults implémente ResultStore sur PostgreSQL comme sur SQLite.
+type sqlResults struct {
+	db *sql.DB
+	d  dialect
+}
+
+const resultColumns = `r.id, r.user_id, r.category, r.value, r.inputs, r.month, r.created_at, r.updated_at,
+	r.revision, r.factor_set_id, f.version, r.breakdown, r.submitted_value, r.flagged`
+
+const selectResults = `
+	SELECT ` + resultColumns + `
+	FROM results r
+	LEFT JOIN factor_sets f ON f.id = r.factor_set_id
+`
+
+func scanResult(row interface{ Scan(...any) error }) (models.Result, error) {
+	var result models.Result
+	var inputs, breakdown []byte
+	var factorSetID, factorSetVersion sql.NullString
+	err := row.Scan(&result.ID, &result.UserID, &result.Category, &result.Value, &inputs, &result.Month,
+		&result.CreatedAt, &result.UpdatedAt, &result.Revision, &factorSetID, &factorSetVersion, &breakdown,
+		&result.SubmittedValue, &result.Flagged)
+	if errors.Is(err, sql.ErrNoRows) {
+		return result, ErrNotFound
+	}
+	result.Inputs = inputs
+	result.Breakdown = breakdown
+	if factorSetID.Valid {
+		result.FactorSetID = &factorSetID.String
+		result.FactorSetVersion = &factorSetVersion.String
+	}
+	return result, err
+}
+
+const insertResult = `
+	INSERT INTO results (id, user_id, category, value, inputs, month, created_at, updated_at, revision,
+		factor_set_id, breakdown, submitted_value, flagged)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, 1, $9, $10, $11, $12)
+`
+
+// Un nouvel enregistrement du même mois conserve la date de création et
+// incrémente le numéro de révision
+const upsertResult = insertResult + `
+	ON CONFLICT (user_id, category, month)
+	DO UPDATE SET
+		value = EXCLUDED.value,
+		inputs = EXCLUDED.inputs,
+		updated_at = EXCLUDED.updated_at,
+		revision = results.revision + 1,
+		factor_set_id = EXCLUDED.factor_set_id,
+		breakdown = EXCLUDED.breakdown,
+		submitted_value = EXCLUDED.submitted_value,
+		flagged = EXCLUDED.flagged
+	RETURNING id
+`
+
+// Sans ligne renvoyée, le mois avait déjà un résultat
+const insertNewResult = insertResult + `
+	ON CONFLICT (user_id, category, month) DO NOTHING
+	RETURNING id
+`
+
+func (s sqlResults) upsert(tx *sql.Tx, result *models.Result, change Change) error {
+	return s.write(tx, upsertResult, result, change)
+}
+
+// write exécute query, upsertResult ou insertNewResult, puis ajoute la
+// révision.
+func (s sqlResults) write(tx *sql.Tx, query string, result *models.Result, change Change) error {
+	if result.ID == "" {
+		result.ID = uuid.New().String()
+	}
+	now := time.Now().UTC()
+	if result.CreatedAt.IsZero() {
+		result.CreatedAt = now
+	}
+	err := tx.QueryRow(query,
+		result.ID,
+		result.UserID,
+		result.Category,
+		result.Value,
+		s.d.json(result.Inputs),
+		s.d.date(result.Month),
+		result.CreatedAt,
+		now,
+		result.FactorSetID,
+		s.d.json(result.Breakdown),
+		result.SubmittedValue,
+		result.Flagged,
+	).Scan(&result.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	return s.record(tx, result, change, nil)
+}
+
+// record relit le résultat et l'ajoute à son historique.
+func (s sqlResults) record(tx *sql.Tx, result *models.Result, change Change, restoredFrom *int) error {
+	saved, err := scanResult(tx.QueryRow(selectResults+" WHERE r.id = $1", result.ID))
+	if err != nil {
+		return err
+	}
+	*result = saved
+
+	var changedBy *string
+	if change.By != "" {
+		changedBy = &change.By
+	}
+	_, err = tx.Exec(`
+		INSERT INTO result_revisions (id, result_id, user_id, revision, value, inputs, factor_set_id, breakdown,
+			submitted_value, flagged, source, restored_from, changed_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	`, uuid.New().String(), result.ID, result.UserID, result.Revision, result.Value, s.d.json(result.Inputs), result.FactorSetID,
+		s.d.json(result.Breakdown), result.SubmittedValue, result.Flagged, change.Source, restoredFrom, changedBy,
+		result.UpdatedAt)
+	return err
+}
+
+func (s sqlResults) Upsert(result *models.Result, change Change) error {
+	batch := []models.Result{*result}
+	if err := s.UpsertMany(batch, change); err != nil {
+		return err
+	}
+	*result = batch[0]
+	return nil
+}
+
+func (s sqlResults) Insert(result *models.Result, change Change) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.write(tx, insertNewResult, result, change); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s sqlResults) UpsertMany(results []models.Result, change Change) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := range results {
+		if err := s.upsert(tx, &results[i], change); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s sqlResults) Get(userID, id string) (models.Result, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return models.Result{}, ErrNotFound
+	}
+	return scanResult(s.db.QueryRow(selectResults+" WHERE r.id = $1 AND r.user_id = $2", id, userID))
+}
+
+func (s sqlResults) List(userID string) ([]models.Result, error) {
+	return s.Find(userID, ResultQuery{})
+}
+
+func (s sqlResults) Find(userID string, q ResultQuery) ([]models.Result, error) {
+	args := []any{userID}
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	where := []string{"r.user_id = $1"}
+	if q.From != nil {
+		where = append(where, "r.month >= "+arg(s.d.date(*q.From)))
+	}
+	if q.To != nil {
+		where = append(where, "r.month <= "+arg(s.d.date(*q.To)))
+	}
+	if len(q.Categories) > 0 {
+		placeholders := make([]string, len(q.Categories))
+		for i, category := range q.Categories {
+			placeholders[i] = arg(category)
+		}
+		where = append(where, "r.category IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	direction, past := "DESC", "<"
+	if q.Ascending {
+		direction, past = "ASC", ">"
+	}
+	if q.After != nil {
+		month := arg(s.d.date(q.After.Month))
+		where = append(where, fmt.Sprintf("(r.month %s %s OR (r.month = %s AND r.category > %s))",
+			past, month, month, arg(q.After.Category)))
+	}
+
+	query := selectResults + " WHERE " + strings.Join(where, " AND ") +
+		" ORDER BY r.month " + direction + ", r.category"
+	if q.Limit > 0 {
+		query += " LIMIT " + arg(q.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []models.Result{}
+	for rows.Next() {
+		result, err := scanResult(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+func (s sqlResults) History(userID, id string) ([]models.ResultRevision, error) {
+	if _, err := s.Get(userID, id); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT id, result_id, user_id, revision, value, inputs, factor_set_id, breakdown, submitted_value, flagged,
+			source, restored_from, changed_by, created_at
+		FROM result_revisions
+		WHERE result_id = $1
+		ORDER BY revision DESC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []models.ResultRevision{}
+	for rows.Next() {
+		var revision models.ResultRevision
+		var inputs, breakdown []byte
+		err := rows.Scan(&revision.ID, &revision.ResultID, &revision.UserID, &revision.Revision, &revision.Value, &inputs,
+			&revision.FactorSetID, &breakdown, &revision.SubmittedValue, &revision.Flagged, &revision.Source,
+			&revision.RestoredFrom, &revision.ChangedBy, &revision.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		revision.Inputs = inputs
+		revision.Breakdown = breakdown
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+func (s sqlResults) Restore(userID, id string, revision, expected int, by string) (models.Result, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return models.Result{}, err
+	}
+	defer tx.Rollback()
+
+	if err := current(tx, userID, id, expected); err != nil {
+		return models.Result{}, err
+	}
+	err = affected(tx.Exec(`
+		UPDATE results AS r
+		SET value = rv.value,
+			inputs = rv.inputs,
+			factor_set_id = rv.factor_set_id,
+			breakdown = rv.breakdown,
+			submitted_value = rv.submitted_value,
+			flagged = rv.flagged,
+			updated_at = $4,
+			revision = r.revision + 1
+		FROM result_revisions AS rv
+		WHERE r.id = $1 AND r.user_id = $2 AND rv.result_id = r.id AND rv.revision = $3
+			AND ($5 = 0 OR r.revision = $5)
+	`, id, userID, revision, time.Now().UTC(), expected))
+	if errors.Is(err, ErrNotFound) {
+		// Révision inconnue, ou résultat modifié depuis la vérification
+		if err := current(tx, userID, id, expected); err != nil {
+			return models.Result{}, err
+		}
+		return models.Result{}, ErrNotFound
+	}
+	if err != nil {
+		return models.Result{}, err
+	}
+
+	result := models.Result{ID: id}
+	if err := s.record(tx, &result, Change{By: by, Source: SourceRestore}, &revision); err != nil {
+		return models.Result{}, err
+	}
+	return result, tx.Commit()
+}
+
+// current vérifie que le résultat existe et en est à la révision attendue
+// (toute révision si revision vaut 0).
+func current(tx *sql.Tx, userID, id string, revision int) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrNotFound
+	}
+	var got int
+	err := tx.QueryRow(`SELECT revision FROM results WHERE id = $1 AND user_id = $2`, id, userID).Scan(&got)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if revision > 0 && got != revision {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s sqlResults) Update(result *models.Result, revision int, change Change) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := current(tx, result.UserID, result.ID, revision); err != nil {
+		return err
+	}
+	// La condition sur la révision protège aussi d'une écriture concurrente
+	// entre la vérification et la mise à jour
+	err = affected(tx.Exec(`
+		UPDATE results
+		SET value = $1,
+			inputs = $2,
+			factor_set_id = $3,
+			breakdown = $4,
+			submitted_value = $5,
+			flagged = $6,
+			updated_at = $7,
+			revision = revision + 1
+		WHERE id = $8 AND user_id = $9 AND ($10 = 0 OR revision = $10)
+	`, result.Value, s.d.json(result.Inputs), result.FactorSetID, s.d.json(result.Breakdown), result.SubmittedValue,
+		result.Flagged, time.Now().UTC(), result.ID, result.UserID, revision))
+	if errors.Is(err, ErrNotFound) {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.record(tx, result, change, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s sqlResults) Delete(userID, id string, revision int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := current(tx, userID, id, revision); err != nil {
+		return err
+	}
+	if err := s.remove(tx, userID, id, revision); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// remove supprime le résultat en gardant son historique, clos par une
+// révision SourceDelete. La révision est d'abord incrémentée sous la même
+// condition qu'Update, pour qu'une écriture concurrente fasse échouer la
+// suppression.
+func (s sqlResults) remove(tx *sql.Tx, userID, id string, revision int) error {
+	err := affected(tx.Exec(`
+		UPDATE results
+		SET revision = revision + 1, updated_at = $1
+		WHERE id = $2 AND user_id = $3 AND ($4 = 0 OR revision = $4)
+	`, time.Now().UTC(), id, userID, revision))
+	if errors.Is(err, ErrNotFound) {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	result := models.Result{ID: id}
+	if err := s.record(tx, &result, Change{By: userID, Source: SourceDelete}, nil); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM results WHERE id = $1`, id)
+	return err
+}
+
+func (s sqlResults) DeleteMonth(userID string, month time.Time, expected map[string]int) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id, revision FROM results WHERE user_id = $1 AND month = $2`,
+		userID, s.d.date(month))
+	if err != nil {
+		return 0, err
+	}
+	revisions := map[string]int{}
+	for rows.Next() {
+		var id string
+		var revision int
+		if err := rows.Scan(&id, &revision); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		revisions[id] = revision
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if expected != nil && !sameRevisions(revisions, expected) {
+		return 0, ErrConflict
+	}
+
+	// La révision reste vérifiée à la suppression de chaque résultat, contre
+	// une écriture concurrente depuis la lecture
+	for id, revision := range revisions {
+		if expected == nil {
+			revision = 0
+		}
+		if err := s.remove(tx, userID, id, revision); err != nil {
+			return 0, err
+		}
+	}
+	return len(revisions), tx.Commit()
+}
+
+// sameRevisions indique si les résultats lus sont exactement ceux attendus,
+// aux mêmes révisions.
+func sameRevisions(got, expected map[string]int) bool {
+	if len(got) != len(expected) {
+		return false
+	}
+	for id, revision := range got {
+		if want, ok := expected[id]; !ok || want != revision {
+			return false
+		}
+	}
+	return true
+}
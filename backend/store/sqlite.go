@@ -0,0 +1,166 @@
+package store
+
+import (
+	"carbone-app/models"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// NewSQLite renvoie les magasins adossés à une base SQLite dont le schéma a
+// été créé par les migrations (migrations.Up avec le pilote sqlite). Les clés
+// étrangères doivent être activées sur la connexion (_pragma=foreign_keys(1))
+// pour que la suppression d'un utilisateur emporte ses données.
+func NewSQLite(db *sql.DB) Stores {
+	return Stores{
+		Users:      sqliteUsers{db},
+		Results:    sqlResults{db, sqliteDialect},
+		Activities: sqliteActivities{postgresActivities{db}},
+	}
+}
+
+func sqliteUnique(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// sqliteUsers reprend les requêtes PostgreSQL, compatibles, en dehors de la
+// détection des doublons d'email.
+type sqliteUsers struct {
+	db *sql.DB
+}
+
+func (s sqliteUsers) Create(user *models.User) error {
+	if user.ID == "" {
+		user.ID = uuid.New().String()
+	}
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	if user.CreatedAt == nil {
+		now := time.Now().UTC()
+		user.CreatedAt = &now
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO users (id, email, username, password, role, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, user.ID, user.Email, user.Username, user.Password, user.Role, user.CreatedAt)
+	if sqliteUnique(err) {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+func (s sqliteUsers) Get(id string) (models.User, error) {
+	return postgresUsers(s).Get(id)
+}
+
+func (s sqliteUsers) FindByEmail(email string) (models.User, error) {
+	return postgresUsers(s).FindByEmail(email)
+}
+
+func (s sqliteUsers) FindByLogin(identifier string) ([]models.User, error) {
+	return postgresUsers(s).FindByLogin(identifier)
+}
+
+func (s sqliteUsers) UpdateProfile(id, username, email string) error {
+	res, err := s.db.Exec(`
+		UPDATE users
+		SET username = $1, email = $2,
+			email_verified_at = CASE WHEN email = $2 THEN email_verified_at ELSE NULL END
+		WHERE id = $3
+	`, username, email, id)
+	if sqliteUnique(err) {
+		return ErrEmailTaken
+	}
+	return affected(res, err)
+}
+
+func (s sqliteUsers) UpdatePassword(id, hash string) error {
+	return postgresUsers(s).UpdatePassword(id, hash)
+}
+
+func (s sqliteUsers) UpdateRole(id, role string) error {
+	return postgresUsers(s).UpdateRole(id, role)
+}
+
+func (s sqliteUsers) MarkEmailVerified(id string, at time.Time) error {
+	return postgresUsers(s).MarkEmailVerified(id, at)
+}
+
+func (s sqliteUsers) List(query UserQuery) ([]models.User, int, error) {
+	return postgresUsers(s).List(query)
+}
+
+func (s sqliteUsers) Delete(id string) error {
+	return postgresUsers(s).Delete(id)
+}
+
+// sqliteActivities remplace les requêtes qui transtypent ou comparent des
+// dates ; les autres sont celles de PostgreSQL.
+type sqliteActivities struct {
+	postgresActivities
+}
+
+func (s sqliteActivities) List(userID string, from, to *time.Time) ([]models.Activity, error) {
+	rows, err := s.db.Query(`
+		SELECT `+activityColumns+`
+		FROM activities
+		WHERE user_id = $1
+			AND ($2 IS NULL OR date >= $2)
+			AND ($3 IS NULL OR date <= $3)
+		ORDER BY date DESC, id DESC
+	`, userID, NullDate(from), NullDate(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activities := []models.Activity{}
+	for rows.Next() {
+		activity, err := scanActivity(rows)
+		if err != nil {
+			return nil, err
+		}
+		activities = append(activities, activity)
+	}
+	return activities, rows.Err()
+}
+
+func (s sqliteActivities) Create(activity *models.Activity) error {
+	if activity.CreatedAt.IsZero() {
+		activity.CreatedAt = time.Now()
+	}
+	return s.db.QueryRow(`
+		INSERT INTO activities (user_id, activity_id, quantity, date, carbon_amount, factor_set_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, activity.UserID, activity.ActivityID, activity.Quantity, Date(activity.Date), activity.CarbonAmount,
+		activity.FactorSetID, activity.CreatedAt.UTC()).Scan(&activity.ID)
+}
+
+func (s sqliteActivities) Update(activity models.Activity) error {
+	return affected(s.db.Exec(`
+		UPDATE activities
+		SET activity_id = $1, quantity = $2, date = $3, carbon_amount = $4, factor_set_id = $5
+		WHERE id = $6 AND user_id = $7
+	`, activity.ActivityID, activity.Quantity, Date(activity.Date), activity.CarbonAmount, activity.FactorSetID,
+		activity.ID, activity.UserID))
+}
+
+func (s sqliteActivities) Total(userID string, from, to *time.Time) (float64, int, error) {
+	var total float64
+	var count int
+	err := s.db.QueryRow(`
+		SELECT COALESCE(SUM(carbon_amount), 0), COUNT(*)
+		FROM activities
+		WHERE user_id = $1
+			AND ($2 IS NULL OR date >= $2)
+			AND ($3 IS NULL OR date <= $3)
+	`, userID, NullDate(from), NullDate(to)).Scan(&total, &count)
+	return total, count, err
+}
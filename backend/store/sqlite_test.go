@@ -0,0 +1,98 @@
+package store_test
+
+import (
+	"carbone-app/config"
+	"carbone-app/migrations"
+	"carbone-app/models"
+	"carbone-app/store"
+	"carbone-app/store/storetest"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openSQLite ouvre et migre la base SQLite désignée par dsn.
+func openSQLite(t *testing.T, dsn string) *sql.DB {
+	t.Helper()
+	cfg := config.Default().Database
+	cfg.Driver = config.DriverSQLite
+	cfg.DSN = dsn
+	db, err := config.InitDB(cfg)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := migrations.Up(db, config.DriverSQLite); err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+	return db
+}
+
+// TestSQLite exécute le contrat sur la base désignée par
+// STORE_TEST_SQLITE_DSN, à défaut sur un fichier temporaire.
+func TestSQLite(t *testing.T) {
+	dsn := os.Getenv("STORE_TEST_SQLITE_DSN")
+	if dsn == "" {
+		dsn = filepath.Join(t.TempDir(), "store.db")
+	}
+
+	stores := store.NewSQLite(openSQLite(t, dsn))
+	storetest.Run(t, func(t *testing.T) store.Stores { return stores })
+}
+
+// TestSQLiteDeleteKeepsHistory vérifie en base que la suppression d'un
+// résultat conserve son historique jusqu'à la suppression du compte.
+func TestSQLiteDeleteKeepsHistory(t *testing.T) {
+	db := openSQLite(t, filepath.Join(t.TempDir(), "history.db"))
+	s := store.NewSQLite(db)
+
+	user := models.User{Email: "alice@example.com", Username: "alice", Password: "hash", Role: models.RoleUser}
+	if err := s.Users.Create(&user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	change := store.Change{By: user.ID, Source: store.SourceSave}
+	september := models.Result{UserID: user.ID, Category: "Transports", Value: 5,
+		Month: time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC)}
+	october := models.Result{UserID: user.ID, Category: "Logement", Value: 7,
+		Month: time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC)}
+	if err := s.Results.UpsertMany([]models.Result{september, october}, change); err != nil {
+		t.Fatalf("UpsertMany: %v", err)
+	}
+	saved, err := s.Results.List(user.ID)
+	if err != nil || len(saved) != 2 {
+		t.Fatalf("List = %d résultat(s), %v", len(saved), err)
+	}
+
+	if err := s.Results.Delete(user.ID, saved[0].ID, saved[0].Revision); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if n, err := s.Results.DeleteMonth(user.ID, september.Month, nil); err != nil || n != 1 {
+		t.Fatalf("DeleteMonth = %d, %v", n, err)
+	}
+
+	count := func(where string) int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM result_revisions WHERE user_id = $1 AND `+where,
+			user.ID).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := count("result_id IS NULL"); n != 4 {
+		t.Errorf("%d révision(s) conservée(s), attendu 4", n)
+	}
+	if n := count("source = 'delete' AND revision = 2 AND changed_by = $1"); n != 2 {
+		t.Errorf("%d révision(s) de suppression, attendu 2", n)
+	}
+
+	if err := s.Users.Delete(user.ID); err != nil {
+		t.Fatalf("Users.Delete: %v", err)
+	}
+	if n := count("TRUE"); n != 0 {
+		t.Errorf("%d révision(s) après suppression du compte, attendu 0", n)
+	}
+}
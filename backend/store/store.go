@@ -0,0 +1,203 @@
+// Package store isole l'accès aux comptes, aux résultats et aux activités
+// derrière des interfaces. Les handlers les reçoivent à la construction, ce
+// qui permet de les exécuter sur PostgreSQL, sur SQLite ou sur le stockage en
+// mémoire ; le paquet storetest vérifie que toutes les implémentations se
+// comportent de la même façon.
+//
+// Les sous-systèmes qui possèdent leurs propres tables ou colonnes (sessions,
+// double authentification, groupes, jeux de facteurs, suppression et export
+// des données…) n'en font pas partie : ils reçoivent la connexion *sql.DB,
+// elle aussi passée explicitement aux handlers.
+package store
+
+import (
+	"carbone-app/models"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("enregistrement introuvable")
+	ErrEmailTaken = errors.New("adresse email déjà utilisée")
+	// ErrConflict signale qu'un résultat a changé depuis la révision attendue
+	ErrConflict = errors.New("révision obsolète")
+)
+
+type UserStore interface {
+	// Create enregistre un nouvel utilisateur ; Password contient le hash.
+	// ID et CreatedAt sont renseignés s'ils sont vides.
+	Create(user *models.User) error
+	Get(id string) (models.User, error)
+	// FindByEmail renvoie le compte dont l'email vaut email sans tenir
+	// compte de la casse, en préférant l'égalité exacte puis le plus ancien.
+	FindByEmail(email string) (models.User, error)
+	// FindByLogin renvoie les comptes dont l'email (sans tenir compte de la
+	// casse) ou le pseudonyme vaut identifier, ceux dont l'email correspond
+	// en premier, puis du plus ancien au plus récent.
+	FindByLogin(identifier string) ([]models.User, error)
+	// UpdateProfile change le pseudonyme et l'email ; une nouvelle adresse
+	// perd sa vérification.
+	UpdateProfile(id, username, email string) error
+	UpdatePassword(id, hash string) error
+	UpdateRole(id, role string) error
+	// MarkEmailVerified confirme l'adresse à la date at, si elle ne l'était
+	// pas déjà.
+	MarkEmailVerified(id string, at time.Time) error
+	// List renvoie une page d'utilisateurs, du plus récent au plus ancien, et
+	// le nombre total d'utilisateurs correspondant à la requête.
+	List(query UserQuery) ([]models.User, int, error)
+	// Delete supprime l'utilisateur avec ses résultats et ses activités.
+	Delete(id string) error
+}
+
+// UserQuery filtre et pagine la liste des utilisateurs.
+type UserQuery struct {
+	// Search cherche ce texte, tel quel et sans tenir compte de la casse,
+	// dans l'email ou le pseudonyme ; vide pour tous
+	Search string
+	// Role restreint à un rôle ; vide pour tous
+	Role string
+	// Limit borne le nombre d'utilisateurs ; 0 pour tous
+	Limit  int
+	Offset int
+}
+
+// Origine d'une révision de résultat
+const (
+	SourceSave    = "save"
+	SourceImport  = "import"
+	SourceRestore = "restore"
+	SourceDelete  = "delete"
+)
+
+// Change indique qui modifie un résultat et par quel moyen.
+type Change struct {
+	By     string
+	Source string
+}
+
+// ResultCursor repère un résultat dans l'ordre (mois, catégorie).
+type ResultCursor struct {
+	Month    time.Time
+	Category string
+}
+
+// ResultQuery filtre, trie et pagine les résultats d'un utilisateur.
+type ResultQuery struct {
+	// From et To bornent les mois, inclus ; nil pour ne pas borner
+	From, To *time.Time
+	// Categories restreint aux catégories données ; vide pour toutes
+	Categories []string
+	// Ascending trie du mois le plus ancien au plus récent ; les catégories
+	// sont toujours dans l'ordre alphabétique au sein d'un mois
+	Ascending bool
+	// After reprend la lecture juste après ce résultat
+	After *ResultCursor
+	// Limit borne le nombre de résultats ; 0 pour tous
+	Limit int
+}
+
+type ResultStore interface {
+	// Upsert enregistre le résultat ou remplace celui du même utilisateur,
+	// de la même catégorie et du même mois, dont il reprend l'ID et la date
+	// de création. Chaque appel ajoute une révision.
+	Upsert(result *models.Result, change Change) error
+	// Insert enregistre un nouveau résultat ; si l'utilisateur en a déjà un
+	// pour la catégorie et le mois, rien n'est modifié et Insert renvoie
+	// ErrConflict.
+	Insert(result *models.Result, change Change) error
+	// UpsertMany applique Upsert à tous les résultats, ou à aucun.
+	UpsertMany(results []models.Result, change Change) error
+	Get(userID, id string) (models.Result, error)
+	// List renvoie les résultats de l'utilisateur, du mois le plus récent au
+	// plus ancien puis par catégorie.
+	List(userID string) ([]models.Result, error)
+	// Find renvoie les résultats de l'utilisateur qui répondent à la requête.
+	Find(userID string, q ResultQuery) ([]models.Result, error)
+	// History renvoie les révisions d'un résultat de l'utilisateur, de la
+	// plus récente à la plus ancienne.
+	History(userID, id string) ([]models.ResultRevision, error)
+	// Restore rétablit l'état d'une révision antérieure ; la restauration
+	// est elle-même enregistrée comme une nouvelle révision. Si expected est
+	// positif et n'est plus la révision courante, rien n'est modifié et
+	// Restore renvoie ErrConflict.
+	Restore(userID, id string, revision, expected int, by string) (models.Result, error)
+	// Update remplace les valeurs du résultat result.ID de result.UserID ;
+	// la catégorie, le mois et la date de création ne changent pas. Si
+	// revision est positif et n'est plus la révision courante, rien n'est
+	// modifié et Update renvoie ErrConflict.
+	Update(result *models.Result, revision int, change Change) error
+	// Delete supprime le résultat, avec la même vérification de révision
+	// qu'Update. Son historique est conservé, complété d'une révision
+	// SourceDelete, mais n'est plus accessible par History.
+	Delete(userID, id string, revision int) error
+	// DeleteMonth supprime les résultats du mois, toutes catégories
+	// confondues, comme Delete, et renvoie leur nombre. expected associe à
+	// l'ID de chaque résultat du mois sa révision attendue : si un résultat a
+	// été ajouté, modifié ou supprimé depuis, rien n'est supprimé et
+	// DeleteMonth renvoie ErrConflict. Avec expected nil, le mois est
+	// supprimé sans vérification.
+	DeleteMonth(userID string, month time.Time, expected map[string]int) (int, error)
+}
+
+type ActivityStore interface {
+	// Factors renvoie le catalogue des facteurs par catégorie et par nom.
+	Factors() ([]models.CarbonFactor, error)
+	// Factor renvoie l'entrée du catalogue d'une activité.
+	Factor(activityID string) (models.CarbonFactor, error)
+	// List renvoie les activités de l'utilisateur entre from et to inclus
+	// (bornes facultatives), des plus récentes aux plus anciennes.
+	List(userID string, from, to *time.Time) ([]models.Activity, error)
+	Get(userID string, id uint) (models.Activity, error)
+	// Create enregistre l'activité et renseigne son ID.
+	Create(activity *models.Activity) error
+	Update(activity models.Activity) error
+	Delete(userID string, id uint) error
+	// Total somme les émissions et compte les activités de la période.
+	Total(userID string, from, to *time.Time) (float64, int, error)
+}
+
+// Date formate un jour pour une colonne DATE, en AAAA-MM-JJ : PostgreSQL le
+// convertit, SQLite stocke les dates sous cette forme et les compare comme du
+// texte. Les paquets qui écrivent leurs propres requêtes l'utilisent aussi.
+func Date(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// NullDate est Date pour une date facultative, NULL si elle est absente.
+func NullDate(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return Date(*t)
+}
+
+// Stores regroupe les magasins injectés dans les handlers.
+type Stores struct {
+	Users      UserStore
+	Results    ResultStore
+	Activities ActivityStore
+}
+
+// Catalogue initial des activités, repris des migrations 0005_activities et
+// 0017_activity_factor_sets pour le stockage en mémoire
+var defaultFactors = []models.CarbonFactor{
+	{ID: "train", Name: "Train", Category: "Transports", Factor: "Transports.train", Unit: "km"},
+	{ID: "flight", Name: "Avion", Category: "Transports", Factor: "Transports.flight", Unit: "km"},
+	{ID: "car_small", Name: "Petite voiture", Category: "Transports", Factor: "Transports.car.small", Unit: "km"},
+	{ID: "car_medium", Name: "Voiture moyenne", Category: "Transports", Factor: "Transports.car.medium", Unit: "km"},
+	{ID: "car_big", Name: "Grande voiture", Category: "Transports", Factor: "Transports.car.big", Unit: "km"},
+	{ID: "red_meat", Name: "Viande rouge", Category: "Alimentation", Factor: "Alimentation.redMeat", Unit: "kg"},
+	{ID: "white_meat", Name: "Viande blanche", Category: "Alimentation", Factor: "Alimentation.whiteMeat", Unit: "kg"},
+	{ID: "pork", Name: "Porc", Category: "Alimentation", Factor: "Alimentation.pork", Unit: "kg"},
+	{ID: "clothing_large", Name: "Vêtement (grande pièce)", Category: "Vetements", Factor: "Vetements.large", Unit: "article"},
+	{ID: "clothing_small", Name: "Vêtement (petite pièce)", Category: "Vetements", Factor: "Vetements.small", Unit: "article"},
+	{ID: "smartphone_small", Name: "Smartphone (petit modèle)", Category: "Numerique", Factor: "Numerique.smartphone.small", Unit: "appareil"},
+	{ID: "smartphone_large", Name: "Smartphone (grand modèle)", Category: "Numerique", Factor: "Numerique.smartphone.large", Unit: "appareil"},
+	{ID: "amazon_order", Name: "Commande Amazon", Category: "Consommation", Factor: "Consommation.ecommerce.amazon", Unit: "commande"},
+	{ID: "leboncoin_order", Name: "Commande Leboncoin", Category: "Consommation", Factor: "Consommation.ecommerce.leboncoin", Unit: "commande"},
+	{ID: "artisanat_order", Name: "Commande artisanat", Category: "Consommation", Factor: "Consommation.ecommerce.artisanat", Unit: "commande"},
+	{ID: "brocante_item", Name: "Achat en brocante", Category: "Consommation", Factor: "Consommation.commerce.brocante", Unit: "article"},
+	{ID: "local_shop_order", Name: "Achat en commerce local", Category: "Consommation", Factor: "Consommation.commerce.localShops", Unit: "achat"},
+	{ID: "ski_day", Name: "Journée de ski", Category: "Sport_loisirs", Factor: "SportLoisirs.ski", Unit: "jour"},
+}
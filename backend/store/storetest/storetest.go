@@ -0,0 +1,992 @@
+// Package storetest décrit le contrat commun aux implémentations du paquet
+// store. Les tests de chaque implémentation exécutent les mêmes cas avec Run.
+//
+// Chaque cas crée ses propres utilisateurs, avec des adresses uniques, et
+// les supprime à la fin : le contrat peut tourner sur une base déjà peuplée,
+// mais de préférence une base de test.
+package storetest
+
+import (
+	"bytes"
+	"carbone-app/calculator"
+	"carbone-app/models"
+	"carbone-app/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Case struct {
+	Name string
+	Run  func(t *testing.T, s store.Stores)
+}
+
+// Run exécute chaque cas dans un sous-test, avec les magasins fournis par
+// newStores.
+func Run(t *testing.T, newStores func(t *testing.T) store.Stores) {
+	for _, tc := range Cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			tc.Run(t, newStores(t))
+		})
+	}
+}
+
+var Cases = []Case{
+	{"users/create-get", userCreateGet},
+	{"users/unknown", userUnknown},
+	{"users/email-taken", userEmailTaken},
+	{"users/find-by-login", userFindByLogin},
+	{"users/update-profile", userUpdateProfile},
+	{"users/update-password", userUpdatePassword},
+	{"users/find-by-email", userFindByEmail},
+	{"users/update-role", userUpdateRole},
+	{"users/mark-email-verified", userMarkEmailVerified},
+	{"users/list", userList},
+	{"users/delete-cascade", userDeleteCascade},
+	{"results/upsert-replaces", resultUpsertReplaces},
+	{"results/list-order", resultListOrder},
+	{"results/round-trip", resultRoundTrip},
+	{"results/upsert-many", resultUpsertMany},
+	{"results/insert", resultInsert},
+	{"results/get", resultGet},
+	{"results/history", resultHistory},
+	{"results/restore", resultRestore},
+	{"results/update", resultUpdate},
+	{"results/delete", resultDelete},
+	{"results/delete-month", resultDeleteMonth},
+	{"results/find", resultFind},
+	{"activities/factors", activityFactors},
+	{"activities/crud", activityCRUD},
+	{"activities/range-total", activityRangeTotal},
+}
+
+// newUser crée un utilisateur unique, supprimé à la fin du cas.
+func newUser(t *testing.T, s store.Stores) models.User {
+	t.Helper()
+	suffix := uuid.New().String()[:8]
+	user := models.User{
+		Email:    "contrat-" + suffix + "@example.com",
+		Username: "contrat-" + suffix,
+		Password: "hash-" + suffix,
+	}
+	if err := s.Users.Create(&user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	t.Cleanup(func() { s.Users.Delete(user.ID) })
+	return user
+}
+
+func save(userID string) store.Change {
+	return store.Change{By: userID, Source: store.SourceSave}
+}
+
+func month(year int, m time.Month) time.Time {
+	return time.Date(year, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func date(year int, m time.Month, d int) time.Time {
+	return time.Date(year, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Format("2006-01-02") == b.Format("2006-01-02")
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// sameJSON compare deux documents JSON indépendamment de leur mise en forme.
+func sameJSON(a, b []byte) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return bytes.Equal(ja, jb)
+}
+
+func userCreateGet(t *testing.T, s store.Stores) {
+	user := newUser(t, s)
+	if user.ID == "" || user.CreatedAt == nil {
+		t.Fatalf("Create doit renseigner ID et CreatedAt: %+v", user)
+	}
+
+	got, err := s.Users.Get(user.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Email != user.Email || got.Username != user.Username || got.Password != user.Password {
+		t.Errorf("Get = %+v, attendu %+v", got, user)
+	}
+	if got.Role != models.RoleUser {
+		t.Errorf("rôle = %q, attendu %q", got.Role, models.RoleUser)
+	}
+	if got.CreatedAt == nil {
+		t.Errorf("CreatedAt absent")
+	}
+	if got.EmailVerifiedAt != nil {
+		t.Errorf("un nouvel email ne doit pas être vérifié")
+	}
+}
+
+func userUnknown(t *testing.T, s store.Stores) {
+	if _, err := s.Users.Get(uuid.New().String()); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get inconnu: %v, attendu ErrNotFound", err)
+	}
+	if _, err := s.Users.Get("pas-un-uuid"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get identifiant invalide: %v, attendu ErrNotFound", err)
+	}
+	if err := s.Users.UpdatePassword(uuid.New().String(), "x"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("UpdatePassword inconnu: %v, attendu ErrNotFound", err)
+	}
+	if err := s.Users.UpdateProfile(uuid.New().String(), "x", "x@example.com"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("UpdateProfile inconnu: %v, attendu ErrNotFound", err)
+	}
+	if err := s.Users.Delete(uuid.New().String()); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Delete inconnu: %v, attendu ErrNotFound", err)
+	}
+}
+
+func userEmailTaken(t *testing.T, s store.Stores) {
+	user := newUser(t, s)
+	duplicate := models.User{Email: user.Email, Username: "autre", Password: "hash"}
+	if err := s.Users.Create(&duplicate); !errors.Is(err, store.ErrEmailTaken) {
+		if err == nil {
+			s.Users.Delete(duplicate.ID)
+		}
+		t.Errorf("Create avec un email existant: %v, attendu ErrEmailTaken", err)
+	}
+}
+
+func userFindByLogin(t *testing.T, s store.Stores) {
+	owner := newUser(t, s)
+	// Un autre compte dont le pseudonyme est l'email du premier
+	namesake := newUser(t, s)
+	if err := s.Users.UpdateProfile(namesake.ID, owner.Email, namesake.Email); err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+
+	users, err := s.Users.FindByLogin(owner.Email)
+	if err != nil {
+		t.Fatalf("FindByLogin: %v", err)
+	}
+	if len(users) != 2 || users[0].ID != owner.ID || users[1].ID != namesake.ID {
+		t.Errorf("FindByLogin(email) = %v, attendu le compte de l'email puis l'homonyme", ids(users))
+	}
+
+	upper := []byte(owner.Email)
+	copy(upper, bytes.ToUpper(upper[:1]))
+	users, err = s.Users.FindByLogin(string(upper))
+	if err != nil || len(users) != 1 || users[0].ID != owner.ID {
+		t.Errorf("FindByLogin ignore la casse de l'email: %v, %v", ids(users), err)
+	}
+
+	users, err = s.Users.FindByLogin(owner.Username)
+	if err != nil || len(users) != 1 || users[0].ID != owner.ID {
+		t.Errorf("FindByLogin(pseudonyme) = %v, %v", ids(users), err)
+	}
+
+	users, err = s.Users.FindByLogin("personne-" + uuid.New().String())
+	if err != nil || len(users) != 0 {
+		t.Errorf("FindByLogin inconnu = %v, %v", ids(users), err)
+	}
+}
+
+func ids(users []models.User) []string {
+	var ids []string
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+	return ids
+}
+
+func userUpdateProfile(t *testing.T, s store.Stores) {
+	user := newUser(t, s)
+	other := newUser(t, s)
+
+	email := "nouveau-" + user.Email
+	if err := s.Users.UpdateProfile(user.ID, "renommé", email); err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+	got, err := s.Users.Get(user.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Username != "renommé" || got.Email != email {
+		t.Errorf("profil = %q <%s>, attendu renommé <%s>", got.Username, got.Email, email)
+	}
+
+	if err := s.Users.UpdateProfile(user.ID, "renommé", other.Email); !errors.Is(err, store.ErrEmailTaken) {
+		t.Errorf("UpdateProfile vers un email pris: %v, attendu ErrEmailTaken", err)
+	}
+}
+
+func userUpdatePassword(t *testing.T, s store.Stores) {
+	user := newUser(t, s)
+	if err := s.Users.UpdatePassword(user.ID, "nouveau-hash"); err != nil {
+		t.Fatalf("UpdatePassword: %v", err)
+	}
+	got, err := s.Users.Get(user.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Password != "nouveau-hash" {
+		t.Errorf("Password = %q, attendu nouveau-hash", got.Password)
+	}
+}
+
+func userFindByEmail(t *testing.T, s store.Stores) {
+	user := newUser(t, s)
+
+	got, err := s.Users.FindByEmail(strings.ToUpper(user.Email))
+	if err != nil || got.ID != user.ID || got.Password != user.Password {
+		t.Errorf("FindByEmail ignore la casse: %+v, %v", got, err)
+	}
+	// Un pseudonyme égal à l'email ne compte pas
+	if _, err := s.Users.FindByEmail(user.Username); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("FindByEmail(pseudonyme): %v, attendu ErrNotFound", err)
+	}
+	if _, err := s.Users.FindByEmail("personne-" + uuid.New().String() + "@example.com"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("FindByEmail inconnu: %v, attendu ErrNotFound", err)
+	}
+}
+
+func userUpdateRole(t *testing.T, s store.Stores) {
+	user := newUser(t, s)
+	if err := s.Users.UpdateRole(user.ID, models.RoleFacilitator); err != nil {
+		t.Fatalf("UpdateRole: %v", err)
+	}
+	got, err := s.Users.Get(user.ID)
+	if err != nil || got.Role != models.RoleFacilitator {
+		t.Errorf("rôle après UpdateRole = %q, %v", got.Role, err)
+	}
+	if err := s.Users.UpdateRole(uuid.New().String(), models.RoleAdmin); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("UpdateRole inconnu: %v, attendu ErrNotFound", err)
+	}
+}
+
+func userMarkEmailVerified(t *testing.T, s store.Stores) {
+	user := newUser(t, s)
+	first := time.Date(2024, time.March, 1, 10, 0, 0, 0, time.UTC)
+	if err := s.Users.MarkEmailVerified(user.ID, first); err != nil {
+		t.Fatalf("MarkEmailVerified: %v", err)
+	}
+	// Une seconde confirmation garde la date de la première
+	if err := s.Users.MarkEmailVerified(user.ID, first.Add(time.Hour)); err != nil {
+		t.Fatalf("MarkEmailVerified: %v", err)
+	}
+	got, err := s.Users.Get(user.ID)
+	if err != nil || got.EmailVerifiedAt == nil || !got.EmailVerifiedAt.Equal(first) {
+		t.Errorf("EmailVerifiedAt = %v, %v, attendu %v", got.EmailVerifiedAt, err, first)
+	}
+	if err := s.Users.MarkEmailVerified(uuid.New().String(), first); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("MarkEmailVerified inconnu: %v, attendu ErrNotFound", err)
+	}
+}
+
+func userList(t *testing.T, s store.Stores) {
+	// Un marqueur commun isole les comptes du cas dans une base peuplée ; le
+	// joker « _ » doit être cherché tel quel
+	marker := "liste_" + uuid.New().String()[:8]
+	var created []models.User
+	for i, role := range []string{models.RoleUser, models.RoleAdmin, models.RoleUser} {
+		createdAt := time.Date(2024, time.January, 1+i, 0, 0, 0, 0, time.UTC)
+		user := models.User{
+			Email:     fmt.Sprintf("%s-%d@example.com", marker, i),
+			Username:  fmt.Sprintf("compte-%d", i),
+			Password:  "hash",
+			Role:      role,
+			CreatedAt: &createdAt,
+		}
+		if err := s.Users.Create(&user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		t.Cleanup(func() { s.Users.Delete(user.ID) })
+		created = append(created, user)
+	}
+
+	users, total, err := s.Users.List(store.UserQuery{Search: strings.ToUpper(marker)})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if total != 3 || len(users) != 3 || users[0].ID != created[2].ID || users[2].ID != created[0].ID {
+		t.Errorf("List = %v (total %d), attendu les 3 comptes du plus récent au plus ancien", ids(users), total)
+	}
+
+	users, total, err = s.Users.List(store.UserQuery{Search: marker, Limit: 1, Offset: 1})
+	if err != nil || total != 3 || len(users) != 1 || users[0].ID != created[1].ID {
+		t.Errorf("List paginée = %v (total %d), %v", ids(users), total, err)
+	}
+
+	users, total, err = s.Users.List(store.UserQuery{Search: marker, Role: models.RoleAdmin})
+	if err != nil || total != 1 || len(users) != 1 || users[0].ID != created[1].ID {
+		t.Errorf("List par rôle = %v (total %d), %v", ids(users), total, err)
+	}
+
+	users, total, err = s.Users.List(store.UserQuery{Search: strings.Replace(marker, "_", "%", 1)})
+	if err != nil || total != 0 || len(users) != 0 {
+		t.Errorf("List avec joker = %v (total %d), %v, attendu aucun compte", ids(users), total, err)
+	}
+}
+
+func userDeleteCascade(t *testing.T, s store.Stores) {
+	user := newUser(t, s)
+	result := models.Result{UserID: user.ID, Category: "Transports", Value: 1, Month: month(2024, time.January)}
+	if err := s.Results.Upsert(&result, save(result.UserID)); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	activity := models.Activity{UserID: user.ID, ActivityID: "train", Quantity: 10, Date: date(2024, time.January, 5), CarbonAmount: 0.14}
+	if err := s.Activities.Create(&activity); err != nil {
+		t.Fatalf("Create activité: %v", err)
+	}
+
+	if err := s.Users.Delete(user.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Users.Get(user.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get après Delete: %v, attendu ErrNotFound", err)
+	}
+	if results, err := s.Results.List(user.ID); err != nil || len(results) != 0 {
+		t.Errorf("résultats après Delete: %d, %v", len(results), err)
+	}
+	if activities, err := s.Activities.List(user.ID, nil, nil); err != nil || len(activities) != 0 {
+		t.Errorf("activités après Delete: %d, %v", len(activities), err)
+	}
+}
+
+func resultUpsertReplaces(t *testing.T, s store.Stores) {
+	user := newUser(t, s)
+	first := models.Result{UserID: user.ID, Category: "Transports", Value: 10, Month: month(2024, time.March)}
+	if err := s.Results.Upsert(&first, save(first.UserID)); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if first.ID == "" {
+		t.Fatalf("Upsert doit renseigner l'ID")
+	}
+
+	second := models.Result{UserID: user.ID, Category: "Transports", Value: 20, Month: month(2024, time.March)}
+	if err := s.Results.Upsert(&second, save(second.UserID)); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if second.ID != first.ID {
+		t.Errorf("Upsert du même mois: ID %s, attendu %s", second.ID, first.ID)
+	}
+	if second.Revision != first.Revision+1 {
+		t.Errorf("révision = %d, attendu %d", second.Revision, first.Revision+1)
+	}
+	if !second.CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("created_at = %s, attendu %s conservé", second.CreatedAt, first.CreatedAt)
+	}
+	if second.UpdatedAt.Before(first.UpdatedAt) {
+		t.Errorf("updated_at = %s, antérieur à %s", second.UpdatedAt, first.UpdatedAt)
+	}
+
+	results, err := s.Results.List(user.ID)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(results) != 1 || !near(results[0].Value, 20) {
+		t.Errorf("List = %+v, attendu un seul résultat de valeur 20", results)
+	}
+}
+
+func resultListOrder(t *testing.T, s store.Stores) {
+	user := newUser(t, s)
+	other := newUser(t, s)
+	for _, r := range []models.Result{
+		{UserID: user.ID, Category: "Transports", Value: 1, Month: month(2024, time.January)},
+		{UserID: user.ID, Category: "Transports", Value: 2, Month: month(2024, time.March)},
+		{UserID: user.ID, Category: "Alimentation", Value: 3, Month: month(2024, time.March)},
+		{UserID: other.ID, Category: "Transports", Value: 4, Month: month(2024, time.February)},
+	} {
+		if err := s.Results.Upsert(&r, save(r.UserID)); err != nil {
+			t.Fatalf("Upsert: %v", err)
+		}
+	}
+
+	results, err := s.Results.List(user.ID)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var got []string
+	for _, r := range results {
+		got = append(got, r.Month.Format("2006-01")+" "+r.Category)
+	}
+	want := []string{"2024-03 Alimentation", "2024-03 Transports", "2024-01 Transports"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("List = %v, attendu %v", got, want)
+	}
+}
+
+func resultRoundTrip(t *testing.T, s store.Stores) {
+	user := newUser(t, s)
+	submitted := 12.5
+	result := models.Result{
+		UserID:         user.ID,
+		Category:       "Transports",
+		Value:          12.25,
+		Inputs:         json.RawMessage(`{"train": 120, "car": "small"}`),
+		Month:          month(2024, time.June),
+		Breakdown:      json.RawMessage(`[{"key": "train", "value": 1.68}]`),
+		SubmittedValue: &submitted,
+		Flagged:        true,
+	}
+	if err := s.Results.Upsert(&result, save(result.UserID)); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	results, err := s.Results.List(user.ID)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("List = %d résultat(s), %v", len(results), err)
+	}
+	got := results[0]
+	if got.ID != result.ID || got.UserID != user.ID || got.Category != "Transports" || !near(got.Value, 12.25) {
+		t.Errorf("résultat = %+v, attendu %+v", got, result)
+	}
+	if !sameDay(got.Month, result.Month) {
+		t.Errorf("mois = %s, attendu %s", got.Month, result.Month)
+	}
+	if !sameJSON(got.Inputs, result.Inputs) {
+		t.Errorf("inputs = %s, attendu %s", got.Inputs, result.Inputs)
+	}
+	if !sameJSON(got.Breakdown, result.Breakdown) {
+		t.Errorf("breakdown = %s, attendu %s", got.Breakdown, result.Breakdown)
+	}
+	if got.SubmittedValue == nil || !near(*got.SubmittedValue, submitted) || !got.Flagged {
+		t.Errorf("vérification = %v / %v, attendu %v / true", got.SubmittedValue, got.Flagged, submitted)
+	}
+	if got.FactorSetID != nil {
+		t.Errorf("jeu de facteurs = %v, attendu aucun", *got.FactorSetID)
+	}
+}
+
+func resultUpsertMany(t *testing.T, s store.Stores) {
+	user := newUser(t, s)
+	existing := models.Result{UserID: user.ID, Category: "Transports", Value: 1, Month: month(2023, time.December)}
+	if err := s.Results.Upsert(&existing, save(existing.UserID)); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	batch := []models.Result{
+		{UserID: user.ID, Category: "Transports", Value: 5, Month: month(2023, time.December)},
+		{UserID: user.ID, Category: "Alimentation", Value: 6, Month: month(2023, time.December)},
+	}
+	if err := s.Results.UpsertMany(batch, save(user.ID)); err != nil {
+		t.Fatalf("UpsertMany: %v", err)
+	}
+	if batch[0].ID != existing.ID || batch[1].ID == "" {
+		t.Errorf("UpsertMany doit renseigner les ID et reprendre ceux existants")
+	}
+
+	results, err := s.Results.List(user.ID)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(results) != 2 || !near(results[0].Value, 6) || !near(results[1].Value, 5) {
+		t.Errorf("List = %+v, attendu Alimentation 6 et Transports 5", results)
+	}
+}
+
+func resultInsert(t *testing.T, s store.Stores) {
+	user := newUser(t, s)
+	first := models.Result{UserID: user.ID, Category: "Transports", Value: 3, Month: month(2023, time.November)}
+	if err := s.Results.Insert(&first, save(user.ID)); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	if first.ID == "" || first.Revision != 1 {
+		t.Errorf("Insert = ID %q, révision %d, attendu un ID et la révision 1", first.ID, first.Revision)
+	}
+
+	// Le même mois et la même catégorie ne sont pas remplacés
+	again := models.Result{UserID: user.ID, Category: "Transports", Value: 9, Month: month(2023, time.November)}
+	if err := s.Results.Insert(&again, save(user.ID)); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("second Insert: %v, attendu ErrConflict", err)
+	}
+	got, err := s.Results.Get(user.ID, first.ID)
+	if err != nil || !near(got.Value, 3) || got.Revision != 1 {
+		t.Errorf("Get après un Insert refusé = %+v, %v", got, err)
+	}
+
+	other := models.Result{UserID: user.ID, Category: "Alimentation", Value: 4, Month: month(2023, time.November)}
+	if err := s.Results.Insert(&other, save(user.ID)); err != nil {
+		t.Errorf("Insert d'une autre catégorie: %v", err)
+	}
+	if revisions, err := s.Results.History(user.ID, first.ID); err != nil || len(revisions) != 1 {
+		t.Errorf("History = %d révision(s), %v, attendu 1", len(revisions), err)
+	}
+}
+
+func activityFactors(t *testing.T, s store.Stores) {
+	factors, err := s.Activities.Factors()
+	if err != nil || len(factors) == 0 {
+		t.Fatalf("Factors = %d facteur(s), %v", len(factors), err)
+	}
+	for i := 1; i < len(factors); i++ {
+		a, b := factors[i-1], factors[i]
+		if a.Category > b.Category || (a.Category == b.Category && a.Name > b.Name) {
+			t.Errorf("Factors non triés: %s/%s avant %s/%s", a.Category, a.Name, b.Category, b.Name)
+		}
+	}
+
+	// Chaque activité désigne un facteur des jeux versionnés
+	required, _ := calculator.FactorKeys()
+	for _, factor := range factors {
+		if !required[factor.Factor] {
+			t.Errorf("%s: facteur %q inconnu du calculateur", factor.ID, factor.Factor)
+		}
+	}
+
+	factor, err := s.Activities.Factor("train")
+	if err != nil || factor.ID != "train" || factor.Factor != "Transports.train" || factor.Unit != "km" {
+		t.Errorf("Factor(train) = %+v, %v", factor, err)
+	}
+	if _, err := s.Activities.Factor("inconnue"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Factor inconnu: %v, attendu ErrNotFound", err)
+	}
+}
+
+func activityCRUD(t *testing.T, s store.Stores) {
+	user := newUser(t, s)
+	other := newUser(t, s)
+
+	activity := models.Activity{UserID: user.ID, ActivityID: "train", Quantity: 100, Date: date(2024, time.May, 14), CarbonAmount: 1.4}
+	if err := s.Activities.Create(&activity); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if activity.ID == 0 {
+		t.Fatalf("Create doit renseigner l'ID")
+	}
+
+	got, err := s.Activities.Get(user.ID, activity.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.ActivityID != "train" || !near(got.Quantity, 100) || !near(got.CarbonAmount, 1.4) || !sameDay(got.Date, activity.Date) {
+		t.Errorf("Get = %+v, attendu %+v", got, activity)
+	}
+	if _, err := s.Activities.Get(other.ID, activity.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get par un autre utilisateur: %v, attendu ErrNotFound", err)
+	}
+
+	activity.ActivityID = "flight"
+	activity.Quantity = 10
+	activity.CarbonAmount = 2.85
+	activity.Date = date(2024, time.May, 15)
+	if err := s.Activities.Update(activity); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	got, err = s.Activities.Get(user.ID, activity.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.ActivityID != "flight" || !near(got.CarbonAmount, 2.85) || !sameDay(got.Date, activity.Date) {
+		t.Errorf("après Update = %+v, attendu %+v", got, activity)
+	}
+
+	stolen := activity
+	stolen.UserID = other.ID
+	if err := s.Activities.Update(stolen); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Update par un autre utilisateur: %v, attendu ErrNotFound", err)
+	}
+	if err := s.Activities.Delete(other.ID, activity.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Delete par un autre utilisateur: %v, attendu ErrNotFound", err)
+	}
+
+	if err := s.Activities.Delete(user.ID, activity.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Activities.Get(user.ID, activity.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get après Delete: %v, attendu ErrNotFound", err)
+	}
+	if err := s.Activities.Delete(user.ID, activity.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("second Delete: %v, attendu ErrNotFound", err)
+	}
+}
+
+func activityRangeTotal(t *testing.T, s store.Stores) {
+	user := newUser(t, s)
+	other := newUser(t, s)
+	for _, a := range []models.Activity{
+		{UserID: user.ID, ActivityID: "train", Quantity: 10, Date: date(2024, time.January, 10), CarbonAmount: 1},
+		{UserID: user.ID, ActivityID: "train", Quantity: 20, Date: date(2024, time.January, 20), CarbonAmount: 2},
+		{UserID: user.ID, ActivityID: "train", Quantity: 40, Date: date(2024, time.February, 5), CarbonAmount: 4},
+		{UserID: other.ID, ActivityID: "train", Quantity: 80, Date: date(2024, time.January, 20), CarbonAmount: 8},
+	} {
+		if err := s.Activities.Create(&a); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	all, err := s.Activities.List(user.ID, nil, nil)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var amounts []float64
+	for _, a := range all {
+		amounts = append(amounts, a.CarbonAmount)
+	}
+	if fmt.Sprint(amounts) != fmt.Sprint([]float64{4, 2, 1}) {
+		t.Errorf("List = %v, attendu [4 2 1] (plus récentes d'abord)", amounts)
+	}
+
+	from, to := date(2024, time.January, 20), date(2024, time.January, 31)
+	inJanuary, err := s.Activities.List(user.ID, &from, &to)
+	if err != nil || len(inJanuary) != 1 || !near(inJanuary[0].CarbonAmount, 2) {
+		t.Errorf("List sur la période = %+v, %v", inJanuary, err)
+	}
+
+	total, count, err := s.Activities.Total(user.ID, nil, nil)
+	if err != nil || !near(total, 7) || count != 3 {
+		t.Errorf("Total = %v (%d), %v, attendu 7 (3)", total, count, err)
+	}
+	total, count, err = s.Activities.Total(user.ID, nil, &to)
+	if err != nil || !near(total, 3) || count != 2 {
+		t.Errorf("Total jusqu'au %s = %v (%d), %v, attendu 3 (2)", to.Format("2006-01-02"), total, count, err)
+	}
+}
+
+func resultGet(t *testing.T, s store.Stores) {
+	user := newUser(t, s)
+	other := newUser(t, s)
+	result := models.Result{UserID: user.ID, Category: "Numerique", Value: 3, Month: month(2024, time.April)}
+	if err := s.Results.Upsert(&result, save(user.ID)); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if result.Revision != 1 || result.UpdatedAt.IsZero() {
+		t.Errorf("premier Upsert: révision %d, updated_at %s", result.Revision, result.UpdatedAt)
+	}
+
+	got, err := s.Results.Get(user.ID, result.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.ID != result.ID || !near(got.Value, 3) || !sameDay(got.Month, result.Month) || got.Revision != 1 {
+		t.Errorf("Get = %+v, attendu %+v", got, result)
+	}
+	if _, err := s.Results.Get(other.ID, result.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get par un autre utilisateur: %v, attendu ErrNotFound", err)
+	}
+	if _, err := s.Results.Get(user.ID, "pas-un-uuid"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get identifiant invalide: %v, attendu ErrNotFound", err)
+	}
+}
+
+func resultHistory(t *testing.T, s store.Stores) {
+	user := newUser(t, s)
+	other := newUser(t, s)
+	for i, value := range []float64{1, 2, 3} {
+		result := models.Result{
+			UserID:   user.ID,
+			Category: "Transports",
+			Value:    value,
+			Inputs:   json.RawMessage(fmt.Sprintf(`{"train": %d}`, i)),
+			Month:    month(2024, time.May),
+		}
+		change := save(user.ID)
+		if i == 2 {
+			change.Source = store.SourceImport
+		}
+		if err := s.Results.Upsert(&result, change); err != nil {
+			t.Fatalf("Upsert: %v", err)
+		}
+	}
+	results, err := s.Results.List(user.ID)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("List = %d résultat(s), %v", len(results), err)
+	}
+	id := results[0].ID
+
+	revisions, err := s.Results.History(user.ID, id)
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(revisions) != 3 {
+		t.Fatalf("History = %d révision(s), attendu 3", len(revisions))
+	}
+	for i, revision := range revisions {
+		if revision.Revision != 3-i || !near(revision.Value, float64(3-i)) || revision.ResultID != id {
+			t.Errorf("révision %d = %+v, attendu la révision %d de valeur %d", i, revision, 3-i, 3-i)
+		}
+		if revision.ChangedBy == nil || *revision.ChangedBy != user.ID {
+			t.Errorf("révision %d: auteur %v, attendu %s", revision.Revision, revision.ChangedBy, user.ID)
+		}
+	}
+	if revisions[0].Source != store.SourceImport || revisions[2].Source != store.SourceSave {
+		t.Errorf("origines = %s, %s, attendu import puis save", revisions[0].Source, revisions[2].Source)
+	}
+	if !sameJSON(revisions[2].Inputs, []byte(`{"train": 0}`)) {
+		t.Errorf("inputs de la première révision = %s", revisions[2].Inputs)
+	}
+
+	if _, err := s.Results.History(other.ID, id); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("History par un autre utilisateur: %v, attendu ErrNotFound", err)
+	}
+}
+
+func resultRestore(t *testing.T, s store.Stores) {
+	user := newUser(t, s)
+	other := newUser(t, s)
+	first := models.Result{
+		UserID:    user.ID,
+		Category:  "Alimentation",
+		Value:     10,
+		Inputs:    json.RawMessage(`{"redMeat": 2}`),
+		Breakdown: json.RawMessage(`[{"key": "redMeat", "value": 10}]`),
+		Month:     month(2024, time.July),
+	}
+	if err := s.Results.Upsert(&first, save(user.ID)); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	second := models.Result{UserID: user.ID, Category: "Alimentation", Value: 99, Inputs: json.RawMessage(`{"redMeat": 20}`), Month: month(2024, time.July)}
+	if err := s.Results.Upsert(&second, save(user.ID)); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	if _, err := s.Results.Restore(other.ID, first.ID, 1, 0, other.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Restore par un autre utilisateur: %v, attendu ErrNotFound", err)
+	}
+	if _, err := s.Results.Restore(user.ID, first.ID, 7, 0, user.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Restore d'une révision inconnue: %v, attendu ErrNotFound", err)
+	}
+	if _, err := s.Results.Restore(user.ID, first.ID, 1, 1, user.ID); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("Restore avec une révision obsolète: %v, attendu ErrConflict", err)
+	}
+
+	restored, err := s.Results.Restore(user.ID, first.ID, 1, 2, user.ID)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if restored.ID != first.ID || restored.Revision != 3 || !near(restored.Value, 10) {
+		t.Errorf("Restore = révision %d, valeur %v, attendu révision 3, valeur 10", restored.Revision, restored.Value)
+	}
+	if !sameJSON(restored.Inputs, first.Inputs) || !sameJSON(restored.Breakdown, first.Breakdown) {
+		t.Errorf("Restore: inputs %s, breakdown %s", restored.Inputs, restored.Breakdown)
+	}
+	if !restored.CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("Restore: created_at = %s, attendu %s", restored.CreatedAt, first.CreatedAt)
+	}
+
+	got, err := s.Results.Get(user.ID, first.ID)
+	if err != nil || !near(got.Value, 10) || got.Revision != 3 {
+		t.Errorf("Get après Restore = %+v, %v", got, err)
+	}
+
+	revisions, err := s.Results.History(user.ID, first.ID)
+	if err != nil || len(revisions) != 3 {
+		t.Fatalf("History = %d révision(s), %v", len(revisions), err)
+	}
+	latest := revisions[0]
+	if latest.Source != store.SourceRestore || latest.RestoredFrom == nil || *latest.RestoredFrom != 1 {
+		t.Errorf("dernière révision = %+v, attendu une restauration de la révision 1", latest)
+	}
+}
+
+func resultUpdate(t *testing.T, s store.Stores) {
+	user := newUser(t, s)
+	other := newUser(t, s)
+	original := models.Result{UserID: user.ID, Category: "Logement", Value: 50, Inputs: json.RawMessage(`{"gas": 1}`), Month: month(2024, time.August)}
+	if err := s.Results.Upsert(&original, save(user.ID)); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	stolen := models.Result{ID: original.ID, UserID: other.ID, Value: 1}
+	if err := s.Results.Update(&stolen, 0, save(other.ID)); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Update par un autre utilisateur: %v, attendu ErrNotFound", err)
+	}
+	stale := models.Result{ID: original.ID, UserID: user.ID, Value: 1}
+	if err := s.Results.Update(&stale, original.Revision+1, save(user.ID)); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("Update avec une révision obsolète: %v, attendu ErrConflict", err)
+	}
+
+	updated := models.Result{
+		ID:        original.ID,
+		UserID:    user.ID,
+		Category:  "ignorée",
+		Value:     60,
+		Inputs:    json.RawMessage(`{"gas": 2}`),
+		Month:     month(2030, time.January),
+		Breakdown: json.RawMessage(`[]`),
+	}
+	if err := s.Results.Update(&updated, original.Revision, save(user.ID)); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if updated.Revision != original.Revision+1 || !near(updated.Value, 60) || !sameJSON(updated.Inputs, []byte(`{"gas": 2}`)) {
+		t.Errorf("Update = révision %d, valeur %v, inputs %s", updated.Revision, updated.Value, updated.Inputs)
+	}
+	if updated.Category != "Logement" || !sameDay(updated.Month, original.Month) || !updated.CreatedAt.Equal(original.CreatedAt) {
+		t.Errorf("Update ne doit changer ni la catégorie, ni le mois, ni la création: %+v", updated)
+	}
+
+	// Sans révision attendue, la mise à jour s'applique toujours
+	again := models.Result{ID: original.ID, UserID: user.ID, Value: 70}
+	if err := s.Results.Update(&again, 0, save(user.ID)); err != nil || again.Revision != original.Revision+2 {
+		t.Errorf("Update sans révision: révision %d, %v", again.Revision, err)
+	}
+	revisions, err := s.Results.History(user.ID, original.ID)
+	if err != nil || len(revisions) != 3 {
+		t.Errorf("History après Update = %d révision(s), %v", len(revisions), err)
+	}
+}
+
+func resultDelete(t *testing.T, s store.Stores) {
+	user := newUser(t, s)
+	other := newUser(t, s)
+	result := models.Result{UserID: user.ID, Category: "Transports", Value: 5, Month: month(2024, time.September)}
+	if err := s.Results.Upsert(&result, save(user.ID)); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	if err := s.Results.Delete(other.ID, result.ID, 0); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Delete par un autre utilisateur: %v, attendu ErrNotFound", err)
+	}
+	if err := s.Results.Delete(user.ID, result.ID, result.Revision+1); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("Delete avec une révision obsolète: %v, attendu ErrConflict", err)
+	}
+	if err := s.Results.Delete(user.ID, result.ID, result.Revision); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Results.Get(user.ID, result.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get après Delete: %v, attendu ErrNotFound", err)
+	}
+	if err := s.Results.Delete(user.ID, result.ID, 0); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("second Delete: %v, attendu ErrNotFound", err)
+	}
+	if err := s.Results.Delete(user.ID, "pas-un-uuid", 0); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Delete identifiant invalide: %v, attendu ErrNotFound", err)
+	}
+
+	// Le mois peut être saisi de nouveau, avec un nouvel historique
+	again := models.Result{UserID: user.ID, Category: "Transports", Value: 6, Month: month(2024, time.September)}
+	if err := s.Results.Upsert(&again, save(user.ID)); err != nil {
+		t.Fatalf("Upsert après Delete: %v", err)
+	}
+	if again.Revision != 1 {
+		t.Errorf("révision après Delete = %d, attendu 1", again.Revision)
+	}
+}
+
+func resultDeleteMonth(t *testing.T, s store.Stores) {
+	user := newUser(t, s)
+	other := newUser(t, s)
+	october := map[string]int{}
+	for _, r := range []models.Result{
+		{UserID: user.ID, Category: "Transports", Value: 1, Month: month(2024, time.October)},
+		{UserID: user.ID, Category: "Logement", Value: 2, Month: month(2024, time.October)},
+		{UserID: user.ID, Category: "Transports", Value: 3, Month: month(2024, time.November)},
+		{UserID: other.ID, Category: "Transports", Value: 4, Month: month(2024, time.October)},
+	} {
+		if err := s.Results.Upsert(&r, save(r.UserID)); err != nil {
+			t.Fatalf("Upsert: %v", err)
+		}
+		if r.UserID == user.ID && sameDay(r.Month, month(2024, time.October)) {
+			october[r.ID] = r.Revision
+		}
+	}
+
+	// Un résultat oublié ou une révision obsolète empêchent toute suppression
+	ids := make([]string, 0, len(october))
+	for id := range october {
+		ids = append(ids, id)
+	}
+	refused := map[string]map[string]int{
+		"sans tous les résultats":    {ids[0]: october[ids[0]]},
+		"avec une révision obsolète": {ids[0]: october[ids[0]] + 1, ids[1]: october[ids[1]]},
+	}
+	for name, expected := range refused {
+		if _, err := s.Results.DeleteMonth(user.ID, month(2024, time.October), expected); !errors.Is(err, store.ErrConflict) {
+			t.Errorf("DeleteMonth %s: %v, attendu ErrConflict", name, err)
+		}
+	}
+	if mine, _ := s.Results.List(user.ID); len(mine) != 3 {
+		t.Fatalf("après des DeleteMonth refusés: %d résultat(s), attendu 3", len(mine))
+	}
+
+	deleted, err := s.Results.DeleteMonth(user.ID, month(2024, time.October), october)
+	if err != nil || deleted != 2 {
+		t.Errorf("DeleteMonth = %d, %v, attendu 2", deleted, err)
+	}
+	mine, _ := s.Results.List(user.ID)
+	if len(mine) != 1 || !sameDay(mine[0].Month, month(2024, time.November)) {
+		t.Errorf("après DeleteMonth, résultats de l'utilisateur: %+v", mine)
+	}
+	theirs, _ := s.Results.List(other.ID)
+	if len(theirs) != 1 {
+		t.Errorf("DeleteMonth ne doit pas toucher les autres utilisateurs: %d résultat(s)", len(theirs))
+	}
+	if deleted, err := s.Results.DeleteMonth(user.ID, month(2024, time.October), nil); err != nil || deleted != 0 {
+		t.Errorf("DeleteMonth d'un mois vide = %d, %v", deleted, err)
+	}
+}
+
+func resultFind(t *testing.T, s store.Stores) {
+	user := newUser(t, s)
+	other := newUser(t, s)
+	for _, m := range []time.Month{time.January, time.February, time.March} {
+		for _, category := range []string{"Alimentation", "Logement", "Transports"} {
+			r := models.Result{UserID: user.ID, Category: category, Value: float64(m), Month: month(2024, m)}
+			if err := s.Results.Upsert(&r, save(user.ID)); err != nil {
+				t.Fatalf("Upsert: %v", err)
+			}
+		}
+	}
+	intruder := models.Result{UserID: other.ID, Category: "Logement", Value: 1, Month: month(2024, time.February)}
+	if err := s.Results.Upsert(&intruder, save(other.ID)); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	keys := func(results []models.Result) string {
+		out := []string{}
+		for _, r := range results {
+			out = append(out, r.Month.Format("01")+"/"+r.Category[:1])
+		}
+		return fmt.Sprint(out)
+	}
+
+	from, to := month(2024, time.February), month(2024, time.March)
+	got, err := s.Results.Find(user.ID, store.ResultQuery{From: &from, To: &to, Categories: []string{"Transports", "Alimentation"}})
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if want := "[03/A 03/T 02/A 02/T]"; keys(got) != want {
+		t.Errorf("Find filtré = %s, attendu %s", keys(got), want)
+	}
+
+	// Pages de deux dans chaque ordre : la concaténation est la liste complète
+	for _, tc := range []struct {
+		ascending bool
+		want      string
+	}{
+		{false, "[03/A 03/L 03/T 02/A 02/L 02/T 01/A 01/L 01/T]"},
+		{true, "[01/A 01/L 01/T 02/A 02/L 02/T 03/A 03/L 03/T]"},
+	} {
+		q := store.ResultQuery{Ascending: tc.ascending, Limit: 2}
+		all := []models.Result{}
+		for page := 0; page < 10; page++ {
+			batch, err := s.Results.Find(user.ID, q)
+			if err != nil {
+				t.Fatalf("Find page %d: %v", page, err)
+			}
+			all = append(all, batch...)
+			if len(batch) < q.Limit {
+				break
+			}
+			last := batch[len(batch)-1]
+			q.After = &store.ResultCursor{Month: last.Month, Category: last.Category}
+		}
+		if keys(all) != tc.want {
+			t.Errorf("pagination (croissant=%v) = %s, attendu %s", tc.ascending, keys(all), tc.want)
+		}
+	}
+
+	if got, err := s.Results.Find(other.ID, store.ResultQuery{}); err != nil || len(got) != 1 {
+		t.Errorf("Find d'un autre utilisateur = %d résultat(s), %v", len(got), err)
+	}
+}
@@ -0,0 +1,82 @@
+// Package tokens émet et consomme les tokens à usage unique envoyés par
+// email. Seul leur hash est conservé en base.
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Usages d'un token et durée de validité associée
+const (
+	VerifyEmail   = "verify_email"
+	ResetPassword = "reset_password"
+)
+
+var TTL = map[string]time.Duration{
+	VerifyEmail:   48 * time.Hour,
+	ResetPassword: time.Hour,
+}
+
+var ErrInvalid = errors.New("lien invalide ou expiré")
+
+// Issue crée un token pour l'utilisateur et invalide ceux qu'il avait déjà
+// reçus pour le même usage.
+func Issue(db *sql.DB, userID, purpose string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	// Dates en UTC, écrites et comparées depuis Go (voir sessions)
+	now := time.Now().UTC()
+	_, err = tx.Exec(`
+		UPDATE account_tokens SET used_at = $3
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+	`, userID, purpose, now)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO account_tokens (id, user_id, purpose, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, uuid.New().String(), userID, purpose, hash(token), now.Add(TTL[purpose]))
+	if err != nil {
+		return "", err
+	}
+	return token, tx.Commit()
+}
+
+// Consume marque le token comme utilisé et renvoie l'utilisateur concerné.
+// Un token déjà utilisé, expiré ou émis pour un autre usage est refusé.
+func Consume(db *sql.DB, purpose, token string) (string, error) {
+	var userID string
+	err := db.QueryRow(`
+		UPDATE account_tokens SET used_at = $3
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > $3
+		RETURNING user_id
+	`, hash(token), purpose, time.Now().UTC()).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrInvalid
+	}
+	return userID, err
+}
+
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
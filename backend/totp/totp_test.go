@@ -0,0 +1,75 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// Secret ASCII "12345678901234567890" des vecteurs SHA1 de la RFC 6238
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// Vecteurs de l'annexe B de la RFC 6238 (SHA1), tronqués aux 6 derniers
+// chiffres : le code à 6 chiffres est la valeur modulo 10^6.
+func TestRFC6238Vectors(t *testing.T) {
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, v := range vectors {
+		code, err := Code(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", v.unix, err)
+		}
+		if code != v.code {
+			t.Errorf("Code(%d) = %s, attendu %s", v.unix, code, v.code)
+		}
+
+		step, ok := Verify(rfcSecret, v.code, time.Unix(v.unix, 0), 0)
+		if !ok || step != Step(time.Unix(v.unix, 0)) {
+			t.Errorf("Verify(%d, %s) = %d, %v", v.unix, v.code, step, ok)
+		}
+	}
+}
+
+func TestVerifySkew(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1111111111, 0))
+	current := Step(clock.Now())
+	previous, err := Code(rfcSecret, current-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if step, ok := Verify(rfcSecret, previous, clock.Now(), 1); !ok || step != current-1 {
+		t.Errorf("code du pas précédent: %d, %v ; attendu %d, true", step, ok, current-1)
+	}
+	if _, ok := Verify(rfcSecret, previous, clock.Now(), 0); ok {
+		t.Error("code du pas précédent accepté sans tolérance")
+	}
+
+	clock.Advance(2 * Period)
+	if _, ok := Verify(rfcSecret, previous, clock.Now(), 1); ok {
+		t.Error("code vieux de trois pas accepté")
+	}
+}
+
+func TestVerifyFormat(t *testing.T) {
+	now := time.Unix(59, 0)
+	if _, ok := Verify(rfcSecret, "287 082", now, 0); !ok {
+		t.Error("code avec espace refusé")
+	}
+	for _, code := range []string{"", "28708", "2870820", "abcdef"} {
+		if _, ok := Verify(rfcSecret, code, now, 1); ok {
+			t.Errorf("code %q accepté", code)
+		}
+	}
+	if _, ok := Verify("pas du base32 !", "287082", now, 0); ok {
+		t.Error("secret invalide accepté")
+	}
+}
@@ -0,0 +1,298 @@
+// Package twofactor gère la double authentification des comptes : secret
+// TOTP, codes de secours et seconde étape de connexion.
+package twofactor
+
+import (
+	"carbone-app/totp"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	Issuer = "Calculateur carbone"
+
+	// Pas de 30 s tolérés de part et d'autre pour absorber le décalage
+	// d'horloge du téléphone
+	skew = 1
+
+	recoveryCodeCount = 10
+
+	challengeTTL         = 5 * time.Minute
+	maxChallengeAttempts = 5
+)
+
+// Clock fournit l'heure des vérifications ; les tests la remplacent par une
+// totp.FakeClock.
+var Clock totp.Clock = totp.SystemClock{}
+
+var (
+	ErrNotEnrolled      = errors.New("double authentification non initialisée")
+	ErrAlreadyEnabled   = errors.New("double authentification déjà activée")
+	ErrNotEnabled       = errors.New("double authentification non activée")
+	ErrInvalidCode      = errors.New("code invalide")
+	ErrInvalidChallenge = errors.New("étape de connexion invalide ou expirée")
+)
+
+type Status struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabledAt,omitempty"`
+	RecoveryCodesRemaining int        `json:"recoveryCodesRemaining"`
+}
+
+func GetStatus(db *sql.DB, userID string) (Status, error) {
+	var status Status
+	var enabledAt sql.NullTime
+	err := db.QueryRow(`
+		SELECT u.totp_enabled_at,
+			(SELECT COUNT(*) FROM recovery_codes r WHERE r.user_id = u.id AND r.used_at IS NULL)
+		FROM users u
+		WHERE u.id = $1
+	`, userID).Scan(&enabledAt, &status.RecoveryCodesRemaining)
+	if err != nil {
+		return status, err
+	}
+	if enabledAt.Valid {
+		status.Enabled = true
+		status.EnabledAt = &enabledAt.Time
+	}
+	return status, nil
+}
+
+// Enabled indique si la connexion de l'utilisateur demande un second facteur.
+func Enabled(db *sql.DB, userID string) (bool, error) {
+	status, err := GetStatus(db, userID)
+	return status.Enabled, err
+}
+
+// Enroll génère un nouveau secret, inactif tant qu'il n'est pas confirmé par
+// Confirm, et renvoie l'URI de provisionnement.
+func Enroll(db *sql.DB, userID, account string) (secret, uri string, err error) {
+	if enabled, err := Enabled(db, userID); err != nil {
+		return "", "", err
+	} else if enabled {
+		return "", "", ErrAlreadyEnabled
+	}
+
+	secret, err = totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	_, err = db.Exec("UPDATE users SET totp_secret = $1, totp_last_step = NULL WHERE id = $2", secret, userID)
+	if err != nil {
+		return "", "", err
+	}
+	return secret, totp.ProvisioningURI(secret, Issuer, account), nil
+}
+
+// Confirm active la double authentification avec un premier code valide et
+// renvoie les codes de secours, affichés une seule fois.
+func Confirm(db *sql.DB, userID, code string) ([]string, error) {
+	var secret sql.NullString
+	var enabledAt sql.NullTime
+	err := db.QueryRow("SELECT totp_secret, totp_enabled_at FROM users WHERE id = $1", userID).Scan(&secret, &enabledAt)
+	if err != nil {
+		return nil, err
+	}
+	if enabledAt.Valid {
+		return nil, ErrAlreadyEnabled
+	}
+	if !secret.Valid {
+		return nil, ErrNotEnrolled
+	}
+
+	step, ok := totp.Verify(secret.String, code, Clock.Now(), skew)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET totp_enabled_at = $1, totp_last_step = $2 WHERE id = $3", Clock.Now(), step, userID)
+	if err != nil {
+		return nil, err
+	}
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// RegenerateRecoveryCodes invalide les codes de secours existants et en
+// renvoie de nouveaux.
+func RegenerateRecoveryCodes(db *sql.DB, userID string) ([]string, error) {
+	if enabled, err := Enabled(db, userID); err != nil {
+		return nil, err
+	} else if !enabled {
+		return nil, ErrNotEnabled
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID string) ([]string, error) {
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		raw := hex.EncodeToString(buf)
+		codes[i] = raw[:5] + "-" + raw[5:]
+
+		_, err := tx.Exec("INSERT INTO recovery_codes (id, user_id, code_hash) VALUES ($1, $2, $3)",
+			uuid.New().String(), userID, hash(normalizeRecoveryCode(codes[i])))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// Disable désactive la double authentification et supprime le secret et les
+// codes de secours. Sert aussi à la réinitialisation par un administrateur.
+func Disable(db *sql.DB, userID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL WHERE id = $1", userID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM login_challenges WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Check vérifie un code TOTP ou, à défaut, un code de secours, qui est alors
+// consommé. Un code TOTP déjà utilisé est refusé.
+func Check(db *sql.DB, userID, code string) error {
+	var secret sql.NullString
+	var enabledAt sql.NullTime
+	err := db.QueryRow("SELECT totp_secret, totp_enabled_at FROM users WHERE id = $1", userID).Scan(&secret, &enabledAt)
+	if err != nil {
+		return err
+	}
+	if !enabledAt.Valid || !secret.Valid {
+		return ErrNotEnabled
+	}
+
+	if step, ok := totp.Verify(secret.String, code, Clock.Now(), skew); ok {
+		// La condition sur totp_last_step rend la vérification atomique
+		res, err := db.Exec(`
+			UPDATE users SET totp_last_step = $1
+			WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)
+		`, step, userID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrInvalidCode
+		}
+		return nil
+	}
+
+	res, err := db.Exec(`
+		UPDATE recovery_codes SET used_at = $1
+		WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL
+	`, Clock.Now(), userID, hash(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// CreateChallenge ouvre la seconde étape de connexion et renvoie le token à
+// présenter avec le code.
+func CreateChallenge(db *sql.DB, userID string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	_, err := db.Exec(`
+		INSERT INTO login_challenges (id, user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, uuid.New().String(), userID, hash(token), Clock.Now().Add(challengeTTL))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// CompleteChallenge vérifie le code présenté pour une étape de connexion et
+// renvoie l'utilisateur. L'étape est consommée en cas de succès et
+// abandonnée après trop de codes invalides.
+func CompleteChallenge(db *sql.DB, token, code string) (string, error) {
+	var id, userID string
+	err := db.QueryRow(`
+		UPDATE login_challenges SET attempts = attempts + 1
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2 AND attempts < $3
+		RETURNING id, user_id
+	`, hash(token), Clock.Now(), maxChallengeAttempts).Scan(&id, &userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrInvalidChallenge
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := Check(db, userID, code); err != nil {
+		return userID, err
+	}
+
+	res, err := db.Exec("UPDATE login_challenges SET used_at = $1 WHERE id = $2 AND used_at IS NULL", Clock.Now(), id)
+	if err != nil {
+		return userID, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return userID, ErrInvalidChallenge
+	}
+	return userID, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+func hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
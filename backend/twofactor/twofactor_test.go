@@ -0,0 +1,170 @@
+package twofactor
+
+import (
+	"carbone-app/config"
+	"carbone-app/migrations"
+	"carbone-app/models"
+	"carbone-app/store"
+	"carbone-app/totp"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setup ouvre une base SQLite migrée, crée un utilisateur et fixe l'horloge.
+func setup(t *testing.T) (*sql.DB, string, *totp.FakeClock) {
+	t.Helper()
+	cfg := config.Default().Database
+	cfg.Driver = config.DriverSQLite
+	cfg.DSN = filepath.Join(t.TempDir(), "twofactor.db")
+	db, err := config.InitDB(cfg)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := migrations.Up(db, config.DriverSQLite); err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+
+	user := models.User{Email: "alice@example.com", Username: "alice", Password: "hash", Role: models.RoleUser}
+	if err := store.NewSQLite(db).Users.Create(&user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	clock := totp.NewFakeClock(time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC))
+	previous := Clock
+	Clock = clock
+	t.Cleanup(func() { Clock = previous })
+	return db, user.ID, clock
+}
+
+// enable active la double authentification et renvoie le secret et les codes
+// de secours.
+func enable(t *testing.T, db *sql.DB, userID string) (string, []string) {
+	t.Helper()
+	secret, _, err := Enroll(db, userID, "alice@example.com")
+	if err != nil {
+		t.Fatalf("Enroll: %v", err)
+	}
+	codes, err := Confirm(db, userID, code(t, secret, 0))
+	if err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	return secret, codes
+}
+
+// code renvoie le code TOTP du pas courant décalé de delta.
+func code(t *testing.T, secret string, delta int64) string {
+	t.Helper()
+	c, err := totp.Code(secret, totp.Step(Clock.Now())+delta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCheckRejectsReplayedStep(t *testing.T) {
+	db, userID, clock := setup(t)
+	secret, _ := enable(t, db, userID)
+
+	// Le code qui a servi à l'activation ne peut plus servir
+	if err := Check(db, userID, code(t, secret, 0)); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("code de l'activation rejoué: %v", err)
+	}
+
+	clock.Advance(totp.Period)
+	current := code(t, secret, 0)
+	if err := Check(db, userID, current); err != nil {
+		t.Fatalf("code du nouveau pas: %v", err)
+	}
+	if err := Check(db, userID, current); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("même code rejoué: %v", err)
+	}
+	// Un pas antérieur encore dans la tolérance d'horloge est aussi refusé
+	if err := Check(db, userID, code(t, secret, -1)); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("code d'un pas déjà dépassé: %v", err)
+	}
+}
+
+func TestRecoveryCodesAreSingleUse(t *testing.T) {
+	db, userID, _ := setup(t)
+	_, codes := enable(t, db, userID)
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("%d codes de secours, attendu %d", len(codes), recoveryCodeCount)
+	}
+
+	// La saisie tolère majuscules et espaces à la place du tiret
+	typed := strings.ToUpper(strings.Replace(codes[0], "-", " ", 1))
+	if err := Check(db, userID, typed); err != nil {
+		t.Fatalf("code de secours: %v", err)
+	}
+	if err := Check(db, userID, codes[0]); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("code de secours réutilisé: %v", err)
+	}
+
+	status, err := GetStatus(db, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.RecoveryCodesRemaining != recoveryCodeCount-1 {
+		t.Errorf("%d codes restants, attendu %d", status.RecoveryCodesRemaining, recoveryCodeCount-1)
+	}
+
+	// Régénérer invalide les anciens codes
+	fresh, err := RegenerateRecoveryCodes(db, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Check(db, userID, codes[1]); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("ancien code après régénération: %v", err)
+	}
+	if err := Check(db, userID, fresh[0]); err != nil {
+		t.Fatalf("nouveau code: %v", err)
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	db, userID, clock := setup(t)
+	secret, _ := enable(t, db, userID)
+	clock.Advance(totp.Period)
+
+	token, err := CreateChallenge(db, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := CompleteChallenge(db, token, code(t, secret, 0))
+	if err != nil || got != userID {
+		t.Fatalf("CompleteChallenge = %q, %v", got, err)
+	}
+	// L'étape est consommée
+	clock.Advance(totp.Period)
+	if _, err := CompleteChallenge(db, token, code(t, secret, 0)); !errors.Is(err, ErrInvalidChallenge) {
+		t.Fatalf("étape réutilisée: %v", err)
+	}
+
+	// Trop de codes invalides abandonnent l'étape, puis elle expire
+	token, err = CreateChallenge(db, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxChallengeAttempts; i++ {
+		if _, err := CompleteChallenge(db, token, "000000"); !errors.Is(err, ErrInvalidCode) {
+			t.Fatalf("tentative %d: %v", i+1, err)
+		}
+	}
+	if _, err := CompleteChallenge(db, token, code(t, secret, 0)); !errors.Is(err, ErrInvalidChallenge) {
+		t.Fatalf("étape après trop de tentatives: %v", err)
+	}
+
+	token, err = CreateChallenge(db, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(challengeTTL + time.Second)
+	if _, err := CompleteChallenge(db, token, code(t, secret, 0)); !errors.Is(err, ErrInvalidChallenge) {
+		t.Fatalf("étape expirée: %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+const API = 'http://localhost:8080';
+
+type Tokens = {
+    token: string;
+    refreshToken: string;
+    expiresIn: number;
+};
+
+// Conserve la paire de tokens renvoyée par /login, /register ou /token/refresh
+export function storeTokens(tokens: Tokens) {
+    localStorage.setItem('token', tokens.token);
+    localStorage.setItem('refreshToken', tokens.refreshToken);
+}
+
+export function clearTokens() {
+    localStorage.removeItem('token');
+    localStorage.removeItem('refreshToken');
+}
+
+// Échange le refresh token contre une nouvelle paire ; renvoie false si la
+// session n'est plus valide
+export async function refreshSession(): Promise<boolean> {
+    const refreshToken = localStorage.getItem('refreshToken');
+    if (!refreshToken) return false;
+
+    const response = await fetch(`${API}/api/token/refresh`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ refreshToken })
+    });
+    if (!response.ok) {
+        clearTokens();
+        return false;
+    }
+    storeTokens(await response.json());
+    return true;
+}
+
+export async function logout(allDevices = false) {
+    const token = localStorage.getItem('token');
+    if (token) {
+        try {
+            await fetch(`${API}/api/logout${allDevices ? '/all' : ''}`, {
+                method: 'POST',
+                headers: { 'Authorization': token }
+            });
+        } catch (error) {
+            console.error('Erreur:', error);
+        }
+    }
+    clearTokens();
+}
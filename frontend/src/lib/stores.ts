@@ -8,6 +8,7 @@ type User = {
     id: string;
     email: string;
     username: string;
+    role?: string;
 } | null;
 
 // Initialiser explicitement à null et exporter le type